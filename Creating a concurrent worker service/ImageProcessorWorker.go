@@ -1,41 +1,152 @@
 package ImageService
 
 import (
+	"bufio"
 	"fmt"
 	"image"
 	"image/color"
 	"image/png"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// MinProcessors and MaxProcessors bound the goroutines processing images. Another one starts while work is queued and
+// the CPU isn't used up, and one which found nothing to do for processorIdleTimeout ends. While the CPU usage of the
+// machine is above maxCpuUsage, one processor ends after every task until MinProcessors are left. MemoryBudget are the
+// bytes of decoded images held at once. Set them before calling RunService.
+var MinProcessors = 4
+var MaxProcessors = 40
+var MemoryBudget int64 = 1 << 30
+
+const processorIdleTimeout = 10 * time.Second
+
+const maxCpuUsage = 0.9
+
+type processorPool struct {
+	sync.Mutex
+	memoryFreed *sync.Cond
+	processors  int
+	busy        int
+	reserved    int64
+	finished    int
+	surplus     int // Processors to end after their task, as the CPU is used up.
+}
+
+var globalProcessorPool = &processorPool{}
+
 func startProcessor(workToDo chan string, finishedWorkMap *map[string]bool) {
 	var workId string
-	counter := 0
 	finishedWorkCommunicator := make(chan string)
-	for i := 0; i < 40; i++ {
-		go startImageProcessorWorker(workToDo, finishedWorkCommunicator)
+	globalProcessorPool.memoryFreed = sync.NewCond(globalProcessorPool)
+	for i := 0; i < MinProcessors; i++ {
+		globalProcessorPool.startWorker(workToDo, finishedWorkCommunicator)
 	}
+	cpu := cpuSampler{}
+	cpu.usage()
+	scaleTicker := time.NewTicker(time.Second)
 	for {
 		select {
 		case workId = <-finishedWorkCommunicator:
 			globalFinishedWorkMapMutex.Lock()
 			(*finishedWorkMap)[workId] = true
 			globalFinishedWorkMapMutex.Unlock()
-			counter++
-			fmt.Println("Finished:", counter)
+			globalProcessorPool.Lock()
+			globalProcessorPool.finished++
+			fmt.Println("Finished:", globalProcessorPool.finished)
+			globalProcessorPool.Unlock()
+		case <-scaleTicker.C:
+			cpuUsage := cpu.usage()
+			globalProcessorPool.Lock()
+			overloaded := cpuUsage > maxCpuUsage
+			if overloaded && globalProcessorPool.processors-globalProcessorPool.surplus > MinProcessors {
+				globalProcessorPool.surplus++
+			}
+			grow := !overloaded && len(workToDo) > 0 && globalProcessorPool.busy == globalProcessorPool.processors && globalProcessorPool.processors < MaxProcessors
+			globalProcessorPool.Unlock()
+			if grow {
+				globalProcessorPool.startWorker(workToDo, finishedWorkCommunicator)
+			}
 		}
 	}
 }
 
+func (pool *processorPool) startWorker(workToDo chan string, finishedWorkCommunicator chan string) {
+	pool.Lock()
+	pool.processors++
+	pool.Unlock()
+	go startImageProcessorWorker(workToDo, finishedWorkCommunicator)
+}
+
 func startImageProcessorWorker(workToDo chan string, finishedWorkCommunicator chan string) {
 	for {
-		workId := <-workToDo
-		if modifyImage(workId) {
-			finishedWorkCommunicator <- workId
+		select {
+		case workId := <-workToDo:
+			globalProcessorPool.setBusy(1)
+			if modifyImage(workId) {
+				finishedWorkCommunicator <- workId
+			}
+			globalProcessorPool.setBusy(-1)
+			if globalProcessorPool.stopSurplusWorker() {
+				return
+			}
+		case <-time.After(processorIdleTimeout):
+			if globalProcessorPool.stopIdleWorker() {
+				return
+			}
 		}
 	}
 }
 
+func (pool *processorPool) setBusy(change int) {
+	pool.Lock()
+	pool.busy += change
+	pool.Unlock()
+}
+
+// stopIdleWorker tells an idle worker whether to end, which it does while there are more than MinProcessors.
+func (pool *processorPool) stopIdleWorker() bool {
+	pool.Lock()
+	defer pool.Unlock()
+	if pool.processors <= MinProcessors {
+		return false
+	}
+	pool.processors--
+	return true
+}
+
+// stopSurplusWorker tells a worker which finished its task whether to end, as the CPU is used up.
+func (pool *processorPool) stopSurplusWorker() bool {
+	pool.Lock()
+	defer pool.Unlock()
+	if pool.surplus == 0 {
+		return false
+	}
+	pool.surplus--
+	pool.processors--
+	return true
+}
+
+// reserveMemory waits until the decoded image fits into the MemoryBudget. An image larger than the whole budget is
+// only decoded when nothing else is.
+func (pool *processorPool) reserveMemory(size int64) {
+	pool.Lock()
+	for pool.reserved > 0 && pool.reserved+size > MemoryBudget {
+		pool.memoryFreed.Wait()
+	}
+	pool.reserved += size
+	pool.Unlock()
+}
+
+func (pool *processorPool) freeMemory(size int64) {
+	pool.Lock()
+	pool.reserved -= size
+	pool.Unlock()
+	pool.memoryFreed.Broadcast()
+}
+
 func modifyImage(workId string) bool {
 	file, err := os.Open("/tmp/" + workId + ".png")
 	defer file.Close()
@@ -43,6 +154,20 @@ func modifyImage(workId string) bool {
 		fmt.Println(err)
 		return false
 	}
+	config, err := png.DecodeConfig(file)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	// The decoded image and the result
+	imageMemory := int64(config.Width) * int64(config.Height) * 4 * 2
+	globalProcessorPool.reserveMemory(imageMemory)
+	defer globalProcessorPool.freeMemory(imageMemory)
+	_, err = file.Seek(0, 0)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
 	myImage, err := png.Decode(file)
 	if err != nil {
 		fmt.Println(err)
@@ -70,3 +195,44 @@ func modifyImage(workId string) bool {
 	file.Close()
 	return true
 }
+
+// cpuSampler measures the CPU usage of the machine from /proc/stat, between two calls of usage.
+type cpuSampler struct {
+	idle, total uint64
+}
+
+// usage returns the share of the CPU used since the last call, or -1 where /proc/stat isn't available.
+func (c *cpuSampler) usage() float64 {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return -1
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return -1
+	}
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return -1
+	}
+	var idle, total uint64
+	for i, field := range fields[1:] {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return -1
+		}
+		total += value
+		// idle and iowait
+		if i == 3 || i == 4 {
+			idle += value
+		}
+	}
+
+	idleDelta, totalDelta := idle-c.idle, total-c.total
+	c.idle, c.total = idle, total
+	if totalDelta == 0 {
+		return 0
+	}
+	return 1 - float64(idleDelta)/float64(totalDelta)
+}
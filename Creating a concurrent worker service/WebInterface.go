@@ -37,6 +37,15 @@ func setupWebInterface(workToDo chan string, finishedWorkMap *map[string]bool) {
 			fmt.Fprintln(w, "In progress or not found.")
 		}
 	})
+	http.HandleFunc("/pool", func(w http.ResponseWriter, r *http.Request) {
+		globalProcessorPool.Lock()
+		defer globalProcessorPool.Unlock()
+		fmt.Fprintln(w, "Processors:", globalProcessorPool.processors, "of", MinProcessors, "-", MaxProcessors)
+		fmt.Fprintln(w, "Busy:", globalProcessorPool.busy)
+		fmt.Fprintln(w, "Queued:", len(workToDo))
+		fmt.Fprintln(w, "Memory reserved:", globalProcessorPool.reserved, "of", MemoryBudget)
+		fmt.Fprintln(w, "Finished:", globalProcessorPool.finished)
+	})
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "POST" {
 			newWorkId := uuid.NewV4().String()
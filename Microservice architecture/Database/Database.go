@@ -1,303 +1,395 @@
-package main
+package database
 
 import (
 	"net/http"
-	"net/url"
 	"fmt"
 	"sync"
-	"strconv"
 	"encoding/json"
 	"io/ioutil"
 	"time"
-	"os"
+	"context"
+	"strings"
+
+	"../rpc"
+	"../service"
 )
 
-type Task struct {
-	Id int `json:"id"`
-	State int `json:"state"`
-}
+type Task = service.Task
+type Delivery = service.Delivery
+
+// Task states
+const (
+	stateNotStarted = service.TaskNotStarted
+	stateInProgress = service.TaskInProgress
+	stateFinished   = service.TaskFinished
+	statePending    = service.TaskPending
+	stateFailed     = service.TaskFailed
+)
 
-var datastore map[int]Task
+var datastore map[int64]Task
 var datastoreMutex sync.RWMutex
-var oldestNotFinishedTask int // remember to account for potential int overflow in production. Use something bigger.
+var nextTaskId int64 // Ids aren't reused, even once tasks have been deleted.
+var oldestNotFinishedTask int64 // remember to account for potential int overflow in production. Use something bigger.
 var oNFTMutex sync.RWMutex
 
-func main() {
-
-	if !registerInKVStore() {
-		return
+// Main runs the tasks-store. The args are its address and the one of the config store.
+func Main(args []string) {
+	myService := service.New("tasks-store", args[0], args[1])
+	err := myService.Register(context.Background(), service.TaskStoreKey)
+	if err != nil {
+		service.Fatal(err)
 	}
 
-	datastore = make(map[int]Task)
+	datastore = make(map[int64]Task)
 	datastoreMutex = sync.RWMutex{}
 	oldestNotFinishedTask = 0
 	oNFTMutex = sync.RWMutex{}
 
-	http.HandleFunc("/getById", getById)
-	http.HandleFunc("/newTask", newTask)
-	http.HandleFunc("/getNewTask", getNewTask)
-	http.HandleFunc("/finishTask", finishTask)
-	http.HandleFunc("/setById", setById)
-	http.HandleFunc("/list", list)
-	http.ListenAndServe(":3001", nil)
+	myService.Handle("/getById", service.Methods{http.MethodGet: getById})
+	myService.Handle("/newTask", service.Methods{http.MethodPost: newTask})
+	myService.Handle("/getNewTask", service.Methods{http.MethodPost: getNewTask})
+	myService.Handle("/finishTask", service.Methods{http.MethodPost: finishTask})
+	myService.Handle("/failTask", service.Methods{http.MethodPost: failTask})
+	myService.Handle("/setById", service.Methods{http.MethodPost: setById})
+	myService.Handle("/setMetadata", service.Methods{http.MethodPost: setMetadata})
+	myService.Handle("/activateTask", service.Methods{http.MethodPost: activateTask})
+	myService.Handle("/abortTask", service.Methods{http.MethodPost: abortTask})
+	myService.Handle("/setProgress", service.Methods{http.MethodPost: setProgress})
+	myService.Handle("/listTasks", service.Methods{http.MethodGet: listTasks})
+	myService.Handle("/addDelivery", service.Methods{http.MethodPost: addDelivery})
+	myService.Handle("/stats", service.Methods{http.MethodGet: getStats})
+	myService.Handle("/requeueTask", service.Methods{http.MethodPost: requeueTask})
+	myService.Handle("/releaseTask", service.Methods{http.MethodPost: releaseTask})
+	myService.Handle("/cancelTask", service.Methods{http.MethodPost: cancelTask})
+	myService.Handle("/deleteTask", service.Methods{http.MethodPost: deleteTask})
+	myService.Handle("/list", service.Methods{http.MethodGet: list})
+	rpc.RegisterTaskStoreServer(myService.EnableGrpc(), taskStoreServer{})
+	err = myService.Run()
+	if err != nil {
+		service.Fatal(err)
+	}
 }
 
-func getById(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		values, err := url.ParseQuery(r.URL.RawQuery)
-		if err != nil {
-			fmt.Fprint(w, err)
-			return
-		}
-		if len(values.Get("id")) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Wrong input")
-			return
-		}
+var errWrongState = service.NewError(http.StatusBadRequest, "wrong_state", "The task isn't in the right state")
+var errNotHolder = service.NewError(http.StatusForbidden, "not_holder", "Another worker holds the claim of the task")
 
-		id, err := strconv.Atoi(string(values.Get("id")))
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, err)
-			return
-		}
+// holds tells whether the worker holds the claim of the task, and so may change it.
+func holds(task Task, worker string) bool {
+	return len(worker) != 0 && task.Worker == worker
+}
+
+// unchanged tells why the worker couldn't change the task.
+func unchanged(id int64, worker string) error {
+	task, ok := lookupTask(id)
+	if ok && task.State == stateInProgress && !holds(task, worker) {
+		return errNotHolder
+	}
+	return errWrongState
+}
 
-		datastoreMutex.RLock()
-		bIsInError := err != nil || id >= len(datastore) // Reading the length of a slice must be done in a synchronized manner. That's why the mutex is used.
-		datastoreMutex.RUnlock()
+// taskId returns the id parameter of the request.
+func taskId(r *http.Request) (int64, error) {
+	values, err := service.Query(r)
+	if err != nil {
+		return 0, err
+	}
+	return service.Int(values, "id")
+}
 
-		if bIsInError {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Wrong input")
-			return
-		}
+func getById(w http.ResponseWriter, r *http.Request) error {
+	id, err := taskId(r)
+	if err != nil {
+		return err
+	}
 
-		datastoreMutex.RLock()
-		value := datastore[id]
-		datastoreMutex.RUnlock()
+	value, ok := lookupTask(id)
+	if !ok {
+		return service.NewError(http.StatusNotFound, "not_found", fmt.Sprint("No task ", id))
+	}
 
-		response, err := json.Marshal(value)
+	return service.WriteJSON(w, value)
+}
 
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, err)
-			return
-		}
+func lookupTask(id int64) (Task, bool) {
+	datastoreMutex.RLock()
+	defer datastoreMutex.RUnlock()
+	task, ok := datastore[id]
+	return task, ok
+}
 
-		fmt.Fprint(w, string(response))
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only GET accepted")
+func newTask(w http.ResponseWriter, r *http.Request) error {
+	values := r.URL.Query()
+	parameters := []byte(values.Get("parameters"))
+	if len(parameters) != 0 && !json.Valid(parameters) {
+		return service.WrongInput("The parameters must be valid JSON")
 	}
+	taskToAdd := createTask(len(values.Get("pending")) != 0, values.Get("callback"), values.Get("client"), values.Get("operation"), parameters, values.Get("trace"))
+
+	fmt.Fprint(w, taskToAdd.Id)
+	return nil
 }
 
-func newTask(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		datastoreMutex.Lock()
-		taskToAdd := Task{
-			Id: len(datastore),
-			State: 0,
-		}
-		datastore[taskToAdd.Id] = taskToAdd
-		datastoreMutex.Unlock()
+func createTask(pending bool, callback string, client string, operation string, parameters []byte, trace string) Task {
+	state := stateNotStarted
+	if pending {
+		state = statePending
+	}
+	if len(operation) == 0 {
+		operation = service.DefaultOperation
+	}
 
-		fmt.Fprint(w, taskToAdd.Id)
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only POST accepted")
+	datastoreMutex.Lock()
+	taskToAdd := Task{
+		Id: nextTaskId,
+		State: state,
+		CreatedAt: time.Now(),
+		Callback: callback,
+		Client: client,
+		Operation: operation,
+		Parameters: parameters,
+		Trace: trace,
 	}
+	datastore[taskToAdd.Id] = taskToAdd
+	nextTaskId++
+	datastoreMutex.Unlock()
+	return taskToAdd
 }
 
-func getNewTask(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
+func getNewTask(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+	// Without the worker nobody would hold the claim.
+	worker, err := service.Required(values, "worker")
+	if err != nil {
+		return err
+	}
+	operations := []string{}
+	if len(values.Get("operations")) != 0 {
+		operations = strings.Split(values.Get("operations"), ",")
+	}
+	taskToSend, ok := claimTask(worker, operations)
+	if !ok {
+		return service.NewError(http.StatusNotFound, "no_task", "No non-started task.")
+	}
 
-		bErrored := false
+	return service.WriteJSON(w, taskToSend)
+}
 
-		datastoreMutex.RLock()
-		if len(datastore) == 0 {
-			bErrored = true
+// claimTask starts the oldest not started task of the operations, any if there are none, for the worker. It's handed
+// out again if it isn't finished within -claim-timeout.
+func claimTask(worker string, operations []string) (Task, bool) {
+	taskToSend := Task{Id: -1, State: stateNotStarted}
+
+	oNFTMutex.Lock()
+	datastoreMutex.Lock()
+	for i := oldestNotFinishedTask; i < nextTaskId; i++ {
+		task, ok := datastore[i]
+		if (!ok || task.State == stateFinished || task.State == stateFailed) && i == oldestNotFinishedTask {
+			oldestNotFinishedTask++
+			continue
 		}
-		datastoreMutex.RUnlock()
-
-		if bErrored {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error: No non-started task.")
-			return
+		if ok && task.State == stateNotStarted && supports(operations, task.Operation) {
+			task.State = stateInProgress
+			now := time.Now()
+			task.StartedAt = &now
+			task.Progress = 0
+			task.Attempts++
+			task.Worker = worker
+			datastore[i] = task
+			taskToSend = task
+			break
 		}
+	}
+	datastoreMutex.Unlock()
+	oNFTMutex.Unlock()
 
-		taskToSend := Task{Id: -1, State: 0}
+	if taskToSend.Id == -1 {
+		return taskToSend, false
+	}
 
-		oNFTMutex.Lock()
+	myId := taskToSend.Id
+	claimedAt := *taskToSend.StartedAt
+
+	go func() {
+		time.Sleep(service.ClaimTimeout.Get())
 		datastoreMutex.Lock()
-		for i := oldestNotFinishedTask; i < len(datastore); i++ {
-			if datastore[i].State == 2 && i == oldestNotFinishedTask {
-				oldestNotFinishedTask++
-				continue
-			}
-			if datastore[i].State == 0 {
-				datastore[i] = Task{Id: i, State: 1}
-				taskToSend = datastore[i]
-				break
-			}
+		// The task may have been released and claimed again meanwhile, only this claim expires.
+		task := datastore[myId]
+		if task.State == stateInProgress && task.StartedAt != nil && task.StartedAt.Equal(claimedAt) {
+			task.State = stateNotStarted
+			task.StartedAt = nil
+			task.Worker = ""
+			task.Progress = 0
+			datastore[myId] = task
+			claimsExpired.Inc(task.Operation)
 		}
 		datastoreMutex.Unlock()
-		oNFTMutex.Unlock()
-
-		if taskToSend.Id == -1 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error: No non-started task.")
-			return
-		}
+	}()
 
-		myId := taskToSend.Id
-
-		go func() {
-			time.Sleep(time.Second * 120)
-			datastoreMutex.Lock()
-			if datastore[myId].State == 1 {
-				datastore[myId] = Task{Id: myId, State: 0}
-			}
-			datastoreMutex.Unlock()
-		}()
-
-		response, err := json.Marshal(taskToSend)
+	return taskToSend, true
+}
 
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, err)
-			return
+// supports tells whether a worker of the operations may process a task of the operation.
+func supports(operations []string, operation string) bool {
+	if len(operations) == 0 {
+		return true
+	}
+	for _, supported := range operations {
+		if supported == operation {
+			return true
 		}
-
-		fmt.Fprint(w, string(response))
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only POST accepted")
 	}
+	return false
 }
 
-func finishTask(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		values, err := url.ParseQuery(r.URL.RawQuery)
-		if err != nil {
-			fmt.Fprint(w, err)
-			return
-		}
-		if len(values.Get("id")) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Wrong input")
-			return
-		}
-
-		id, err := strconv.Atoi(string(values.Get("id")))
+func finishTask(w http.ResponseWriter, r *http.Request) error {
+	id, err := taskId(r)
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, err)
-			return
-		}
+	worker := r.URL.Query().Get("worker")
+	_, ok := completeTask(id, worker)
+	if !ok {
+		return unchanged(id, worker)
+	}
 
-		updatedTask := Task{Id: id, State: 2}
+	fmt.Fprint(w, "success")
+	return nil
+}
 
-		bErrored := false
+func completeTask(id int64, worker string) (Task, bool) {
+	datastoreMutex.Lock()
+	defer datastoreMutex.Unlock()
+	if datastore[id].State != stateInProgress || !holds(datastore[id], worker) {
+		return Task{}, false
+	}
+	updatedTask := datastore[id]
+	updatedTask.State = stateFinished
+	now := time.Now()
+	updatedTask.FinishedAt = &now
+	updatedTask.Progress = 100
+	updatedTask.Error = ""
+	updatedTask.ErrorCode = ""
+	datastore[id] = updatedTask
+	return updatedTask, true
+}
 
-		datastoreMutex.Lock()
-		if datastore[id].State == 1 {
-			datastore[id] = updatedTask
-		} else {
-			bErrored = true
-		}
-		datastoreMutex.Unlock()
+func setById(w http.ResponseWriter, r *http.Request) error {
+	taskToSet := Task{}
 
-		if bErrored {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error: Wrong input")
-			return
-		}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return service.WrongInput(err.Error())
+	}
+	err = json.Unmarshal([]byte(data), &taskToSet)
+	if err != nil {
+		return service.WrongInput(err.Error())
+	}
 
-		fmt.Fprint(w, "success")
+	bErrored := false
+	datastoreMutex.Lock()
+	_, exists := datastore[taskToSet.Id]
+	if !exists || taskToSet.State > stateFailed || taskToSet.State < 0 {
+		bErrored = true
 	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only POST accepted")
+		datastore[taskToSet.Id] = taskToSet
 	}
-}
+	datastoreMutex.Unlock()
 
-func setById(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		taskToSet := Task{}
+	if bErrored {
+		return service.WrongInput("Wrong input")
+	}
 
-		data, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, err)
-			return
-		}
-		err = json.Unmarshal([]byte(data), &taskToSet)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, err)
-			return
-		}
+	fmt.Fprint(w, "success")
+	return nil
+}
 
-		bErrored := false
-		datastoreMutex.Lock()
-		if taskToSet.Id >= len(datastore) || taskToSet.State > 2 || taskToSet.State < 0 {
-			bErrored = true
-		} else {
-			datastore[taskToSet.Id] = taskToSet
-		}
-		datastoreMutex.Unlock()
+func setMetadata(w http.ResponseWriter, r *http.Request) error {
+	id, err := taskId(r)
+	if err != nil {
+		return err
+	}
 
-		if bErrored {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error: Wrong input")
-			return
-		}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return service.WrongInput(err.Error())
+	}
+	if !json.Valid(data) {
+		return service.WrongInput("Metadata must be valid JSON")
+	}
 
-		fmt.Fprint(w, "success")
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only POST accepted")
+	_, ok := storeMetadata(id, data)
+	if !ok {
+		return errWrongState
 	}
+
+	fmt.Fprint(w, "success")
+	return nil
 }
 
-func list(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		datastoreMutex.RLock()
-		for key, value := range datastore {
-			fmt.Fprintln(w, key, ": ", "id:", value.Id, " state:", value.State)
-		}
-		datastoreMutex.RUnlock()
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only GET accepted")
+func storeMetadata(id int64, data []byte) (Task, bool) {
+	datastoreMutex.Lock()
+	defer datastoreMutex.Unlock()
+	task, ok := datastore[id]
+	if !ok {
+		return Task{}, false
 	}
+	task.Metadata = json.RawMessage(data)
+	datastore[id] = task
+	return task, true
 }
 
-func registerInKVStore() bool {
-	if len(os.Args) < 3 {
-		fmt.Println("Error: Too few arguments.")
-		return false
-	}
-	databaseAddress := os.Args[1] // The address of itself
-	keyValueStoreAddress := os.Args[2]
+// activateTask hands a pending task over to the workers, once its image is in the storage.
+func activateTask(w http.ResponseWriter, r *http.Request) error {
+	return transitionTask(w, r, statePending, stateNotStarted)
+}
 
-	response, err := http.Post("http://" + keyValueStoreAddress + "/set?key=databaseAddress&value=" + databaseAddress, "", nil)
-	if err != nil {
-		fmt.Println(err)
-		return false
-	}
-	data, err := ioutil.ReadAll(response.Body)
+// abortTask marks a pending task as failed, when the submission of its image failed.
+func abortTask(w http.ResponseWriter, r *http.Request) error {
+	return transitionTask(w, r, statePending, stateFailed)
+}
+
+func transitionTask(w http.ResponseWriter, r *http.Request, from int, to int) error {
+	id, err := taskId(r)
 	if err != nil {
-		fmt.Println(err)
-		return false
+		return err
 	}
-	if response.StatusCode != http.StatusOK {
-		fmt.Println("Error: Failure when contacting key-value store: ", string(data))
-		return false
-	}
-	return true
-}
 
+	_, ok := transition(id, from, to, r.URL.Query().Get("error"))
+	if !ok {
+		return errWrongState
+	}
 
+	fmt.Fprint(w, "success")
+	return nil
+}
 
+// transition moves the task from one state to the other, if it's in the first one. Failed tasks keep the error.
+func transition(id int64, from int, to int, errorMessage string) (Task, bool) {
+	datastoreMutex.Lock()
+	defer datastoreMutex.Unlock()
+	task, ok := datastore[id]
+	if !ok || task.State != from {
+		return Task{}, false
+	}
+	task.State = to
+	if to == stateFailed {
+		now := time.Now()
+		task.FinishedAt = &now
+		task.Error = errorMessage
+	}
+	datastore[id] = task
+	return task, true
+}
 
+func list(w http.ResponseWriter, r *http.Request) error {
+	datastoreMutex.RLock()
+	for key, value := range datastore {
+		fmt.Fprintln(w, key, ": ", "id:", value.Id, " state:", value.State)
+	}
+	datastoreMutex.RUnlock()
+	return nil
+}
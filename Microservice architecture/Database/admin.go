@@ -0,0 +1,193 @@
+package database
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"../service"
+)
+
+// Operations for the admin section of the Master, to look at the whole queue and to fix tasks by hand.
+
+const recentFailuresCount = 10
+
+type TaskStats struct {
+	Counts             map[int]int64 `json:"counts"` // Number of tasks by state.
+	FinishedLastMinute int64         `json:"finishedLastMinute"`
+	FinishedLastHour   int64         `json:"finishedLastHour"`
+	RecentFailures     []Task        `json:"recentFailures"` // Most recent first.
+}
+
+func getStats(w http.ResponseWriter, r *http.Request) error {
+	return service.WriteJSON(w, taskStats())
+}
+
+func taskStats() TaskStats {
+	stats := TaskStats{Counts: make(map[int]int64), RecentFailures: []Task{}}
+	now := time.Now()
+	datastoreMutex.RLock()
+	for _, task := range datastore {
+		stats.Counts[task.State]++
+		if task.State == stateFinished && task.FinishedAt != nil {
+			if now.Sub(*task.FinishedAt) <= time.Minute {
+				stats.FinishedLastMinute++
+			}
+			if now.Sub(*task.FinishedAt) <= time.Hour {
+				stats.FinishedLastHour++
+			}
+		}
+		if task.State == stateFailed {
+			stats.RecentFailures = append(stats.RecentFailures, task)
+		}
+	}
+	datastoreMutex.RUnlock()
+
+	sort.Slice(stats.RecentFailures, func(i, j int) bool {
+		return stats.RecentFailures[i].FinishedAt.After(*stats.RecentFailures[j].FinishedAt)
+	})
+	if len(stats.RecentFailures) > recentFailuresCount {
+		stats.RecentFailures = stats.RecentFailures[:recentFailuresCount]
+	}
+	return stats
+}
+
+func requeueTask(w http.ResponseWriter, r *http.Request) error {
+	id, err := taskId(r)
+	if err != nil {
+		return err
+	}
+
+	_, ok := requeue(id, stateInProgress, stateFailed)
+	if !ok {
+		return errWrongState
+	}
+
+	fmt.Fprint(w, "success")
+	return nil
+}
+
+func releaseTask(w http.ResponseWriter, r *http.Request) error {
+	id, err := taskId(r)
+	if err != nil {
+		return err
+	}
+
+	worker := r.URL.Query().Get("worker")
+	_, ok := release(id, worker)
+	if !ok {
+		return unchanged(id, worker)
+	}
+
+	fmt.Fprint(w, "success")
+	return nil
+}
+
+// requeue hands a task out to the workers again, if it's in one of the given states.
+func requeue(id int64, from ...int) (Task, bool) {
+	return requeueIf(id, func(task Task) bool {
+		allowed := false
+		for _, state := range from {
+			allowed = allowed || task.State == state
+		}
+		return allowed
+	})
+}
+
+// release hands a task in progress back, if the worker holds its claim.
+func release(id int64, worker string) (Task, bool) {
+	return requeueIf(id, func(task Task) bool {
+		return task.State == stateInProgress && holds(task, worker)
+	})
+}
+
+func requeueIf(id int64, allowed func(task Task) bool) (Task, bool) {
+	oNFTMutex.Lock()
+	defer oNFTMutex.Unlock()
+	datastoreMutex.Lock()
+	defer datastoreMutex.Unlock()
+	task, ok := datastore[id]
+	if !ok || !allowed(task) {
+		return Task{}, false
+	}
+	if task.State == stateFailed {
+		task.Attempts = 0
+	} else if task.Attempts > 0 {
+		// Handing a task back isn't a failed attempt.
+		task.Attempts--
+	}
+	task.State = stateNotStarted
+	task.Progress = 0
+	task.Error = ""
+	task.ErrorCode = ""
+	task.Worker = ""
+	task.StartedAt = nil
+	task.FinishedAt = nil
+	datastore[id] = task
+	if id < oldestNotFinishedTask {
+		oldestNotFinishedTask = id
+	}
+	return task, true
+}
+
+func cancelTask(w http.ResponseWriter, r *http.Request) error {
+	id, err := taskId(r)
+	if err != nil {
+		return err
+	}
+
+	_, ok := cancel(id, r.URL.Query().Get("error"))
+	if !ok {
+		return errWrongState
+	}
+
+	fmt.Fprint(w, "success")
+	return nil
+}
+
+// cancel marks a task which isn't finished yet as failed. A worker still processing it can't finish it anymore.
+func cancel(id int64, errorMessage string) (Task, bool) {
+	datastoreMutex.Lock()
+	defer datastoreMutex.Unlock()
+	task, ok := datastore[id]
+	if !ok || task.State == stateFinished || task.State == stateFailed {
+		return Task{}, false
+	}
+	if len(errorMessage) == 0 {
+		errorMessage = "Canceled"
+	}
+	now := time.Now()
+	task.State = stateFailed
+	task.FinishedAt = &now
+	task.Error = errorMessage
+	task.ErrorCode = "canceled"
+	datastore[id] = task
+	return task, true
+}
+
+func deleteTask(w http.ResponseWriter, r *http.Request) error {
+	id, err := taskId(r)
+	if err != nil {
+		return err
+	}
+
+	if !remove(id) {
+		return errWrongState
+	}
+
+	fmt.Fprint(w, "success")
+	return nil
+}
+
+// remove deletes a finished or failed task. Tasks still to be processed have to be canceled first.
+func remove(id int64) bool {
+	datastoreMutex.Lock()
+	defer datastoreMutex.Unlock()
+	task, ok := datastore[id]
+	if !ok || (task.State != stateFinished && task.State != stateFailed) {
+		return false
+	}
+	delete(datastore, id)
+	return true
+}
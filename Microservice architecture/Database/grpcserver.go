@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"../rpc"
+	"../service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// The gRPC interface of the tasks-store works on the same datastore as the HTTP one.
+
+type taskStoreServer struct {
+	rpc.UnimplementedTaskStoreServer
+}
+
+// changed returns the task, or why it couldn't be changed.
+func changed(task Task, ok bool, id int64) (*rpc.Task, error) {
+	return changedBy(task, ok, id, "")
+}
+
+// changedBy returns the task, or why the worker couldn't change it.
+func changedBy(task Task, ok bool, id int64, worker string) (*rpc.Task, error) {
+	if ok {
+		return service.TaskToProto(task), nil
+	}
+	if _, exists := lookupTask(id); !exists {
+		return nil, status.Errorf(codes.NotFound, "No task %d", id)
+	}
+	if unchanged(id, worker) == errNotHolder {
+		return nil, status.Errorf(codes.PermissionDenied, "Another worker holds the claim of task %d", id)
+	}
+	return nil, status.Errorf(codes.FailedPrecondition, "Task %d isn't in the right state", id)
+}
+
+func (taskStoreServer) NewTask(ctx context.Context, request *rpc.NewTaskRequest) (*rpc.Task, error) {
+	if len(request.Parameters) != 0 && !json.Valid(request.Parameters) {
+		return nil, status.Error(codes.InvalidArgument, "The parameters must be valid JSON")
+	}
+	return service.TaskToProto(createTask(request.Pending, request.Callback, request.Client, request.Operation, request.Parameters, request.Trace)), nil
+}
+
+func (taskStoreServer) GetTask(ctx context.Context, request *rpc.TaskId) (*rpc.Task, error) {
+	task, ok := lookupTask(request.Id)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "No task %d", request.Id)
+	}
+	return service.TaskToProto(task), nil
+}
+
+func (taskStoreServer) ClaimTask(ctx context.Context, request *rpc.ClaimTaskRequest) (*rpc.Task, error) {
+	if len(request.Worker) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "The worker is required")
+	}
+	task, ok := claimTask(request.Worker, request.Operations)
+	if !ok {
+		return nil, status.Error(codes.NotFound, "No non-started task.")
+	}
+	return service.TaskToProto(task), nil
+}
+
+func (taskStoreServer) FinishTask(ctx context.Context, request *rpc.TaskId) (*rpc.Task, error) {
+	task, ok := completeTask(request.Id, request.Worker)
+	return changedBy(task, ok, request.Id, request.Worker)
+}
+
+func (taskStoreServer) FailTask(ctx context.Context, request *rpc.FailTaskRequest) (*rpc.Task, error) {
+	if len(request.Code) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "The error code is required")
+	}
+	task, ok := fail(request.Id, request.Code, request.Message, request.Transient, request.Worker)
+	return changedBy(task, ok, request.Id, request.Worker)
+}
+
+func (taskStoreServer) ActivateTask(ctx context.Context, request *rpc.TaskId) (*rpc.Task, error) {
+	task, ok := transition(request.Id, statePending, stateNotStarted, "")
+	return changed(task, ok, request.Id)
+}
+
+func (taskStoreServer) AbortTask(ctx context.Context, request *rpc.AbortTaskRequest) (*rpc.Task, error) {
+	task, ok := transition(request.Id, statePending, stateFailed, request.Error)
+	return changed(task, ok, request.Id)
+}
+
+func (taskStoreServer) SetProgress(ctx context.Context, request *rpc.SetProgressRequest) (*rpc.Task, error) {
+	if request.Progress < 0 || request.Progress > 100 {
+		return nil, status.Error(codes.InvalidArgument, "Progress must be between 0 and 100")
+	}
+	task, ok := updateProgress(request.Id, int(request.Progress), request.Worker)
+	return changedBy(task, ok, request.Id, request.Worker)
+}
+
+func (taskStoreServer) SetMetadata(ctx context.Context, request *rpc.SetMetadataRequest) (*rpc.Task, error) {
+	if !json.Valid(request.Metadata) {
+		return nil, status.Error(codes.InvalidArgument, "Metadata must be valid JSON")
+	}
+	task, ok := storeMetadata(request.Id, request.Metadata)
+	return changed(task, ok, request.Id)
+}
+
+func (taskStoreServer) AddDelivery(ctx context.Context, request *rpc.AddDeliveryRequest) (*rpc.Task, error) {
+	if request.Delivery == nil {
+		return nil, status.Error(codes.InvalidArgument, "Delivery missing")
+	}
+	task, ok := appendDelivery(request.Id, service.DeliveryFromProto(request.Delivery))
+	return changed(task, ok, request.Id)
+}
+
+func (taskStoreServer) ListTasks(ctx context.Context, request *rpc.ListTasksRequest) (*rpc.TaskPage, error) {
+	state := -1
+	if request.State != nil {
+		state = int(*request.State)
+		if state < stateNotStarted || state > stateFailed {
+			return nil, status.Error(codes.InvalidArgument, "Unknown state")
+		}
+	}
+	since := time.Time{}
+	if request.Since != nil {
+		since = request.Since.AsTime()
+	}
+	after := int64(-1)
+	if request.After != nil {
+		after = *request.After
+		if after < 0 {
+			return nil, status.Error(codes.InvalidArgument, "After must be a task id")
+		}
+	}
+	limit := int(request.Limit)
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit < 0 || limit > maxPageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "The limit must be between 1 and %d", maxPageSize)
+	}
+
+	page := queryTasks(state, since, after, limit)
+	response := &rpc.TaskPage{Next: page.Next}
+	for _, task := range page.Tasks {
+		response.Tasks = append(response.Tasks, service.TaskToProto(task))
+	}
+	return response, nil
+}
+
+func (taskStoreServer) GetStats(ctx context.Context, request *emptypb.Empty) (*rpc.TaskStats, error) {
+	stats := taskStats()
+	response := &rpc.TaskStats{
+		Counts:             make(map[int32]int64),
+		FinishedLastMinute: stats.FinishedLastMinute,
+		FinishedLastHour:   stats.FinishedLastHour,
+	}
+	for state, count := range stats.Counts {
+		response.Counts[int32(state)] = count
+	}
+	for _, task := range stats.RecentFailures {
+		response.RecentFailures = append(response.RecentFailures, service.TaskToProto(task))
+	}
+	return response, nil
+}
+
+func (taskStoreServer) RequeueTask(ctx context.Context, request *rpc.TaskId) (*rpc.Task, error) {
+	task, ok := requeue(request.Id, stateInProgress, stateFailed)
+	return changed(task, ok, request.Id)
+}
+
+func (taskStoreServer) ReleaseTask(ctx context.Context, request *rpc.TaskId) (*rpc.Task, error) {
+	task, ok := release(request.Id, request.Worker)
+	return changedBy(task, ok, request.Id, request.Worker)
+}
+
+func (taskStoreServer) CancelTask(ctx context.Context, request *rpc.AbortTaskRequest) (*rpc.Task, error) {
+	task, ok := cancel(request.Id, request.Error)
+	return changed(task, ok, request.Id)
+}
+
+func (taskStoreServer) DeleteTask(ctx context.Context, request *rpc.TaskId) (*emptypb.Empty, error) {
+	if !remove(request.Id) {
+		_, err := changed(Task{}, false, request.Id)
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
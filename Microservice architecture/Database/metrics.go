@@ -0,0 +1,32 @@
+package database
+
+import (
+	"../metrics"
+)
+
+// The queue as Prometheus sees it, with the states named like the jobs of the Master.
+
+var stateNames = map[int]string{
+	stateNotStarted: "queued",
+	stateInProgress: "processing",
+	stateFinished:   "finished",
+	statePending:    "submitting",
+	stateFailed:     "failed",
+}
+
+var claimsExpired = metrics.NewCounter("tasks_claim_expirations_total", "Claims of workers which ran out before the task was finished, so that it was handed out again", "operation")
+
+func init() {
+	metrics.NewLabeledGaugeFunc("tasks", "Tasks in the store", "state", func() map[string]float64 {
+		counts := make(map[string]float64)
+		for _, name := range stateNames {
+			counts[name] = 0
+		}
+		datastoreMutex.RLock()
+		for _, task := range datastore {
+			counts[stateNames[task.State]]++
+		}
+		datastoreMutex.RUnlock()
+		return counts
+	})
+}
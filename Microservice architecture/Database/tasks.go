@@ -0,0 +1,214 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"../service"
+)
+
+const defaultPageSize = 50
+const maxPageSize = 500
+
+// TaskPage is one page of a task listing. Next is the "after" to pass for the following page, -1 on the last page.
+type TaskPage struct {
+	Tasks []Task `json:"tasks"`
+	Next  int64  `json:"next"`
+}
+
+// setProgress is called by the workers while they process a task.
+func setProgress(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+	id, err := service.Int(values, "id")
+	if err != nil {
+		return err
+	}
+	progress, err := strconv.Atoi(values.Get("progress"))
+	if err != nil || progress < 0 || progress > 100 {
+		return service.WrongInput("Progress must be between 0 and 100")
+	}
+
+	worker := values.Get("worker")
+	_, ok := updateProgress(id, progress, worker)
+	if !ok {
+		return unchanged(id, worker)
+	}
+
+	fmt.Fprint(w, "success")
+	return nil
+}
+
+func updateProgress(id int64, progress int, worker string) (Task, bool) {
+	datastoreMutex.Lock()
+	defer datastoreMutex.Unlock()
+	task, ok := datastore[id]
+	if !ok || task.State != stateInProgress || !holds(task, worker) {
+		return Task{}, false
+	}
+	task.Progress = progress
+	datastore[id] = task
+	return task, true
+}
+
+// maxAttempts is how often a task is claimed before a transient failure fails it for good.
+const maxAttempts = 3
+
+// failTask is called by the workers when they couldn't process a task.
+func failTask(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+	id, err := service.Int(values, "id")
+	if err != nil {
+		return err
+	}
+	code, err := service.Required(values, "code")
+	if err != nil {
+		return err
+	}
+
+	worker := values.Get("worker")
+	_, ok := fail(id, code, values.Get("message"), values.Get("transient") == "true", worker)
+	if !ok {
+		return unchanged(id, worker)
+	}
+
+	fmt.Fprint(w, "success")
+	return nil
+}
+
+// fail records the error of an in progress task. A transient one queues the task again, while it has attempts left.
+func fail(id int64, code string, message string, transient bool, worker string) (Task, bool) {
+	oNFTMutex.Lock()
+	defer oNFTMutex.Unlock()
+	datastoreMutex.Lock()
+	defer datastoreMutex.Unlock()
+	task, ok := datastore[id]
+	if !ok || task.State != stateInProgress || !holds(task, worker) {
+		return Task{}, false
+	}
+	task.Error = message
+	task.ErrorCode = code
+	task.Progress = 0
+	if transient && task.Attempts < maxAttempts {
+		task.State = stateNotStarted
+		task.StartedAt = nil
+		task.Worker = ""
+		if id < oldestNotFinishedTask {
+			oldestNotFinishedTask = id
+		}
+	} else {
+		now := time.Now()
+		task.State = stateFailed
+		task.FinishedAt = &now
+	}
+	datastore[id] = task
+	return task, true
+}
+
+// addDelivery records an attempt to deliver a webhook for the task.
+func addDelivery(w http.ResponseWriter, r *http.Request) error {
+	id, err := taskId(r)
+	if err != nil {
+		return err
+	}
+
+	delivery := Delivery{}
+	data, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(data, &delivery)
+	}
+	if err != nil {
+		return service.WrongInput(err.Error())
+	}
+
+	_, ok := appendDelivery(id, delivery)
+	if !ok {
+		return errWrongState
+	}
+
+	fmt.Fprint(w, "success")
+	return nil
+}
+
+func appendDelivery(id int64, delivery Delivery) (Task, bool) {
+	datastoreMutex.Lock()
+	defer datastoreMutex.Unlock()
+	task, ok := datastore[id]
+	if !ok {
+		return Task{}, false
+	}
+	task.Deliveries = append(task.Deliveries, delivery)
+	datastore[id] = task
+	return task, true
+}
+
+// listTasks returns the tasks as JSON, by ascending id. They can be filtered by state and by creation time (since,
+// RFC 3339). Pages are requested with limit and after, the id of the last task of the previous page.
+func listTasks(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+
+	state := -1
+	if len(values.Get("state")) != 0 {
+		state, err = strconv.Atoi(values.Get("state"))
+		if err != nil || state < stateNotStarted || state > stateFailed {
+			return service.WrongInput("Unknown state")
+		}
+	}
+	since := time.Time{}
+	if len(values.Get("since")) != 0 {
+		since, err = time.Parse(time.RFC3339, values.Get("since"))
+		if err != nil {
+			return service.WrongInput(err.Error())
+		}
+	}
+	after := int64(-1)
+	if len(values.Get("after")) != 0 {
+		after, err = strconv.ParseInt(values.Get("after"), 10, 64)
+		if err != nil || after < 0 {
+			return service.WrongInput("After must be a task id")
+		}
+	}
+	limit := defaultPageSize
+	if len(values.Get("limit")) != 0 {
+		limit, err = strconv.Atoi(values.Get("limit"))
+		if err != nil || limit <= 0 || limit > maxPageSize {
+			return service.WrongInput(fmt.Sprint("The limit must be between 1 and ", maxPageSize))
+		}
+	}
+
+	return service.WriteJSON(w, queryTasks(state, since, after, limit))
+}
+
+// queryTasks returns the tasks after the given id, in the given state (-1 for any) and created since the given time.
+func queryTasks(state int, since time.Time, after int64, limit int) TaskPage {
+	page := TaskPage{Tasks: []Task{}, Next: -1}
+	datastoreMutex.RLock()
+	defer datastoreMutex.RUnlock()
+	for i := after + 1; i < nextTaskId; i++ {
+		task, ok := datastore[i]
+		if !ok {
+			continue
+		}
+		if (state != -1 && task.State != state) || task.CreatedAt.Before(since) {
+			continue
+		}
+		if len(page.Tasks) == limit {
+			page.Next = page.Tasks[len(page.Tasks)-1].Id
+			break
+		}
+		page.Tasks = append(page.Tasks, task)
+	}
+	return page
+}
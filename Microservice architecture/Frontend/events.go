@@ -0,0 +1,178 @@
+package frontend
+
+import (
+	"context"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"../service"
+	"../tracing"
+	"github.com/gorilla/websocket"
+)
+
+// The job streams of Master are passed through, the ones of a user only to that user.
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+func clientUser(r *http.Request) string {
+	// There are no accounts, so the quota of a user is bound to the address they upload from.
+	user, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		user = r.RemoteAddr
+	}
+	return user
+}
+
+// handleJobStream serves /jobs/{id}/events and /jobs/{id}/ws.
+func handleJobStream(w http.ResponseWriter, r *http.Request) error {
+	path := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || len(parts[0]) == 0 {
+		return os.ErrNotExist
+	}
+	id := url.PathEscape(parts[0])
+
+	switch parts[1] {
+	case "events":
+		return proxyEvents(w, r, "/jobs/"+id+"/events")
+	case "ws":
+		return proxyWebSocket(w, r, "/jobs/"+id+"/ws")
+	}
+	return os.ErrNotExist
+}
+
+func handleUserEvents(w http.ResponseWriter, r *http.Request) error {
+	return proxyEvents(w, r, "/events?user="+url.QueryEscape(clientUser(r)))
+}
+
+func handleUserWebSocket(w http.ResponseWriter, r *http.Request) error {
+	return proxyWebSocket(w, r, "/ws?user="+url.QueryEscape(clientUser(r)))
+}
+
+// passError passes the error response of Master on to the client.
+func passError(w http.ResponseWriter, response *http.Response) {
+	data, _ := ioutil.ReadAll(response.Body)
+	w.Header().Set("Content-Type", response.Header.Get("Content-Type"))
+	w.WriteHeader(response.StatusCode)
+	w.Write(data)
+}
+
+// masterLocation returns the HTTP address of the leading Master, for the streams which are passed through.
+func masterLocation(ctx context.Context) (string, error) {
+	return config.Lookup(ctx, service.MasterKey)
+}
+
+func proxyEvents(w http.ResponseWriter, r *http.Request, path string) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return service.NewError(http.StatusBadRequest, "streaming_unsupported", "Streaming not supported")
+	}
+	location, err := masterLocation(r.Context())
+	if err != nil {
+		return err
+	}
+
+	// Tied to the request of the client, so that the stream from Master ends together with it, or when we stop.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	request, err := http.NewRequest(http.MethodGet, "http://"+location+path, nil)
+	if err != nil {
+		return err
+	}
+	tracing.Inject(ctx, request.Header.Set)
+	response, err := http.DefaultClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return service.NewError(http.StatusBadGateway, "unavailable", err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		passError(w, response)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	buffer := make([]byte, 4096)
+	for {
+		n, err := response.Body.Read(buffer)
+		if n > 0 {
+			if _, err := w.Write(buffer[:n]); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+func proxyWebSocket(w http.ResponseWriter, r *http.Request, path string) error {
+	location, err := masterLocation(r.Context())
+	if err != nil {
+		return err
+	}
+	masterConn, response, err := websocket.DefaultDialer.Dial("ws://"+location+path, nil)
+	if err != nil {
+		if response != nil {
+			passError(w, response)
+			return nil
+		}
+		return service.NewError(http.StatusBadGateway, "unavailable", err.Error())
+	}
+	defer masterConn.Close()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has responded already.
+		slog.DebugContext(r.Context(), "WebSocket upgrade failed", "err", err)
+		return nil
+	}
+	defer conn.Close()
+
+	// Closing either side ends both loops.
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				masterConn.Close()
+				return
+			}
+		}
+	}()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stopping:
+			masterConn.Close()
+		case <-done:
+		}
+	}()
+	for {
+		messageType, data, err := masterConn.ReadMessage()
+		if err != nil {
+			return nil
+		}
+		if conn.WriteMessage(messageType, data) != nil {
+			return nil
+		}
+	}
+}
@@ -1,161 +1,209 @@
-package main
+package frontend
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"net/url"
-	"os"
+
+	"../rpc"
+	"../service"
 )
 
-const indexPage = "<html><head><title>Upload file</title></head><body><form enctype=\"multipart/form-data\" action=\"submitTask\" method=\"post\"> <input type=\"file\" name=\"uploadfile\" /> <input type=\"submit\" value=\"upload\" /> </form> </body> </html>"
+// Without JavaScript the form just shows the id of the job. With it, the page follows the job until it's done.
+const indexPage = `<html><head><title>Upload file</title></head><body>
+<form id="upload" enctype="multipart/form-data" action="submitTask" method="post"> <input type="file" name="uploadfile" /> <label><input type="checkbox" name="stripLocation" /> Remove location data</label> <input type="submit" value="upload" /> </form>
+<p id="status"></p>
+<script>
+var form = document.getElementById("upload");
+var statusLine = document.getElementById("status");
+form.onsubmit = function(e) {
+	e.preventDefault();
+	statusLine.textContent = "Uploading...";
+	fetch("submitTask", {method: "POST", body: new FormData(form)}).then(function(response) {
+		return response.text().then(function(text) {
+			if (!response.ok) {
+				try {
+					statusLine.textContent = JSON.parse(text).message;
+				} catch (err) {
+					statusLine.textContent = text;
+				}
+				return;
+			}
+			follow(text);
+		});
+	}).catch(function(err) {
+		statusLine.textContent = "Upload failed: " + err;
+	});
+};
+function follow(id) {
+	var events = new EventSource("jobs/" + id + "/events");
+	var show = function(e) {
+		var job = JSON.parse(e.data);
+		statusLine.textContent = "Image " + id + ": " + job.state + ", " + job.progress + "%";
+		if (job.state == "queued" && job.error) {
+			statusLine.textContent = "Image " + id + ": trying again after an error: " + job.error;
+		}
+		if (job.state == "finished") {
+			events.close();
+			statusLine.innerHTML = "Your image is ready: <a href=\"getImage?id=" + id + "\">download</a>";
+		} else if (job.state == "failed") {
+			events.close();
+			statusLine.textContent = "Processing your image failed: " + (job.error || "unknown error");
+		}
+	};
+	events.addEventListener("state", show);
+	events.addEventListener("progress", show);
+}
+</script>
+</body></html>`
 
-var keyValueStoreAddress string
-var masterLocation string
+var config *service.ConfigStore
+var master rpc.MasterClient
+var stopping <-chan struct{}
 
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Error: Too few arguments.")
-		return
-	}
-	keyValueStoreAddress = os.Args[1]
+var formMemory = service.BytesFlag("form-memory", 10000000, "Bytes of an upload held in memory, the rest goes to a temporary file")
 
-	response, err := http.Get("http://" + keyValueStoreAddress + "/get?key=masterAddress")
-	if response.StatusCode != http.StatusOK {
-		fmt.Println("Error: can't get master address.")
-		fmt.Println(response.Body)
-		return
+// Main runs the frontend. The args are the address of the config store and optionally its own, :80 by default.
+func Main(args []string) {
+	address := ":80"
+	if len(args) > 1 {
+		address = args[1]
 	}
-	data, err := ioutil.ReadAll(response.Body)
+	myService := service.New("frontend", address, args[0])
+	config = myService.Config
+	stopping = myService.Stopping()
+
+	var err error
+	master, err = config.Master(context.Background())
 	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	masterLocation = string(data)
-	if len(masterLocation) == 0 {
-		fmt.Println("Error: can't get master address. Length is zero.")
-		return
+		service.Fatal(err)
 	}
 
-	http.HandleFunc("/", handleIndex)
-	http.HandleFunc("/submitTask", handleTask)
-	http.HandleFunc("/isReady", handleCheckForReadiness)
-	http.HandleFunc("/getImage", serveImage)
-	http.ListenAndServe(":80", nil)
+	myService.Handle("/", service.Methods{http.MethodGet: handleIndex})
+	myService.Handle("/submitTask", service.Methods{http.MethodPost: handleTask})
+	myService.Handle("/isReady", service.Methods{http.MethodGet: handleCheckForReadiness})
+	myService.Handle("/getImage", service.Methods{http.MethodGet: serveImage})
+	myService.Handle("/jobs/", service.Methods{http.MethodGet: handleJobStream})
+	myService.Handle("/events", service.Methods{http.MethodGet: handleUserEvents})
+	myService.Handle("/ws", service.Methods{http.MethodGet: handleUserWebSocket})
+	err = myService.Run()
+	if err != nil {
+		service.Fatal(err)
+	}
 }
 
-func handleIndex(w http.ResponseWriter, r *http.Request) {
+func handleIndex(w http.ResponseWriter, r *http.Request) error {
 	fmt.Fprint(w, indexPage)
+	return nil
 }
 
-func handleTask(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		err := r.ParseMultipartForm(10000000)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Wrong input")
-			return
-		}
-		file, _, err := r.FormFile("uploadfile")
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Wrong input")
-			return
-		}
+func handleTask(w http.ResponseWriter, r *http.Request) error {
+	err := r.ParseMultipartForm(formMemory.Get())
+	if err != nil {
+		return service.WrongInput("Wrong input")
+	}
+	file, _, err := r.FormFile("uploadfile")
+	if err != nil {
+		return service.WrongInput("Wrong input")
+	}
 
-		response, err := http.Post("http://"+masterLocation+"/new", "image", file)
-		file.Close()
-		if err != nil || response.StatusCode != http.StatusOK {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
+	exifPolicy := "keep"
+	if len(r.FormValue("stripLocation")) != 0 {
+		exifPolicy = "nogps"
+	}
 
-		data, err := ioutil.ReadAll(response.Body)
-		response.Body.Close()
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
+	image, err := ioutil.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return service.NewError(http.StatusBadRequest, "invalid_body", err.Error())
+	}
 
-		fmt.Fprint(w, string(data))
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only POST accepted")
+	myTask, err := submitImage(r.Context(), &rpc.SubmitHeader{ExifPolicy: exifPolicy, User: clientUser(r)}, image)
+	if err != nil {
+		return err
 	}
+	fmt.Fprint(w, myTask.Id)
+	return nil
 }
 
-func handleCheckForReadiness(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		values, err := url.ParseQuery(r.URL.RawQuery)
-		if err != nil {
-			fmt.Fprint(w, err)
-			return
-		}
-		if len(values.Get("id")) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Wrong input")
-			return
+// submitImage streams the image to Master, which returns the new task.
+func submitImage(ctx context.Context, header *rpc.SubmitHeader, image []byte) (*rpc.Task, error) {
+	stream, err := master.SubmitImage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = stream.Send(&rpc.SubmitImageRequest{Part: &rpc.SubmitImageRequest_Header{Header: header}})
+	for len(image) > 0 && err == nil {
+		size := rpc.ChunkSize
+		if len(image) < size {
+			size = len(image)
 		}
+		err = stream.Send(&rpc.SubmitImageRequest{Part: &rpc.SubmitImageRequest_Chunk{Chunk: image[:size]}})
+		image = image[size:]
+	}
+	// A failed Send only tells that the stream broke, the reason comes with CloseAndRecv.
+	return stream.CloseAndRecv()
+}
 
-		response, err := http.Get("http://" + masterLocation + "/isReady?id=" + values.Get("id") + "&state=finished")
-		if err != nil || response.StatusCode != http.StatusOK {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
+func requestedTask(r *http.Request) (*rpc.TaskId, error) {
+	values, err := service.Query(r)
+	if err != nil {
+		return nil, err
+	}
+	id, err := service.Int(values, "id")
+	if err != nil {
+		return nil, err
+	}
+	return &rpc.TaskId{Id: id}, nil
+}
 
-		data, err := ioutil.ReadAll(response.Body)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
+func handleCheckForReadiness(w http.ResponseWriter, r *http.Request) error {
+	id, err := requestedTask(r)
+	if err != nil {
+		return err
+	}
 
-		switch string(data) {
-		case "0":
-			fmt.Fprint(w, "Your image is not ready yet.")
-		case "1":
-			fmt.Fprint(w, "Your image is ready.")
-		default:
-			fmt.Fprint(w, "Internal server error.")
-		}
+	myTask, err := master.GetTask(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	if myTask.State == rpc.TaskState_TASK_STATE_FINISHED {
+		fmt.Fprint(w, "Your image is ready.")
+	} else if myTask.State == rpc.TaskState_TASK_STATE_FAILED {
+		fmt.Fprint(w, "Processing your image failed: ", myTask.Error)
 	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only GET accepted")
+		fmt.Fprint(w, "Your image is not ready yet.")
 	}
+	return nil
 }
 
-func serveImage(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		values, err := url.ParseQuery(r.URL.RawQuery)
-		if err != nil {
-			fmt.Fprint(w, err)
-			return
-		}
-		if len(values.Get("id")) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Wrong input")
-			return
-		}
+func serveImage(w http.ResponseWriter, r *http.Request) error {
+	id, err := requestedTask(r)
+	if err != nil {
+		return err
+	}
 
-		response, err := http.Get("http://" + masterLocation + "/get?id=" + values.Get("id") + "&state=finished")
-		if err != nil || response.StatusCode != http.StatusOK {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
+	stream, err := master.GetImage(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	image := bytes.Buffer{}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
 		}
-
-		_, err = io.Copy(w, response.Body)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
+			return err
 		}
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only GET accepted")
+		image.Write(chunk.Data)
 	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(image.Bytes()))
+	w.Write(image.Bytes())
+	return nil
 }
@@ -0,0 +1,291 @@
+package master
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"../rpc"
+	"../service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// The admin section shows the whole system, as JSON on /admin/overview and as a page on /admin, and lets an
+// operator requeue, cancel or purge a job:
+//
+//	POST /admin/requeue?id=7   hands a job stuck in progress, or a failed one, out to the workers again
+//	POST /admin/cancel?id=7    fails a job which isn't finished
+//	POST /admin/purge?id=7     deletes a finished or failed job together with its images
+
+// How long the overview waits for the other services, a dead one mustn't hold up the page.
+const overviewTimeout = time.Second * 3
+
+type AdminOverview struct {
+	Queue          map[string]int64 `json:"queue"` // Number of jobs by state.
+	Throughput     Throughput       `json:"throughput"`
+	Workers        []workerStatus   `json:"workers"`
+	Storage        []ReplicaUsage   `json:"storage"`
+	Services       []ServiceStatus  `json:"services"`
+	RecentFailures []Job            `json:"recentFailures"`
+}
+
+// Throughput counts the jobs finished lately.
+type Throughput struct {
+	LastMinute int64 `json:"lastMinute"`
+	LastHour   int64 `json:"lastHour"`
+}
+
+type ReplicaUsage struct {
+	Address        string `json:"address"`
+	Error          string `json:"error,omitempty"`
+	StagedImages   int64  `json:"stagedImages"`
+	StagedBytes    int64  `json:"stagedBytes"`
+	WorkingImages  int64  `json:"workingImages"`
+	WorkingBytes   int64  `json:"workingBytes"`
+	FinishedImages int64  `json:"finishedImages"`
+	FinishedBytes  int64  `json:"finishedBytes"`
+	MaxBytes       int64  `json:"maxBytes,omitempty"`
+}
+
+type ServiceStatus struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Up      bool   `json:"up"`
+	Error   string `json:"error,omitempty"`
+}
+
+func getOverview(ctx context.Context) AdminOverview {
+	ctx, cancel := context.WithTimeout(ctx, overviewTimeout)
+	defer cancel()
+	overview := AdminOverview{
+		Queue:          make(map[string]int64),
+		Workers:        []workerStatus{},
+		Storage:        []ReplicaUsage{},
+		RecentFailures: []Job{},
+	}
+	for _, name := range stateNames {
+		overview.Queue[name] = 0
+	}
+
+	overview.Services = append(overview.Services, ServiceStatus{Name: "config-store", Address: config.Address(), Up: true})
+	overview.Services = append(overview.Services, ServiceStatus{Name: "master", Address: selfAddress, Up: true})
+
+	taskStoreStatus := ServiceStatus{Name: "tasks-store", Up: true}
+	taskStoreStatus.Address, _ = config.Get(ctx, service.TaskStoreKey)
+	stats, err := taskStore.GetStats(ctx, &emptypb.Empty{})
+	if err != nil {
+		taskStoreStatus.Up = false
+		taskStoreStatus.Error = err.Error()
+	} else {
+		for state, count := range stats.Counts {
+			overview.Queue[stateNames[rpc.TaskState(state)]] = count
+		}
+		overview.Throughput = Throughput{LastMinute: stats.FinishedLastMinute, LastHour: stats.FinishedLastHour}
+		for _, task := range stats.RecentFailures {
+			overview.RecentFailures = append(overview.RecentFailures, jobFromTask(task))
+		}
+	}
+	overview.Services = append(overview.Services, taskStoreStatus)
+
+	addresses, _ := config.Get(ctx, service.ImageStoreKey)
+	for _, address := range strings.Split(addresses, ",") {
+		if len(address) == 0 {
+			continue
+		}
+		usage := replicaUsage(ctx, address)
+		overview.Storage = append(overview.Storage, usage)
+		overview.Services = append(overview.Services, ServiceStatus{Name: "images-store", Address: address, Up: len(usage.Error) == 0, Error: usage.Error})
+	}
+
+	workersMutex.Lock()
+	for _, worker := range workers {
+		worker.expireAssignments()
+		overview.Workers = append(overview.Workers, workerStatus{registeredWorker: worker, InFlightCount: len(worker.InFlight)})
+	}
+	workersMutex.Unlock()
+	return overview
+}
+
+// replicaUsage asks a single replica, rather than whichever answers first.
+func replicaUsage(ctx context.Context, address string) ReplicaUsage {
+	result := ReplicaUsage{Address: address}
+	conn, err := rpc.Dial(address)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer conn.Close()
+	usage, err := rpc.NewImageStoreClient(conn).GetUsage(ctx, &emptypb.Empty{})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.StagedImages, result.StagedBytes = usage.StagedImages, usage.StagedBytes
+	result.WorkingImages, result.WorkingBytes = usage.WorkingImages, usage.WorkingBytes
+	result.FinishedImages, result.FinishedBytes = usage.FinishedImages, usage.FinishedBytes
+	result.MaxBytes = usage.MaxBytes
+	return result
+}
+
+func serveOverview(w http.ResponseWriter, r *http.Request) error {
+	return service.WriteJSON(w, getOverview(r.Context()))
+}
+
+func serveDashboard(w http.ResponseWriter, r *http.Request) error {
+	page := struct {
+		AdminOverview
+		States []string
+		Time   time.Time
+	}{AdminOverview: getOverview(r.Context()), Time: time.Now()}
+	for state := rpc.TaskState_TASK_STATE_NOT_STARTED; state <= rpc.TaskState_TASK_STATE_FAILED; state++ {
+		page.States = append(page.States, stateNames[state])
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return dashboardTemplate.Execute(w, page)
+}
+
+// adminTaskId reads the id from the query, or from the form of the dashboard.
+func adminTaskId(r *http.Request) (int64, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return 0, service.WrongInput(err.Error())
+	}
+	return service.Int(r.Form, "id")
+}
+
+// respondToAction sends the dashboard back to itself, and API clients the job.
+func respondToAction(w http.ResponseWriter, r *http.Request, job *Job) error {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return nil
+	}
+	if job == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return service.WriteJSON(w, job)
+}
+
+func requeueJob(w http.ResponseWriter, r *http.Request) error {
+	id, err := adminTaskId(r)
+	if err != nil {
+		return err
+	}
+	myTask, err := taskStore.GetTask(r.Context(), &rpc.TaskId{Id: id})
+	if err != nil {
+		return err
+	}
+	if myTask.State == rpc.TaskState_TASK_STATE_FAILED {
+		// A failed submission leaves no image behind, the workers would fail on it.
+		err = imageStores.Call(func(store rpc.ImageStoreClient) error {
+			_, err := store.GetMetadata(r.Context(), &rpc.ImageRef{State: rpc.ImageState_IMAGE_STATE_WORKING, Id: id})
+			return err
+		})
+		if status.Code(err) == codes.NotFound {
+			return service.NewError(http.StatusConflict, "image_missing", fmt.Sprint("Job ", id, " has no image to process"))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	myTask, err = taskStore.RequeueTask(r.Context(), &rpc.TaskId{Id: id})
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(r.Context(), "Job requeued by an admin", "job", id)
+	taskFinished(id)
+	publishJob(id, "state")
+	job := jobFromTask(myTask)
+	return respondToAction(w, r, &job)
+}
+
+func cancelJob(w http.ResponseWriter, r *http.Request) error {
+	id, err := adminTaskId(r)
+	if err != nil {
+		return err
+	}
+	myTask, err := taskStore.CancelTask(r.Context(), &rpc.AbortTaskRequest{Id: id, Error: "Canceled by an admin"})
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(r.Context(), "Job canceled by an admin", "job", id)
+	taskFinished(id)
+	publishJob(id, "state")
+	go deliverWebhook(id, "job.failed")
+	job := jobFromTask(myTask)
+	return respondToAction(w, r, &job)
+}
+
+func purgeJob(w http.ResponseWriter, r *http.Request) error {
+	id, err := adminTaskId(r)
+	if err != nil {
+		return err
+	}
+	_, err = taskStore.DeleteTask(r.Context(), &rpc.TaskId{Id: id})
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(r.Context(), "Job purged by an admin", "job", id)
+	// Images left behind would be removed by the garbage collector of the images-store, as orphans.
+	deleteFromStorage(r.Context(), &rpc.ImageRef{State: rpc.ImageState_IMAGE_STATE_WORKING, Id: id})
+	deleteFromStorage(r.Context(), &rpc.ImageRef{State: rpc.ImageState_IMAGE_STATE_FINISHED, Id: id})
+	return respondToAction(w, r, nil)
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"megabytes": func(bytes int64) string {
+		return fmt.Sprintf("%.1f MB", float64(bytes)/1000000)
+	},
+	"time": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05")
+	},
+}).Parse(`<html><head><title>Admin</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+.down { color: #b00; }
+</style></head><body>
+<h1>Admin</h1>
+<p>As of {{time .Time}}. The same as JSON: <a href="/admin/overview">/admin/overview</a></p>
+
+<h2>Queue</h2>
+<table><tr>{{range .States}}<th>{{.}}</th>{{end}}</tr>
+<tr>{{range .States}}<td>{{index $.Queue .}}</td>{{end}}</tr></table>
+<p>Finished in the last minute: {{.Throughput.LastMinute}}, in the last hour: {{.Throughput.LastHour}}</p>
+
+<h2>Workers</h2>
+{{if .Workers}}<table><tr><th>Id</th><th>Name</th><th>Address</th><th>Operations</th><th>Load</th><th>Connected</th></tr>
+{{range .Workers}}<tr><td>{{.Id}}{{if .WorkerId}} ({{.WorkerId}}){{end}}</td><td>{{.Name}}</td><td>{{.Address}}</td><td>{{range .Operations}}{{.}} {{end}}</td><td>{{.InFlightCount}} / {{.Capacity}}</td><td>{{time .Connected}}</td></tr>
+{{end}}</table>{{else}}<p>No worker is registered. Polling workers don't show up here.</p>{{end}}
+
+<h2>Storage</h2>
+<table><tr><th>Replica</th><th>Staged</th><th>Working</th><th>Finished</th><th>Limit</th></tr>
+{{range .Storage}}<tr><td>{{.Address}}</td>{{if .Error}}<td colspan="4" class="down">{{.Error}}</td>{{else}}<td>{{.StagedImages}} ({{megabytes .StagedBytes}})</td><td>{{.WorkingImages}} ({{megabytes .WorkingBytes}})</td><td>{{.FinishedImages}} ({{megabytes .FinishedBytes}})</td><td>{{if .MaxBytes}}{{megabytes .MaxBytes}}{{else}}none{{end}}</td>{{end}}</tr>
+{{end}}</table>
+
+<h2>Services</h2>
+<table><tr><th>Service</th><th>Address</th><th>Status</th></tr>
+{{range .Services}}<tr><td>{{.Name}}</td><td>{{.Address}}</td>{{if .Up}}<td>up</td>{{else}}<td class="down">down: {{.Error}}</td>{{end}}</tr>
+{{end}}</table>
+
+<h2>Recent failures</h2>
+{{if .RecentFailures}}<table><tr><th>Job</th><th>Failed at</th><th>Error</th><th>Attempts</th><th></th></tr>
+{{range .RecentFailures}}<tr><td><a href="/jobs/{{.Id}}">{{.Id}}</a></td><td>{{if .FinishedAt}}{{time .FinishedAt}}{{end}}</td><td>{{if .ErrorCode}}{{.ErrorCode}}: {{end}}{{.Error}}</td><td>{{.Attempts}}</td>
+<td><form method="post" action="/admin/requeue" style="display:inline"><input type="hidden" name="id" value="{{.Id}}"><input type="submit" value="requeue"></form>
+<form method="post" action="/admin/purge" style="display:inline"><input type="hidden" name="id" value="{{.Id}}"><input type="submit" value="purge"></form></td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+
+<h2>Job actions</h2>
+<form method="post"><input type="text" name="id" placeholder="job id">
+<input type="submit" value="requeue" formaction="/admin/requeue">
+<input type="submit" value="cancel" formaction="/admin/cancel">
+<input type="submit" value="purge" formaction="/admin/purge"></form>
+</body></html>`))
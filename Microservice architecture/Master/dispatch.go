@@ -0,0 +1,265 @@
+package master
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"../rpc"
+	"../service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Besides polling /getNewTask, workers may register with /registerWorker and keep the connection open.
+// The Master then claims tasks from the tasks-store itself and pushes them down the connection,
+// one JSON task per line, always to the least loaded worker with a task of its operations in the queue.
+// The ReceiveTasks stream of the gRPC interface works the same way.
+// The tasks are claimed in the name of the worker they're pushed to. When a worker disconnects, the tasks it hadn't
+// finished are released, and so pushed to the other workers.
+
+const heartbeatInterval = time.Second * 10
+
+type registeredWorker struct {
+	Id         int                 `json:"id"`
+	WorkerId   string              `json:"workerId,omitempty"` // From the handshake.
+	Name       string              `json:"name"`
+	Address    string              `json:"address"`
+	Capacity   int                 `json:"capacity"`
+	Operations []string            `json:"operations"`
+	InFlight   map[int64]time.Time `json:"-"` // Task id -> time of the assignment.
+	Connected  time.Time           `json:"connected"`
+
+	tasks chan *rpc.Task
+}
+
+type workerStatus struct {
+	*registeredWorker
+	InFlightCount int `json:"inFlight"`
+}
+
+var workers = make(map[int]*registeredWorker)
+var nextWorkerId int
+var workersMutex sync.Mutex
+
+var wakeDispatcher = make(chan struct{}, 1)
+
+// notifyDispatcher makes the dispatcher look for work right away instead of at its next poll.
+func notifyDispatcher() {
+	select {
+	case wakeDispatcher <- struct{}{}:
+	default:
+	}
+}
+
+// expireAssignments forgets the tasks the tasks-store has given up on. Must be called with the workersMutex held.
+func (worker *registeredWorker) expireAssignments() {
+	for id, assigned := range worker.InFlight {
+		if time.Since(assigned) > service.ClaimTimeout.Get() {
+			delete(worker.InFlight, id)
+			assignmentsExpired.Inc()
+		}
+	}
+}
+
+// freeWorkers returns the workers which aren't busy, the lowest share of their capacity in use first.
+func freeWorkers() []*registeredWorker {
+	workersMutex.Lock()
+	defer workersMutex.Unlock()
+	free := []*registeredWorker{}
+	for _, worker := range workers {
+		worker.expireAssignments()
+		if len(worker.InFlight) < worker.Capacity {
+			free = append(free, worker)
+		}
+	}
+	sort.Slice(free, func(i, j int) bool {
+		return len(free[i].InFlight)*free[j].Capacity < len(free[j].InFlight)*free[i].Capacity
+	})
+	return free
+}
+
+// assignTask pushes the task to the worker. It returns false if the worker went away or is busy by now.
+func assignTask(worker *registeredWorker, task *rpc.Task) bool {
+	workersMutex.Lock()
+	defer workersMutex.Unlock()
+	if workers[worker.Id] != worker || len(worker.InFlight) >= worker.Capacity {
+		return false
+	}
+	worker.InFlight[task.Id] = time.Now()
+	worker.tasks <- task // Never blocks, the channel has room for the whole capacity.
+	return true
+}
+
+// claimTask takes the next not started task of the operations of the worker from the tasks-store, for the worker.
+// It returns false if there is none.
+func claimTask(worker *registeredWorker) (*rpc.Task, bool, error) {
+	myTask, err := taskStore.ClaimTask(context.Background(), &rpc.ClaimTaskRequest{Worker: worker.WorkerId, Operations: worker.Operations})
+	if status.Code(err) == codes.NotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return myTask, true, nil
+}
+
+func startDispatcher() {
+	for {
+		if !dispatchTask() {
+			waitForWork()
+		}
+	}
+}
+
+// dispatchTask pushes a task to the least loaded worker which has one in the queue. It returns false if none has.
+func dispatchTask() bool {
+	for _, worker := range freeWorkers() {
+		task, ok, err := claimTask(worker)
+		if err != nil {
+			slog.Warn("Claiming a task to push failed", "worker", worker.Id, "err", err)
+		}
+		if !ok {
+			continue
+		}
+		publishJob(task.Id, "state")
+
+		if !assignTask(worker, task) {
+			// The worker went away in the meantime.
+			releaseClaim(worker, task.Id)
+		}
+		return true
+	}
+	return false
+}
+
+func waitForWork() {
+	select {
+	case <-wakeDispatcher:
+	case <-time.After(time.Second * 2):
+	}
+}
+
+// taskFinished stops counting the task against the worker it was pushed to.
+func taskFinished(id int64) {
+	workersMutex.Lock()
+	for _, worker := range workers {
+		delete(worker.InFlight, id)
+	}
+	workersMutex.Unlock()
+	notifyDispatcher()
+}
+
+func registerWorker(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+	capacity, err := strconv.Atoi(values.Get("capacity"))
+	if err != nil || capacity <= 0 || len(values.Get("operations")) == 0 {
+		return service.WrongInput("Wrong input")
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return service.NewError(http.StatusBadRequest, "streaming_unsupported", "Streaming not supported")
+	}
+
+	worker := addWorker(workerOf(r.Context()), values.Get("name"), r.RemoteAddr, capacity, strings.Split(values.Get("operations"), ","))
+	defer unregisterWorker(worker)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case task := <-worker.tasks:
+			err = encoder.Encode(service.TaskFromProto(task))
+		case <-heartbeat.C:
+			// An empty line, so that both sides notice a dead connection.
+			_, err = fmt.Fprint(w, "\n")
+		case <-r.Context().Done():
+			return nil
+		case <-stopping:
+			return nil
+		}
+		if err != nil {
+			return nil
+		}
+		flusher.Flush()
+	}
+}
+
+func addWorker(workerId string, name string, address string, capacity int, operations []string) *registeredWorker {
+	workersMutex.Lock()
+	worker := &registeredWorker{
+		Id:         nextWorkerId,
+		WorkerId:   workerId,
+		Name:       name,
+		Address:    address,
+		Capacity:   capacity,
+		Operations: operations,
+		InFlight:   make(map[int64]time.Time),
+		Connected:  time.Now(),
+		tasks:      make(chan *rpc.Task, capacity),
+	}
+	nextWorkerId++
+	workers[worker.Id] = worker
+	workersMutex.Unlock()
+	slog.Info("Worker registered", "worker", worker.Id, "name", worker.Name, "address", worker.Address, "capacity", capacity)
+	notifyDispatcher()
+	return worker
+}
+
+// unregisterWorker removes the worker and releases its unfinished tasks, so that they're pushed to the others.
+func unregisterWorker(worker *registeredWorker) {
+	workersMutex.Lock()
+	delete(workers, worker.Id)
+	worker.expireAssignments()
+	unfinished := []int64{}
+	for id := range worker.InFlight {
+		unfinished = append(unfinished, id)
+	}
+	workersMutex.Unlock()
+	slog.Info("Worker disconnected", "worker", worker.Id, "name", worker.Name, "unfinished", len(unfinished))
+	for _, id := range unfinished {
+		releaseClaim(worker, id)
+	}
+	notifyDispatcher()
+}
+
+// releaseClaim hands a task claimed for the worker back to the queue.
+func releaseClaim(worker *registeredWorker, id int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := taskStore.ReleaseTask(ctx, &rpc.TaskId{Id: id, Worker: worker.WorkerId})
+	if err != nil {
+		slog.Warn("Couldn't release a task", "job", id, "worker", worker.Id, "err", err)
+		return
+	}
+	publishJob(id, "state")
+}
+
+func listWorkers(w http.ResponseWriter, r *http.Request) error {
+	workersMutex.Lock()
+	defer workersMutex.Unlock()
+	result := []workerStatus{}
+	for _, worker := range workers {
+		worker.expireAssignments()
+		result = append(result, workerStatus{registeredWorker: worker, InFlightCount: len(worker.InFlight)})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return service.WriteJSON(w, result)
+}
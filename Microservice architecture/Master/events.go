@@ -0,0 +1,236 @@
+package master
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"../rpc"
+	"../service"
+	"github.com/gorilla/websocket"
+)
+
+// Clients can follow jobs instead of polling them. Each state transition and progress report is published
+// to the subscribers of the job and of its user, as Server-Sent Events or over a WebSocket:
+//
+//	/jobs/0/events   /events?user=...   Server-Sent Events
+//	/jobs/0/ws       /ws?user=...       WebSocket
+//
+// Every event carries the whole job, as in /jobs/0. Streams of a single job end once it's finished or failed.
+
+const eventsKeepAlive = time.Second * 15
+
+type JobEvent struct {
+	Event string `json:"event"` // "state" or "progress"
+	Job   Job    `json:"job"`
+}
+
+type subscriber struct {
+	jobId  int64 // -1 for all the jobs of the user
+	user   string
+	events chan JobEvent
+}
+
+var subscribers = make(map[*subscriber]bool)
+var subscribersMutex sync.Mutex
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+func subscribe(jobId int64, user string) *subscriber {
+	mySubscriber := &subscriber{jobId: jobId, user: user, events: make(chan JobEvent, 16)}
+	subscribersMutex.Lock()
+	subscribers[mySubscriber] = true
+	subscribersMutex.Unlock()
+	return mySubscriber
+}
+
+func unsubscribe(mySubscriber *subscriber) {
+	subscribersMutex.Lock()
+	delete(subscribers, mySubscriber)
+	subscribersMutex.Unlock()
+}
+
+func hasSubscribers() bool {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	return len(subscribers) != 0
+}
+
+// publishJob sends the current state of the job to its subscribers. It's called right after every change,
+// so that the events of a job arrive in order.
+func publishJob(id int64, event string) {
+	if !hasSubscribers() {
+		return
+	}
+	myTask, err := getTask(context.Background(), strconv.FormatInt(id, 10))
+	if err != nil {
+		slog.Warn("Publishing a job failed", "job", id, "err", err)
+		return
+	}
+	owner := service.ImageMetadata{}
+	json.Unmarshal(myTask.Metadata, &owner)
+
+	jobEvent := JobEvent{Event: event, Job: jobFromTask(myTask)}
+	subscribersMutex.Lock()
+	for mySubscriber := range subscribers {
+		if mySubscriber.jobId != myTask.Id && (mySubscriber.jobId != -1 || mySubscriber.user != owner.User) {
+			continue
+		}
+		select {
+		case mySubscriber.events <- jobEvent:
+		default:
+			// The client doesn't keep up, it can still get the current state from /jobs.
+		}
+	}
+	subscribersMutex.Unlock()
+}
+
+func isFinal(job Job) bool {
+	return job.State == stateNames[rpc.TaskState_TASK_STATE_FINISHED] || job.State == stateNames[rpc.TaskState_TASK_STATE_FAILED]
+}
+
+// openStream subscribes to the job of the path, or the user of the query, and returns the state the job is in now.
+func openStream(r *http.Request, jobId string) (*subscriber, *Job, error) {
+	if len(jobId) == 0 {
+		user, err := service.Required(r.URL.Query(), "user")
+		if err != nil {
+			return nil, nil, err
+		}
+		return subscribe(-1, user), nil, nil
+	}
+
+	// Subscribe before looking up the job, so that no change can slip through in between.
+	id, _ := strconv.ParseInt(jobId, 10, 64)
+	mySubscriber := subscribe(id, "")
+	myTask, err := getTask(r.Context(), jobId)
+	if err != nil {
+		unsubscribe(mySubscriber)
+		return nil, nil, err
+	}
+	job := jobFromTask(myTask)
+	return mySubscriber, &job, nil
+}
+
+// serveEvents streams the events of a job, or of all the jobs of a user if jobId is empty, as Server-Sent Events.
+func serveEvents(w http.ResponseWriter, r *http.Request, jobId string) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return service.NewError(http.StatusBadRequest, "streaming_unsupported", "Streaming not supported")
+	}
+	mySubscriber, current, err := openStream(r, jobId)
+	if err != nil {
+		return err
+	}
+	defer unsubscribe(mySubscriber)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(jobEvent JobEvent) error {
+		data, err := json.Marshal(jobEvent.Job)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", jobEvent.Event, data)
+		flusher.Flush()
+		return err
+	}
+
+	if current != nil {
+		if send(JobEvent{Event: "state", Job: *current}) != nil || isFinal(*current) {
+			return nil
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case jobEvent := <-mySubscriber.events:
+			if send(jobEvent) != nil || (current != nil && isFinal(jobEvent.Job)) {
+				return nil
+			}
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				return nil
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return nil
+		case <-stopping:
+			return nil
+		}
+	}
+}
+
+// serveWebSocket streams the same events as serveEvents, one JSON message per event.
+func serveWebSocket(w http.ResponseWriter, r *http.Request, jobId string) error {
+	mySubscriber, current, err := openStream(r, jobId)
+	if err != nil {
+		return err
+	}
+	defer unsubscribe(mySubscriber)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has responded already.
+		slog.DebugContext(r.Context(), "WebSocket upgrade failed", "err", err)
+		return nil
+	}
+	defer conn.Close()
+
+	// The client isn't expected to send anything, reading is only needed to notice it going away.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if current != nil {
+		if conn.WriteJSON(JobEvent{Event: "state", Job: *current}) != nil || isFinal(*current) {
+			return nil
+		}
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case jobEvent := <-mySubscriber.events:
+			if conn.WriteJSON(jobEvent) != nil || (current != nil && isFinal(jobEvent.Job)) {
+				return nil
+			}
+		case <-keepAlive.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second*10)) != nil {
+				return nil
+			}
+		case <-closed:
+			return nil
+		case <-stopping:
+			return nil
+		}
+	}
+}
+
+func serveUserEvents(w http.ResponseWriter, r *http.Request) error {
+	return serveEvents(w, r, "")
+}
+
+func serveUserWebSocket(w http.ResponseWriter, r *http.Request) error {
+	return serveWebSocket(w, r, "")
+}
@@ -0,0 +1,145 @@
+package master
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"../rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// The gRPC interface of the Master is meant for the workers and for clients which would rather stream their images
+// than send them in one request. It does the same as the HTTP one.
+
+type masterServer struct {
+	rpc.UnimplementedMasterServer
+}
+
+func (masterServer) SubmitImage(stream grpc.ClientStreamingServer[rpc.SubmitImageRequest, rpc.Task]) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	header := first.GetHeader()
+	if header == nil {
+		return status.Error(codes.InvalidArgument, "The submission must start with the header")
+	}
+	err = validateSubmission(stream.Context(), header)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	image := bytes.Buffer{}
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		image.Write(request.GetChunk())
+	}
+
+	id, err := submitImage(stream.Context(), image.Bytes(), header)
+	if err != nil {
+		return err
+	}
+	myTask, err := taskStore.GetTask(stream.Context(), &rpc.TaskId{Id: id})
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(myTask)
+}
+
+func (masterServer) GetTask(ctx context.Context, request *rpc.TaskId) (*rpc.Task, error) {
+	return taskStore.GetTask(ctx, request)
+}
+
+func (masterServer) GetImage(request *rpc.TaskId, stream grpc.ServerStreamingServer[rpc.ImageChunk]) error {
+	image, err := imageStores.Download(stream.Context(), &rpc.ImageRef{State: rpc.ImageState_IMAGE_STATE_FINISHED, Id: request.Id})
+	if err != nil {
+		return err
+	}
+	for len(image) > 0 {
+		size := rpc.ChunkSize
+		if len(image) < size {
+			size = len(image)
+		}
+		err = stream.Send(&rpc.ImageChunk{Data: image[:size]})
+		if err != nil {
+			return err
+		}
+		image = image[size:]
+	}
+	return nil
+}
+
+func (masterServer) ClaimTask(ctx context.Context, request *rpc.ClaimTaskRequest) (*rpc.Task, error) {
+	return claimForWorker(ctx, request.Operations)
+}
+
+func (masterServer) ReportProgress(ctx context.Context, request *rpc.SetProgressRequest) (*emptypb.Empty, error) {
+	err := setProgress(ctx, request.Id, request.Progress)
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (masterServer) FinishTask(ctx context.Context, request *rpc.TaskId) (*emptypb.Empty, error) {
+	err := finishTask(ctx, request.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (masterServer) FailTask(ctx context.Context, request *rpc.FailTaskRequest) (*emptypb.Empty, error) {
+	err := failTask(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (masterServer) ReleaseTask(ctx context.Context, request *rpc.TaskId) (*emptypb.Empty, error) {
+	err := releaseTask(ctx, request.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (masterServer) ReceiveTasks(request *rpc.RegisterWorkerRequest, stream grpc.ServerStreamingServer[rpc.Task]) error {
+	if request.Capacity <= 0 || len(request.Operations) == 0 {
+		return status.Error(codes.InvalidArgument, "Wrong input")
+	}
+	address := ""
+	if client, ok := peer.FromContext(stream.Context()); ok {
+		address = client.Addr.String()
+	}
+
+	worker := addWorker(workerOf(stream.Context()), request.Name, address, int(request.Capacity), request.Operations)
+	defer unregisterWorker(worker)
+
+	// Keepalive notices a dead connection, so there's no need for heartbeats as over HTTP.
+	for {
+		select {
+		case task := <-worker.tasks:
+			err := stream.Send(task)
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		case <-stopping:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package master
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"../rpc"
+	"../service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Jobs are the tasks of the tasks-store as the clients see them.
+
+var stateNames = map[rpc.TaskState]string{
+	rpc.TaskState_TASK_STATE_NOT_STARTED: "queued",
+	rpc.TaskState_TASK_STATE_IN_PROGRESS: "processing",
+	rpc.TaskState_TASK_STATE_FINISHED:    "finished",
+	rpc.TaskState_TASK_STATE_PENDING:     "submitting",
+	rpc.TaskState_TASK_STATE_FAILED:      "failed",
+}
+
+type Job struct {
+	Id         int64             `json:"id"`
+	State      string            `json:"state"`
+	Progress   int               `json:"progress"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	StartedAt  *time.Time        `json:"startedAt,omitempty"`
+	FinishedAt *time.Time        `json:"finishedAt,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	ErrorCode  string            `json:"errorCode,omitempty"`
+	Attempts   int               `json:"attempts,omitempty"`
+	Operation  string            `json:"operation"`
+	Parameters json.RawMessage   `json:"parameters,omitempty"`
+	Metadata   json.RawMessage   `json:"metadata,omitempty"`
+	Callback   string            `json:"callback,omitempty"`
+	Deliveries []Delivery        `json:"deliveries,omitempty"`
+	TraceId    string            `json:"traceId,omitempty"` // The trace of the submission and the processing.
+	Links      map[string]string `json:"links"`
+}
+
+type JobPage struct {
+	Jobs []Job  `json:"jobs"`
+	Next string `json:"next,omitempty"` // Link to the following page, missing on the last one.
+}
+
+func jobFromTask(task *rpc.Task) Job {
+	id := strconv.FormatInt(task.Id, 10)
+	job := Job{
+		Id:         task.Id,
+		State:      stateNames[task.State],
+		Progress:   int(task.Progress),
+		CreatedAt:  task.CreatedAt.AsTime(),
+		StartedAt:  rpc.Time(task.StartedAt),
+		FinishedAt: rpc.Time(task.FinishedAt),
+		Error:      task.Error,
+		ErrorCode:  task.ErrorCode,
+		Attempts:   int(task.Attempts),
+		Operation:  task.Operation,
+		Parameters: task.Parameters,
+		Metadata:   task.Metadata,
+		Callback:   task.Callback,
+		Deliveries: []Delivery{},
+		Links:      map[string]string{"self": "/jobs/" + id},
+	}
+	if parts := strings.Split(task.Trace, "-"); len(parts) == 4 {
+		job.TraceId = parts[1]
+	}
+	for _, delivery := range task.Deliveries {
+		job.Deliveries = append(job.Deliveries, service.DeliveryFromProto(delivery))
+	}
+	if task.State == rpc.TaskState_TASK_STATE_FINISHED {
+		job.Links["result"] = "/get?id=" + id
+	}
+	if len(task.Metadata) != 0 {
+		job.Links["metadata"] = "/metadata?id=" + id
+	}
+	return job
+}
+
+// getTask fetches the task from the tasks-store.
+func getTask(ctx context.Context, id string) (*rpc.Task, error) {
+	number, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, service.WrongInput(fmt.Sprintf("Invalid job id %q", id))
+	}
+
+	myTask, err := taskStore.GetTask(ctx, &rpc.TaskId{Id: number})
+	if status.Code(err) == codes.NotFound {
+		return nil, service.NewError(http.StatusNotFound, "not_found", "No job "+id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return myTask, nil
+}
+
+func getJob(w http.ResponseWriter, r *http.Request) error {
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	if strings.HasSuffix(id, "/events") {
+		return serveEvents(w, r, strings.TrimSuffix(id, "/events"))
+	}
+	if strings.HasSuffix(id, "/ws") {
+		return serveWebSocket(w, r, strings.TrimSuffix(id, "/ws"))
+	}
+
+	myTask, err := getTask(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	return service.WriteJSON(w, jobFromTask(myTask))
+}
+
+// listJobs supports the filters state (a state name) and since (RFC 3339 creation time), and pagination with limit and after.
+func listJobs(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+	query, err := listTasksRequest(values)
+	if err != nil {
+		return err
+	}
+
+	tasks, err := taskStore.ListTasks(r.Context(), query)
+	if err != nil {
+		return err
+	}
+
+	page := JobPage{Jobs: []Job{}}
+	for _, task := range tasks.Tasks {
+		page.Jobs = append(page.Jobs, jobFromTask(task))
+	}
+	if tasks.Next != -1 {
+		values.Set("after", strconv.FormatInt(tasks.Next, 10))
+		page.Next = "/jobs?" + values.Encode()
+	}
+	return service.WriteJSON(w, page)
+}
+
+func listTasksRequest(values url.Values) (*rpc.ListTasksRequest, error) {
+	query := &rpc.ListTasksRequest{}
+	if len(values.Get("state")) != 0 {
+		for number, name := range stateNames {
+			if name == values.Get("state") {
+				state := number
+				query.State = &state
+			}
+		}
+		if query.State == nil {
+			return nil, service.WrongInput("Unknown state")
+		}
+	}
+	if len(values.Get("since")) != 0 {
+		since, err := time.Parse(time.RFC3339, values.Get("since"))
+		if err != nil {
+			return nil, service.WrongInput("since must be an RFC 3339 time")
+		}
+		query.Since = timestamppb.New(since)
+	}
+	if len(values.Get("after")) != 0 {
+		after, err := strconv.ParseInt(values.Get("after"), 10, 64)
+		if err != nil {
+			return nil, service.WrongInput("after must be a job id")
+		}
+		query.After = &after
+	}
+	if len(values.Get("limit")) != 0 {
+		limit, err := strconv.ParseInt(values.Get("limit"), 10, 32)
+		if err != nil || limit <= 0 {
+			return nil, service.WrongInput("limit must be a positive number")
+		}
+		query.Limit = int32(limit)
+	}
+	return query, nil
+}
+
+// reportProgress is called by the workers while processing a task.
+func reportProgress(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+	id, err := service.Int(values, "id")
+	if err != nil {
+		return err
+	}
+	progress, err := service.Int(values, "progress")
+	if err != nil {
+		return err
+	}
+
+	err = setProgress(r.Context(), id, int32(progress))
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(w, "success")
+	return nil
+}
@@ -0,0 +1,140 @@
+package master
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"../service"
+	"../tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Several Masters may run at once. They compete for a lease on the masterAddress key of the config store, the
+// one holding it is the leader and the only one doing any work. The others are standbys: they pass HTTP requests
+// on to the leader, and refuse gRPC calls as unavailable, so that the clients look the leader up again.
+//
+// A leader which is stopped gives up its lease. One which can't renew it before it runs out exits, rather than risk a second leader handing out
+// the same tasks. Whichever standby acquires the lease next takes over.
+
+const leaseTTL = time.Second * 10
+const leaseRenewInterval = time.Second * 2
+
+var selfAddress string
+var leading atomic.Bool
+
+var errNotLeader = status.Error(codes.Unavailable, "This Master is a standby, ask the leader")
+
+type Leadership struct {
+	Self          string `json:"self"`
+	Leader        bool   `json:"leader"`
+	LeaderAddress string `json:"leaderAddress,omitempty"`
+}
+
+func isLeader() bool {
+	return leading.Load()
+}
+
+// campaign tries to acquire the lease until it succeeds, and then keeps renewing it.
+func campaign() {
+	lastRenewed := time.Time{}
+	for {
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), leaseRenewInterval)
+		acquired, err := config.Acquire(ctx, service.MasterKey, selfAddress, leaseTTL)
+		cancel()
+
+		if acquired {
+			lastRenewed = start
+			if !isLeader() {
+				becomeLeader()
+			}
+		} else if isLeader() {
+			// A failed attempt and the wait take up to two intervals, the lease mustn't run out in the meantime.
+			if err == nil || time.Since(lastRenewed) > leaseTTL-2*leaseRenewInterval {
+				service.Fatal(errors.New("Error: Lost the leadership."))
+			}
+			slog.Warn("Renewing the leadership failed", "err", err)
+		}
+		select {
+		case <-time.After(leaseRenewInterval):
+		case <-stopping:
+			return
+		}
+	}
+}
+
+// resign gives up the lease once the Master has stopped, so that a standby takes over right away.
+func resign(ctx context.Context) {
+	if !isLeader() {
+		return
+	}
+	err := config.Release(ctx, service.MasterKey, selfAddress)
+	if err != nil {
+		slog.Warn("Giving up the leadership failed", "err", err)
+	}
+}
+
+func becomeLeader() {
+	leading.Store(true)
+	slog.Info("Leading", "address", selfAddress)
+	go startDispatcher()
+}
+
+// leaderOnly serves the request if this Master leads, and passes it on to the leader otherwise.
+func leaderOnly(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isLeader() {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		leaderAddress, err := config.Lookup(r.Context(), service.MasterKey)
+		if err != nil || leaderAddress == selfAddress {
+			service.WriteError(w, service.NewError(http.StatusServiceUnavailable, "no_leader", "No Master leads at the moment, try again later."))
+			return
+		}
+
+		proxy := &httputil.ReverseProxy{
+			Rewrite: func(request *httputil.ProxyRequest) {
+				request.SetURL(&url.URL{Scheme: "http", Host: leaderAddress})
+				request.SetXForwarded()
+				tracing.Inject(request.In.Context(), request.Out.Header.Set)
+			},
+			FlushInterval: -1, // The event streams mustn't be held back.
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				service.WriteError(w, service.NewError(http.StatusBadGateway, "unavailable", err.Error()))
+			},
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+func leaderOnlyUnary(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !isLeader() {
+		return nil, errNotLeader
+	}
+	return handler(ctx, request)
+}
+
+func leaderOnlyStream(server interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !isLeader() {
+		return errNotLeader
+	}
+	return handler(server, stream)
+}
+
+// getLeadership tells which Master leads. It's answered by every Master itself.
+func getLeadership(w http.ResponseWriter, r *http.Request) error {
+	leaderAddress, err := config.Get(r.Context(), service.MasterKey)
+	if err != nil {
+		return err
+	}
+	return service.WriteJSON(w, Leadership{Self: selfAddress, Leader: isLeader(), LeaderAddress: leaderAddress})
+}
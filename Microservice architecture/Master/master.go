@@ -1,235 +1,372 @@
-package main
+package master
 
 import (
-	"os"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"io/ioutil"
-	"net/url"
+	"context"
 	"encoding/json"
-	"io"
+	"regexp"
+	"strings"
+
+	"../rpc"
+	"../service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-type Task struct {
-	Id int `json:"id"`
-	State int `json:"state"`
-}
+var config *service.ConfigStore
+var taskStore rpc.TaskStoreClient
+var imageStores rpc.ImageStores
+var stopping <-chan struct{}
 
-var databaseLocation string
-var storageLocation string
-var keyValueStoreAddress string
+// Main runs a Master. The args are its address and the one of the config store.
+func Main(args []string) {
+	myService := service.New("master", args[0], args[1])
+	config = myService.Config
+	selfAddress = args[0]
+	stopping = myService.Stopping()
 
-func main() {
-	if !registerInKVStore() {
-		return
+	var err error
+	taskStore, err = config.TaskStore(context.Background())
+	if err != nil {
+		service.Fatal(err)
+	}
+	imageStores, err = config.ImageStores(context.Background())
+	if err != nil {
+		service.Fatal(err)
 	}
-	keyValueStoreAddress = os.Args[2]
 
-	response, err := http.Get("http://" + keyValueStoreAddress + "/get?key=databaseAddress")
-	if response.StatusCode != http.StatusOK {
-		fmt.Println("Error: can't get database address.")
-		fmt.Println(response.Body)
-		return
+	handle := func(pattern string, methods service.Methods) {
+		myService.Handle(pattern, leaderOnly(methods))
+	}
+	handleWorker := func(pattern string, methods service.Methods) {
+		myService.Handle(pattern, leaderOnly(workerOnly(methods)))
 	}
-	data, err := ioutil.ReadAll(response.Body)
+	handle("/new", service.Methods{http.MethodPost: newImage})
+	handle("/get", service.Methods{http.MethodGet: getImage})
+	handle("/isReady", service.Methods{http.MethodGet: isReady})
+	handle("/metadata", service.Methods{http.MethodGet: getMetadata})
+	handle("/jobs", service.Methods{http.MethodGet: listJobs})
+	handle("/jobs/", service.Methods{http.MethodGet: getJob})
+	handleWorker("/reportProgress", service.Methods{http.MethodPost: reportProgress})
+	handle("/events", service.Methods{http.MethodGet: serveUserEvents})
+	handle("/ws", service.Methods{http.MethodGet: serveUserWebSocket})
+	handle("/handshake", service.Methods{http.MethodPost: serveHandshake})
+	handleWorker("/getNewTask", service.Methods{http.MethodPost: getNewTask})
+	handleWorker("/registerTaskFinished", service.Methods{http.MethodPost: registerTaskFinished})
+	handleWorker("/registerTaskFailed", service.Methods{http.MethodPost: registerTaskFailed})
+	handleWorker("/releaseTask", service.Methods{http.MethodPost: releaseTaskOfWorker})
+	handleWorker("/registerWorker", service.Methods{http.MethodPost: registerWorker})
+	handle("/workers", service.Methods{http.MethodGet: listWorkers})
+	handle("/admin", service.Methods{http.MethodGet: serveDashboard})
+	handle("/admin/overview", service.Methods{http.MethodGet: serveOverview})
+	handle("/admin/requeue", service.Methods{http.MethodPost: requeueJob})
+	handle("/admin/cancel", service.Methods{http.MethodPost: cancelJob})
+	handle("/admin/purge", service.Methods{http.MethodPost: purgeJob})
+	myService.Handle("/leadership", service.Methods{http.MethodGet: getLeadership})
+	rpc.RegisterMasterServer(myService.EnableGrpc(
+		grpc.ChainUnaryInterceptor(leaderOnlyUnary, workerAuthUnary),
+		grpc.ChainStreamInterceptor(leaderOnlyStream, workerAuthStream),
+	), masterServer{})
+	myService.OnShutdown(resign)
+	go campaign()
+	err = myService.Run()
 	if err != nil {
-		fmt.Println(err)
-		return
+		service.Fatal(err)
 	}
-	databaseLocation = string(data)
+}
 
-	response, err = http.Get("http://" + keyValueStoreAddress + "/get?key=storageAddress")
-	if response.StatusCode != http.StatusOK {
-		fmt.Println("Error: can't get storage address.")
-		fmt.Println(response.Body)
-		return
+func newImage(w http.ResponseWriter, r *http.Request) error {
+	header := &rpc.SubmitHeader{
+		ExifPolicy: r.URL.Query().Get("exif"),
+		User:       r.URL.Query().Get("user"),
+		Callback:   r.URL.Query().Get("callback"),
+		Client:     r.URL.Query().Get("client"),
+		Operation:  r.URL.Query().Get("operation"),
+		Parameters: []byte(r.URL.Query().Get("parameters")),
+	}
+	err := validateSubmission(r.Context(), header)
+	if err != nil {
+		return err
 	}
-	data, err = ioutil.ReadAll(response.Body)
+	// The upload is buffered, so that it can be retried on another storage replica.
+	image, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return service.NewError(http.StatusBadRequest, "invalid_body", err.Error())
 	}
-	storageLocation = string(data)
 
-	http.HandleFunc("/new", newImage)
-	http.HandleFunc("/get", getImage)
-	http.HandleFunc("/isReady", isReady)
-	http.HandleFunc("/getNewTask", getNewTask)
-	http.HandleFunc("/registerTaskFinished", registerTaskFinished)
-	http.ListenAndServe(":3003", nil)
+	id, err := submitImage(r.Context(), image, header)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(w, id)
+	return nil
 }
 
-func newImage(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		response, err := http.Post("http://" + databaseLocation + "/newTask", "text/plain", nil)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
-		id, err := ioutil.ReadAll(response.Body)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-		_, err = http.Post("http://" + storageLocation + "/sendImage?id=" + string(id) + "&state=working", "image", r.Body)
+func getImage(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+	id, err := service.Int(values, "id")
+	if err != nil {
+		return err
+	}
+	ref := &rpc.ImageRef{State: rpc.ImageState_IMAGE_STATE_FINISHED, Id: id}
+
+	if len(values.Get("presigned")) != 0 {
+		// Let the client download the image straight from the storage backend instead of going through us.
+		var presigned *rpc.PresignedImage
+		err = imageStores.Call(func(store rpc.ImageStoreClient) error {
+			presigned, err = store.PresignImage(r.Context(), ref)
+			return err
+		})
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
+			return err
 		}
-		fmt.Fprint(w, string(id))
+		fmt.Fprint(w, presigned.Url)
+		return nil
+	}
+
+	image, err := imageStores.Download(r.Context(), ref)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(image))
+	w.Write(image)
+	return nil
+}
+
+func isReady(w http.ResponseWriter, r *http.Request) error {
+	myTask, err := getTask(r.Context(), r.URL.Query().Get("id"))
+	if err != nil {
+		return err
+	}
+
+	if myTask.State == rpc.TaskState_TASK_STATE_FAILED {
+		return service.NewError(http.StatusUnprocessableEntity, "job_failed", myTask.Error)
+	}
+	if(myTask.State == rpc.TaskState_TASK_STATE_FINISHED) {
+		fmt.Fprint(w, "1")
 	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only POST accepted")
+		fmt.Fprint(w, "0")
 	}
+	return nil
 }
 
-func getImage(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		values, err := url.ParseQuery(r.URL.RawQuery)
-		if err != nil {
-			fmt.Fprint(w, err)
-			return
-		}
-		if len(values.Get("id")) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Wrong input")
-			return
-		}
+func getMetadata(w http.ResponseWriter, r *http.Request) error {
+	myTask, err := getTask(r.Context(), r.URL.Query().Get("id"))
+	if err != nil {
+		return err
+	}
+	if len(myTask.Metadata) == 0 {
+		return service.NewError(http.StatusNotFound, "not_found", "No metadata for this task.")
+	}
 
-		response, err := http.Get("http://" + storageLocation + "/getImage?id=" + values.Get("id") + "&state=finished")
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(myTask.Metadata)
+	return nil
+}
 
-		_, err = io.Copy(w, response.Body)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only GET accepted")
+// validateSubmission refuses a callback which couldn't be notified, rather than failing to sign its webhook later.
+// It also fills in the defaults of the header.
+func validateSubmission(ctx context.Context, header *rpc.SubmitHeader) error {
+	if len(header.ExifPolicy) == 0 {
+		header.ExifPolicy = "keep"
+	}
+	if len(header.Operation) == 0 {
+		header.Operation = service.DefaultOperation
+	}
+	if !validOperation(header.Operation) {
+		return service.WrongInput(fmt.Sprintf("Invalid operation %q", header.Operation))
+	}
+	if len(header.Parameters) != 0 && !isJSONObject(header.Parameters) {
+		return service.WrongInput("The parameters must be a JSON object")
 	}
+
+	if len(header.Callback) == 0 {
+		return nil
+	}
+	err := validateCallback(ctx, header.Callback)
+	if err != nil {
+		return service.WrongInput(err.Error())
+	}
+	_, err = getWebhookSecret(ctx, header.Client)
+	if err != nil {
+		return service.WrongInput(err.Error())
+	}
+	return nil
 }
 
-func isReady(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		values, err := url.ParseQuery(r.URL.RawQuery)
-		if err != nil {
-			fmt.Fprint(w, err)
-			return
-		}
-		if len(values.Get("id")) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Wrong input")
-			return
-		}
+// validOperation accepts names like swapChannels or blur-2, which the workers may declare as their operations.
+func validOperation(operation string) bool {
+	return operationPattern.MatchString(operation)
+}
 
-		response, err := http.Get("http://" + databaseLocation + "/getById?id=" + values.Get("id"))
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
-		data, err := ioutil.ReadAll(response.Body)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
+var operationPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{0,63}$`)
 
-		myTask := Task{}
-		json.Unmarshal(data, &myTask)
+func isJSONObject(data []byte) bool {
+	object := map[string]json.RawMessage{}
+	return json.Unmarshal(data, &object) == nil
+}
 
-		if(myTask.State == 2) {
-			fmt.Fprint(w, "1")
-		} else {
-			fmt.Fprint(w, "0")
-		}
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only GET accepted")
+// copyMetadataToTask asks the storage for the metadata of the uploaded image and saves it with the task.
+func copyMetadataToTask(ctx context.Context, id int64) error {
+	var metadata *rpc.ImageMetadata
+	err := imageStores.Call(func(store rpc.ImageStoreClient) error {
+		var err error
+		metadata, err = store.GetMetadata(ctx, &rpc.ImageRef{State: rpc.ImageState_IMAGE_STATE_WORKING, Id: id})
+		return err
+	})
+	if err != nil {
+		return err
 	}
+
+	_, err = taskStore.SetMetadata(ctx, &rpc.SetMetadataRequest{Id: id, Metadata: metadata.Json})
+	return err
 }
 
-func getNewTask(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		response, err := http.Post("http://" + databaseLocation + "/getNewTask", "text/plain", nil)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
+// claimForWorker takes the next not started task from the tasks-store, for a worker which asked for one.
+func claimForWorker(ctx context.Context, operations []string) (*rpc.Task, error) {
+	myTask, err := taskStore.ClaimTask(ctx, &rpc.ClaimTaskRequest{Worker: workerOf(ctx), Operations: operations})
+	if err != nil {
+		return nil, err
+	}
+	publishJob(myTask.Id, "state")
+	return myTask, nil
+}
 
-		_, err = io.Copy(w, response.Body)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only POST accepted")
+// finishTask marks the task as finished and lets everybody interested know.
+func finishTask(ctx context.Context, id int64) error {
+	_, err := taskStore.FinishTask(ctx, &rpc.TaskId{Id: id, Worker: workerOf(ctx)})
+	taskFinished(id)
+	if err != nil {
+		return err
 	}
+	publishJob(id, "state")
+	go deliverWebhook(id, "job.finished")
+	return nil
 }
 
-func registerTaskFinished(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		values, err := url.ParseQuery(r.URL.RawQuery)
-		if err != nil {
-			fmt.Fprint(w, err)
-			return
-		}
-		if len(values.Get("id")) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Wrong input")
-			return
-		}
+// failTask records why the worker couldn't process the task. Unless the task is queued again, it's failed for good.
+func failTask(ctx context.Context, request *rpc.FailTaskRequest) error {
+	request.Worker = workerOf(ctx)
+	myTask, err := taskStore.FailTask(ctx, request)
+	taskFinished(request.Id)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Task failed", "job", request.Id, "code", request.Code, "message", request.Message, "transient", request.Transient)
+	publishJob(request.Id, "state")
+	if myTask.State == rpc.TaskState_TASK_STATE_FAILED {
+		go deliverWebhook(request.Id, "job.failed")
+	}
+	return nil
+}
 
-		response, err := http.Post("http://" + databaseLocation + "/finishTask?id=" + values.Get("id"), "test/plain", nil)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
+// releaseTask hands a task back to the queue, which the worker won't finish.
+func releaseTask(ctx context.Context, id int64) error {
+	_, err := taskStore.ReleaseTask(ctx, &rpc.TaskId{Id: id, Worker: workerOf(ctx)})
+	taskFinished(id)
+	if err != nil {
+		return err
+	}
+	publishJob(id, "state")
+	return nil
+}
 
-		_, err = io.Copy(w, response.Body)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only POST accepted")
+func setProgress(ctx context.Context, id int64, progress int32) error {
+	_, err := taskStore.SetProgress(ctx, &rpc.SetProgressRequest{Id: id, Progress: progress, Worker: workerOf(ctx)})
+	if err != nil {
+		return err
+	}
+	publishJob(id, "progress")
+	return nil
+}
+
+func getNewTask(w http.ResponseWriter, r *http.Request) error {
+	operations := []string{}
+	if len(r.URL.Query().Get("operations")) != 0 {
+		operations = strings.Split(r.URL.Query().Get("operations"), ",")
+	}
+	myTask, err := claimForWorker(r.Context(), operations)
+	if status.Code(err) == codes.NotFound {
+		return service.NewError(http.StatusNotFound, "no_task", "No non-started task.")
+	}
+	if err != nil {
+		return err
+	}
+
+	return service.WriteJSON(w, service.TaskFromProto(myTask))
+}
+
+func registerTaskFinished(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+	id, err := service.Int(values, "id")
+	if err != nil {
+		return err
+	}
+
+	err = finishTask(r.Context(), id)
+	if err != nil {
+		return err
 	}
+
+	fmt.Fprint(w, "success")
+	return nil
 }
 
-func registerInKVStore() bool {
-	if len(os.Args) < 3 {
-		fmt.Println("Error: Too few arguments.")
-		return false
+// registerTaskFailed takes the id, the error code and message, and whether the failure is transient.
+func registerTaskFailed(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+	id, err := service.Int(values, "id")
+	if err != nil {
+		return err
+	}
+	code, err := service.Required(values, "code")
+	if err != nil {
+		return err
 	}
-	masterAddress := os.Args[1] // The address of itself
-	keyValueStoreAddress := os.Args[2]
 
-	response, err := http.Post("http://" + keyValueStoreAddress + "/set?key=masterAddress&value=" + masterAddress, "", nil)
+	err = failTask(r.Context(), &rpc.FailTaskRequest{
+		Id:        id,
+		Code:      code,
+		Message:   values.Get("message"),
+		Transient: values.Get("transient") == "true",
+	})
 	if err != nil {
-		fmt.Println(err)
-		return false
+		return err
 	}
-	data, err := ioutil.ReadAll(response.Body)
+
+	fmt.Fprint(w, "success")
+	return nil
+}
+
+func releaseTaskOfWorker(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
 	if err != nil {
-		fmt.Println(err)
-		return false
+		return err
 	}
-	if response.StatusCode != http.StatusOK {
-		fmt.Println("Error: Failure when contacting key-value store: ", string(data))
-		return false
+	id, err := service.Int(values, "id")
+	if err != nil {
+		return err
 	}
-	return true
-}
\ No newline at end of file
+
+	err = releaseTask(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(w, "success")
+	return nil
+}
@@ -0,0 +1,34 @@
+package master
+
+import (
+	"../metrics"
+)
+
+// What the Master does besides serving requests: submissions, the push dispatch and the webhooks.
+
+var jobsSubmitted = metrics.NewCounter("master_jobs_submitted_total", "Submissions of jobs, by whether they succeeded", "operation", "result")
+var assignmentsExpired = metrics.NewCounter("master_assignment_expirations_total", "Tasks pushed to a worker which it didn't finish within the claim timeout")
+var webhookDeliveries = metrics.NewCounter("master_webhook_deliveries_total", "Attempts to deliver a webhook, by the status the receiver answered, or error", "event", "status")
+
+func init() {
+	metrics.NewGaugeFunc("master_leader", "1 if this Master leads, 0 if it's a standby", func() float64 {
+		if isLeader() {
+			return 1
+		}
+		return 0
+	})
+	metrics.NewGaugeFunc("master_workers", "Workers registered for the push dispatch", func() float64 {
+		workersMutex.Lock()
+		defer workersMutex.Unlock()
+		return float64(len(workers))
+	})
+	metrics.NewGaugeFunc("master_tasks_pushed", "Tasks pushed to the registered workers and not finished yet", func() float64 {
+		workersMutex.Lock()
+		defer workersMutex.Unlock()
+		inFlight := 0
+		for _, worker := range workers {
+			inFlight += len(worker.InFlight)
+		}
+		return float64(inFlight)
+	})
+}
@@ -0,0 +1,125 @@
+package master
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+
+	"../rpc"
+	"../tracing"
+)
+
+// A submission touches both the tasks-store and the images-store, which can fail independently.
+// It's done in steps, each failing step undoes the ones before it:
+//
+//  1. The image is uploaded to the staging area of the images-store, under a random token.
+//  2. A pending task is created. Workers don't get pending tasks.
+//  3. The staged image is promoted to the working image of the task.
+//  4. The task is activated, from now on workers may take it.
+//
+// If the Master dies in between, the staged image and the pending task are left behind. The images-store
+// garbage collector removes stale staged images, pending tasks are never handed out.
+
+func newStagingToken() (string, error) {
+	token := make([]byte, 16)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// submitImage runs the whole submission and returns the id of the new task.
+// The steps follow the context of the request, the compensations run even if the client has gone away.
+func submitImage(ctx context.Context, image []byte, header *rpc.SubmitHeader) (id int64, err error) {
+	// The processing of the task continues the trace of the submission.
+	ctx, span := tracing.Start(ctx, "submit job", tracing.Internal)
+	span.SetAttribute("job.operation", header.Operation)
+	defer func() {
+		span.SetError(err)
+		span.End()
+		result := "ok"
+		if err != nil {
+			result = "failed"
+		}
+		jobsSubmitted.Inc(header.Operation, result)
+	}()
+	undoCtx := context.WithoutCancel(ctx)
+
+	token, err := newStagingToken()
+	if err != nil {
+		return 0, err
+	}
+	staged := &rpc.ImageRef{State: rpc.ImageState_IMAGE_STATE_STAGING, Token: token}
+
+	err = imageStores.Upload(ctx, &rpc.UploadHeader{Image: staged, ExifPolicy: header.ExifPolicy, User: header.User}, image)
+	if err != nil {
+		// Nothing has been stored, so there's nothing to undo. A refusal of the image is passed on to the client as it is.
+		return 0, err
+	}
+
+	myTask, err := taskStore.NewTask(ctx, &rpc.NewTaskRequest{
+		Pending:    true,
+		Callback:   header.Callback,
+		Client:     header.Client,
+		Operation:  header.Operation,
+		Parameters: header.Parameters,
+		Trace:      tracing.TraceParent(ctx),
+	})
+	if err != nil {
+		deleteFromStorage(undoCtx, staged)
+		return 0, err
+	}
+	id = myTask.Id
+	span.SetAttribute("job.id", id)
+
+	err = imageStores.Call(func(store rpc.ImageStoreClient) error {
+		_, err := store.PromoteImage(ctx, &rpc.PromoteImageRequest{Token: token, Id: id})
+		return err
+	})
+	if err != nil {
+		abortTask(undoCtx, id, err)
+		deleteFromStorage(undoCtx, staged)
+		// The promotion may have failed after writing the working image, like when the quorum wasn't reached.
+		deleteFromStorage(undoCtx, &rpc.ImageRef{State: rpc.ImageState_IMAGE_STATE_WORKING, Id: id})
+		return 0, err
+	}
+
+	err = copyMetadataToTask(ctx, id)
+	if err != nil {
+		// The metadata is informational, the task can still be processed without it.
+		slog.WarnContext(ctx, "Copying the metadata to the task failed", "job", id, "err", err)
+	}
+
+	_, err = taskStore.ActivateTask(ctx, &rpc.TaskId{Id: id})
+	if err != nil {
+		deleteFromStorage(undoCtx, &rpc.ImageRef{State: rpc.ImageState_IMAGE_STATE_WORKING, Id: id})
+		abortTask(undoCtx, id, err)
+		return 0, err
+	}
+	publishJob(id, "state")
+	notifyDispatcher()
+	return id, nil
+}
+
+// abortTask marks the pending task as failed. If even that doesn't work the task stays pending, which is harmless.
+// The client never got the id of the task, so its callback isn't notified.
+func abortTask(ctx context.Context, id int64, cause error) {
+	_, err := taskStore.AbortTask(ctx, &rpc.AbortTaskRequest{Id: id, Error: cause.Error()})
+	if err != nil {
+		slog.WarnContext(ctx, "Aborting a task failed", "job", id, "err", err)
+		return
+	}
+	publishJob(id, "state")
+}
+
+func deleteFromStorage(ctx context.Context, ref *rpc.ImageRef) {
+	err := imageStores.Call(func(store rpc.ImageStoreClient) error {
+		_, err := store.DeleteImage(ctx, ref)
+		return err
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "Deleting an image from storage failed", "image", ref.String(), "err", err)
+	}
+}
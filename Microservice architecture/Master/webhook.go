@@ -0,0 +1,230 @@
+package master
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"../rpc"
+	"../service"
+	"../tracing"
+)
+
+// A job may carry a callback URL, which gets a POST once the job finished or failed. The body is signed with
+// a secret shared with the client, kept in the key-value store as "webhookSecret.<client>" ("webhookSecret" for
+// requests without a client). The receiver checks the signature like this:
+//
+//	X-Webhook-Signature: sha256=hex(HMAC-SHA256(secret, X-Webhook-Timestamp + "." + body))
+//
+// Failed deliveries are retried with a growing delay. Every attempt is recorded with the task.
+//
+// Callbacks may only reach public addresses, unless their host is allowed with -webhook-allow-hosts, so that clients
+// can't make Master call the services behind it. The addresses are checked again when connecting, as the name may
+// resolve differently by then.
+
+const webhookAttempts = 8
+const webhookFirstRetryDelay = time.Second
+
+var webhookAllowHosts = flag.String("webhook-allow-hosts", "", "Comma separated hosts which callbacks may reach even if they're internal, like 127.0.0.1")
+
+var errInternalCallback = errors.New("Error: The callback may not reach an internal address.")
+
+var webhookClient = &http.Client{
+	Timeout:   time.Second * 10,
+	Transport: &http.Transport{DialContext: dialCallback},
+}
+
+// allowedHost tells whether the host of a callback was allowed to be internal.
+func allowedHost(host string) bool {
+	for _, allowed := range strings.Split(*webhookAllowHosts, ",") {
+		if len(allowed) != 0 && strings.EqualFold(strings.TrimSpace(allowed), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// internalAddress tells whether the IP is one of the machine or of a private network.
+func internalAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// dialCallback connects to the host of a callback, refusing internal addresses unless the host is allowed.
+func dialCallback(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: time.Second * 10}
+	if !allowedHost(host) {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || internalAddress(ip) {
+				return errInternalCallback
+			}
+			return nil
+		}
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+type Delivery = service.Delivery
+
+type webhookPayload struct {
+	Event string `json:"event"`
+	Job   Job    `json:"job"`
+}
+
+func validateCallback(ctx context.Context, callback string) error {
+	parsed, err := url.Parse(callback)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Hostname()) == 0 {
+		return errors.New("Error: The callback must be an absolute http or https URL.")
+	}
+	if allowedHost(parsed.Hostname()) {
+		return nil
+	}
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, parsed.Hostname())
+	if err != nil {
+		return errors.New("Error: The host of the callback can't be resolved.")
+	}
+	for _, address := range addresses {
+		if internalAddress(address.IP) {
+			return errInternalCallback
+		}
+	}
+	return nil
+}
+
+func webhookSecretKey(client string) string {
+	if len(client) == 0 {
+		return "webhookSecret"
+	}
+	return "webhookSecret." + client
+}
+
+func getWebhookSecret(ctx context.Context, client string) (string, error) {
+	secret, err := config.Get(ctx, webhookSecretKey(client))
+	if err != nil {
+		return "", err
+	}
+	if len(secret) == 0 {
+		return "", errors.New("Error: No webhook secret configured for this client.")
+	}
+	return secret, nil
+}
+
+func signWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverWebhook notifies the callback of the task, if it has one. It's meant to run in its own goroutine.
+func deliverWebhook(id int64, event string) {
+	myTask, err := getTask(context.Background(), strconv.FormatInt(id, 10))
+	if err != nil {
+		slog.Warn("Webhook failed", "job", id, "event", event, "err", err)
+		return
+	}
+	if len(myTask.Callback) == 0 {
+		return
+	}
+	// Part of the trace of the job.
+	ctx, span := tracing.Start(tracing.WithTraceParent(context.Background(), myTask.Trace), "deliver webhook", tracing.Internal)
+	span.SetAttribute("job.id", id)
+	span.SetAttribute("webhook.event", event)
+	defer span.End()
+	ctx = tracing.WithRequestId(ctx, tracing.NewRequestId())
+
+	secret, err := getWebhookSecret(ctx, myTask.Client)
+	if err != nil {
+		span.SetError(err)
+		slog.WarnContext(ctx, "Webhook failed", "job", id, "event", event, "err", err)
+		return
+	}
+
+	body, err := json.Marshal(webhookPayload{Event: event, Job: jobFromTask(myTask)})
+	if err != nil {
+		span.SetError(err)
+		slog.WarnContext(ctx, "Webhook failed", "job", id, "event", event, "err", err)
+		return
+	}
+
+	delay := webhookFirstRetryDelay
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		delivery := Delivery{Event: event, Attempt: attempt, Time: time.Now()}
+		retry := false
+		statusCode, err := postWebhook(myTask.Callback, secret, event, body)
+		delivery.StatusCode = statusCode
+		if err != nil {
+			delivery.Error = err.Error()
+			retry = true
+		} else if statusCode < 200 || statusCode > 299 {
+			// The receiver rejecting the request won't change, but it may be overloaded or down for a moment.
+			retry = statusCode >= 500 || statusCode == http.StatusTooManyRequests || statusCode == http.StatusRequestTimeout
+		}
+		recordDelivery(ctx, id, delivery)
+		if err != nil {
+			webhookDeliveries.Inc(event, "error")
+		} else {
+			webhookDeliveries.Inc(event, strconv.Itoa(statusCode))
+		}
+
+		if !retry {
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	span.SetError(errors.New("given up"))
+	slog.WarnContext(ctx, "Webhook given up", "job", id, "event", event, "attempts", webhookAttempts)
+}
+
+func postWebhook(callback string, secret string, event string, body []byte) (int, error) {
+	request, err := http.NewRequest(http.MethodPost, callback, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Webhook-Event", event)
+	request.Header.Set("X-Webhook-Timestamp", timestamp)
+	request.Header.Set("X-Webhook-Signature", signWebhook(secret, timestamp, body))
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	return response.StatusCode, nil
+}
+
+func recordDelivery(ctx context.Context, id int64, delivery Delivery) {
+	_, err := taskStore.AddDelivery(ctx, &rpc.AddDeliveryRequest{Id: id, Delivery: service.DeliveryToProto(delivery)})
+	if err != nil {
+		slog.WarnContext(ctx, "Recording a webhook delivery failed", "job", id, "err", err)
+	}
+}
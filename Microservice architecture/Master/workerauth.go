@@ -0,0 +1,212 @@
+package master
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"../rpc"
+	"../service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Workers identify themselves with a handshake, which exchanges their version and operations and gives them a worker
+// id with a credential. Both come with each of their calls, as gRPC metadata or HTTP headers. The credential is an
+// HMAC of the worker id keyed with the shared -worker-token, so that every Master can check it, also after a failover.
+// Without a token any worker may shake hands, and the key is a random one of this Master, so after a failover the
+// workers shake hands again. Either way only the worker ids handed out by a handshake get through, and the
+// tasks-store only lets the worker holding the claim of a task change it.
+
+var workerToken = flag.String("worker-token", os.Getenv("WORKER_TOKEN"), "Shared secret of the workers, $WORKER_TOKEN by default. Without one any worker may shake hands")
+
+// sessionKey signs the credentials while there's no token.
+var sessionKey = func() []byte {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// The gRPC methods only workers may call.
+var workerMethods = map[string]bool{
+	rpc.Master_ClaimTask_FullMethodName:      true,
+	rpc.Master_ReportProgress_FullMethodName: true,
+	rpc.Master_FinishTask_FullMethodName:     true,
+	rpc.Master_FailTask_FullMethodName:       true,
+	rpc.Master_ReleaseTask_FullMethodName:    true,
+	rpc.Master_ReceiveTasks_FullMethodName:   true,
+}
+
+var errUnknownWorker = status.Error(codes.Unauthenticated, "Unknown worker or wrong credential, shake hands first")
+
+type workerIdKey struct{}
+
+// workerOf returns the id of the worker making the call.
+func workerOf(ctx context.Context) string {
+	id, _ := ctx.Value(workerIdKey{}).(string)
+	return id
+}
+
+func credentialFor(workerId string) string {
+	key := sessionKey
+	if len(*workerToken) != 0 {
+		key = []byte(*workerToken)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(workerId))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// authenticateWorker returns the context of a call of the worker, or an error if it didn't shake hands with a
+// Master which knows the key of its credential.
+func authenticateWorker(ctx context.Context, workerId string, credential string) (context.Context, error) {
+	if len(workerId) == 0 || !hmac.Equal([]byte(credential), []byte(credentialFor(workerId))) {
+		return nil, errUnknownWorker
+	}
+	return context.WithValue(ctx, workerIdKey{}, workerId), nil
+}
+
+func majorVersion(version string) string {
+	return strings.SplitN(version, ".", 2)[0]
+}
+
+// handshake checks the token and version of a worker and gives it an id.
+func handshake(hello *rpc.WorkerHello, address string) (*rpc.WorkerSession, error) {
+	if len(*workerToken) != 0 && subtle.ConstantTimeCompare([]byte(hello.Token), []byte(*workerToken)) != 1 {
+		return nil, status.Error(codes.Unauthenticated, "Wrong worker token")
+	}
+	if majorVersion(hello.Version) != majorVersion(service.Version) {
+		return nil, status.Errorf(codes.FailedPrecondition, "Worker version %q isn't compatible with Master version %s", hello.Version, service.Version)
+	}
+	operations := []string{}
+	for _, operation := range hello.Operations {
+		if validOperation(operation) {
+			operations = append(operations, operation)
+		}
+	}
+	if len(operations) == 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "None of the operations %v is valid", hello.Operations)
+	}
+
+	random := make([]byte, 8)
+	_, err := rand.Read(random)
+	if err != nil {
+		return nil, err
+	}
+	workerId := "w-" + hex.EncodeToString(random)
+	slog.Info("Worker shook hands", "worker", workerId, "name", hello.Name, "version", hello.Version, "address", address)
+	return &rpc.WorkerSession{
+		WorkerId:      workerId,
+		Credential:    credentialFor(workerId),
+		MasterVersion: service.Version,
+		Operations:    operations,
+	}, nil
+}
+
+func (masterServer) Handshake(ctx context.Context, request *rpc.WorkerHello) (*rpc.WorkerSession, error) {
+	address := ""
+	if client, ok := peer.FromContext(ctx); ok {
+		address = client.Addr.String()
+	}
+	return handshake(request, address)
+}
+
+// serveHandshake is the handshake over HTTP, with the WorkerHello and WorkerSession as JSON.
+func serveHandshake(w http.ResponseWriter, r *http.Request) error {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	hello := &rpc.WorkerHello{}
+	err = protojson.Unmarshal(data, hello)
+	if err != nil {
+		return service.WrongInput(err.Error())
+	}
+
+	session, err := handshake(hello, r.RemoteAddr)
+	if err != nil {
+		return err
+	}
+	data, err = protojson.Marshal(session)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+	return nil
+}
+
+// workerOnly lets only known workers through to the handler.
+func workerOnly(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := authenticateWorker(r.Context(), r.Header.Get(service.WorkerIdKey), r.Header.Get(service.WorkerCredentialKey))
+		if err != nil {
+			service.WriteError(w, err)
+			return
+		}
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// workerMetadata returns the worker id and credential sent with a gRPC call.
+func workerMetadata(ctx context.Context) (string, string) {
+	values, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if len(values.Get(key)) == 0 {
+			return ""
+		}
+		return values.Get(key)[0]
+	}
+	return first(service.WorkerIdKey), first(service.WorkerCredentialKey)
+}
+
+func workerAuthUnary(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !workerMethods[info.FullMethod] {
+		return handler(ctx, request)
+	}
+	workerId, credential := workerMetadata(ctx)
+	ctx, err := authenticateWorker(ctx, workerId, credential)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, request)
+}
+
+// workerStream carries the identity of the worker in the context of the stream.
+type workerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream workerStream) Context() context.Context {
+	return stream.ctx
+}
+
+func workerAuthStream(server interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !workerMethods[info.FullMethod] {
+		return handler(server, stream)
+	}
+	workerId, credential := workerMetadata(stream.Context())
+	ctx, err := authenticateWorker(stream.Context(), workerId, credential)
+	if err != nil {
+		return err
+	}
+	return handler(server, workerStream{ServerStream: stream, ctx: ctx})
+}
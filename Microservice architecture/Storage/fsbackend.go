@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FilesystemBackend keeps the blobs as files below a directory, the key being the relative path.
+type FilesystemBackend struct {
+	directory string
+}
+
+func NewFilesystemBackend(directory string) (*FilesystemBackend, error) {
+	for _, state := range []string{"working", "finished"} {
+		err := os.MkdirAll(filepath.Join(directory, state), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &FilesystemBackend{directory: directory}, nil
+}
+
+var errInvalidKey = errors.New("Error: Invalid storage key.")
+
+// path maps the key to a file below the directory. Keys which could point anywhere else are refused,
+// even though the handlers only ever build keys out of validated input.
+func (b *FilesystemBackend) path(key string) (string, error) {
+	if len(key) == 0 || strings.ContainsAny(key, "\\\x00") || path.IsAbs(key) || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return "", errInvalidKey
+	}
+	return filepath.Join(b.directory, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file first and renames it, so that readers never see half written blobs.
+func (b *FilesystemBackend) Put(key string, data []byte) error {
+	target, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(target), ".upload-")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	err = os.Rename(file.Name(), target)
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+func (b *FilesystemBackend) Get(key string) ([]byte, error) {
+	target, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(target)
+}
+
+func (b *FilesystemBackend) Stat(key string) (BlobInfo, error) {
+	target, err := b.path(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	return BlobInfo{Key: key, Size: info.Size(), Modified: info.ModTime()}, nil
+}
+
+func (b *FilesystemBackend) Delete(key string) error {
+	target, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// List only walks the directory of the prefix, as the directory may be shared, like the default /tmp. A directory
+// which doesn't exist holds no blobs.
+func (b *FilesystemBackend) List(prefix string) ([]BlobInfo, error) {
+	blobs := []BlobInfo{}
+	root := b.directory
+	if slash := strings.LastIndex(prefix, "/"); slash != -1 {
+		var err error
+		root, err = b.path(prefix[:slash])
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err := os.Stat(root)
+	if os.IsNotExist(err) {
+		return blobs, nil
+	}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".upload-") {
+			return nil
+		}
+		relative, err := filepath.Rel(b.directory, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relative)
+		if strings.HasPrefix(key, prefix) {
+			blobs = append(blobs, BlobInfo{Key: key, Size: info.Size(), Modified: info.ModTime()})
+		}
+		return nil
+	})
+	return blobs, err
+}
+
+func (b *FilesystemBackend) PresignGet(key string, expiry time.Duration) (string, error) {
+	return "", errPresignNotSupported
+}
+
+var errPresignNotSupported = errors.New("Error: The storage backend doesn't support pre-signed URLs.")
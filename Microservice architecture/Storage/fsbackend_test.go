@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilesystemListOnlyWalksThePrefix(t *testing.T) {
+	directory := t.TempDir()
+	backend, err := NewFilesystemBackend(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"working/1.png", "working/2.png", "finished/1.png"} {
+		err = backend.Put(key, []byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Something else sharing the directory, which can't be read.
+	unreadable := filepath.Join(directory, "other")
+	err = os.Mkdir(unreadable, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(unreadable, 0755)
+
+	blobs, err := backend.List("working/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 2 || blobs[0].Key != "working/1.png" || blobs[1].Key != "working/2.png" {
+		t.Fatalf("Listed %+v", blobs)
+	}
+
+	blobs, err = backend.List("staging/")
+	if err != nil || len(blobs) != 0 {
+		t.Fatalf("Listed %+v, %v in a missing directory", blobs, err)
+	}
+
+	_, err = backend.List("../")
+	if err == nil {
+		t.Fatal("Listed outside of the directory")
+	}
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"../rpc"
+	"../service"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// The gRPC interface of the images-store does the same as the HTTP one. Errors carry the status and code
+// of the service.Error, see rpc.Error.
+
+type imageStoreServer struct {
+	rpc.UnimplementedImageStoreServer
+}
+
+var imageStateNames = map[rpc.ImageState]string{
+	rpc.ImageState_IMAGE_STATE_STAGING:  "staging",
+	rpc.ImageState_IMAGE_STATE_WORKING:  "working",
+	rpc.ImageState_IMAGE_STATE_FINISHED: "finished",
+}
+
+// refValues turns the reference into the state and id parameters of the HTTP interface.
+func refValues(ref *rpc.ImageRef) url.Values {
+	values := url.Values{}
+	values.Set("state", imageStateNames[ref.GetState()])
+	if ref.GetState() == rpc.ImageState_IMAGE_STATE_STAGING {
+		values.Set("id", ref.GetToken())
+	} else {
+		values.Set("id", strconv.FormatInt(ref.GetId(), 10))
+	}
+	return values
+}
+
+func refToKey(ref *rpc.ImageRef) (ImageKey, error) {
+	values := refValues(ref)
+	key, keyErr := parseImageKey(values.Get("state"), values.Get("id"))
+	if keyErr != nil {
+		return ImageKey{}, grpcError(keyErr)
+	}
+	return key, nil
+}
+
+func grpcError(err error) error {
+	myError := service.ToError(err)
+	return rpc.Error(myError.Status, myError.Code, myError.Message)
+}
+
+func (imageStoreServer) UploadImage(stream grpc.ClientStreamingServer[rpc.UploadImageRequest, emptypb.Empty]) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	header := first.GetHeader()
+	if header == nil {
+		return grpcError(service.NewError(http.StatusBadRequest, "invalid_body", "The upload must start with the header."))
+	}
+	values := refValues(header.Image)
+	values.Set("exif", header.ExifPolicy)
+	values.Set("user", header.User)
+	_, _, err = validateUpload(values)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	data := bytes.Buffer{}
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		data.Write(request.GetChunk())
+		if int64(data.Len()) > maxUploadBytes {
+			return grpcError(errUploadTooLarge())
+		}
+	}
+
+	err = storeImage(stream.Context(), values, data.Bytes())
+	if err != nil {
+		return grpcError(err)
+	}
+	return stream.SendAndClose(&emptypb.Empty{})
+}
+
+func (imageStoreServer) DownloadImage(ref *rpc.ImageRef, stream grpc.ServerStreamingServer[rpc.ImageChunk]) error {
+	key, err := refToKey(ref)
+	if err != nil {
+		return err
+	}
+	data, err := loadImage(stream.Context(), key, true)
+	if err != nil {
+		return grpcError(err)
+	}
+	for len(data) > 0 {
+		size := rpc.ChunkSize
+		if len(data) < size {
+			size = len(data)
+		}
+		err = stream.Send(&rpc.ImageChunk{Data: data[:size]})
+		if err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+func (imageStoreServer) GetMetadata(ctx context.Context, ref *rpc.ImageRef) (*rpc.ImageMetadata, error) {
+	id, idErr := parseId(strconv.FormatInt(ref.GetId(), 10))
+	if idErr != nil {
+		return nil, grpcError(idErr)
+	}
+	metadata, err := findMetadata(ctx, id, true)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &rpc.ImageMetadata{Json: encoded}, nil
+}
+
+func (imageStoreServer) PresignImage(ctx context.Context, ref *rpc.ImageRef) (*rpc.PresignedImage, error) {
+	key, err := refToKey(ref)
+	if err != nil {
+		return nil, err
+	}
+	presigned, err := presign(key)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &rpc.PresignedImage{Url: presigned}, nil
+}
+
+func (imageStoreServer) PromoteImage(ctx context.Context, request *rpc.PromoteImageRequest) (*emptypb.Empty, error) {
+	err := promote(ctx, request.Token, strconv.FormatInt(request.Id, 10))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (imageStoreServer) DeleteImage(ctx context.Context, ref *rpc.ImageRef) (*emptypb.Empty, error) {
+	key, err := refToKey(ref)
+	if err != nil {
+		return nil, err
+	}
+	err = deleteEverywhere(ctx, key, true)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (imageStoreServer) GetUsage(ctx context.Context, request *emptypb.Empty) (*rpc.StorageUsage, error) {
+	usage := &rpc.StorageUsage{MaxBytes: retentionPolicy.MaxTotalBytes}
+	staged, err := backend.List("staging/")
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	for _, blob := range staged {
+		usage.StagedImages++
+		usage.StagedBytes += blob.Size
+	}
+	images, err := listStoredImages()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	for _, image := range images {
+		if image.state == "working" {
+			usage.WorkingImages++
+			usage.WorkingBytes += image.size
+		} else {
+			usage.FinishedImages++
+			usage.FinishedBytes += image.size
+		}
+	}
+	return usage, nil
+}
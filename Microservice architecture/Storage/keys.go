@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"net/http"
+	"regexp"
+
+	"../service"
+)
+
+// All the input of the images-store gets validated here, before it ever becomes part of a storage key.
+
+// Failures are service.Errors, sent to the clients as JSON, so that they can tell them apart by their code.
+
+// Ids are the decimal numbers handed out by the tasks-store. Only the canonical form is accepted,
+// so that "7", "07" and "+7" can't end up as different keys for the same task.
+var canonicalId = regexp.MustCompile(`^(0|[1-9][0-9]{0,17})$`)
+
+// Staging tokens are generated by the Master for uploads which don't have a task yet.
+var stagingToken = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Users are identified by their address, or whatever the Master passes along, so only allow what addresses consist of.
+var validUser = regexp.MustCompile(`^[A-Za-z0-9.:_@\-]{0,128}$`)
+
+// ImageKey identifies an image in the store. It can only be created from validated input.
+type ImageKey struct {
+	state string
+	id    string
+}
+
+func parseId(id string) (string, *service.Error) {
+	if !canonicalId.MatchString(id) {
+		return "", service.NewError(http.StatusBadRequest, "invalid_id", "The id must be a non-negative decimal number without leading zeros.")
+	}
+	return id, nil
+}
+
+func parseImageKey(state string, id string) (ImageKey, *service.Error) {
+	if state == "staging" {
+		if !stagingToken.MatchString(id) {
+			return ImageKey{}, service.NewError(http.StatusBadRequest, "invalid_id", "Staging ids must be 32 lowercase hexadecimal digits.")
+		}
+		return ImageKey{state: state, id: id}, nil
+	}
+	if state != "working" && state != "finished" {
+		return ImageKey{}, service.NewError(http.StatusBadRequest, "invalid_state", "The state must be staging, working or finished.")
+	}
+	id, err := parseId(id)
+	if err != nil {
+		return ImageKey{}, err
+	}
+	return ImageKey{state: state, id: id}, nil
+}
+
+func (k ImageKey) String() string {
+	return imageKey(k.state, k.id)
+}
+
+// metadataKey is where the metadata extracted from the image is kept.
+func (k ImageKey) metadataKey() string {
+	return k.state + "/" + k.id + ".json"
+}
+
+func validateUser(user string) *service.Error {
+	if !validUser.MatchString(user) {
+		return service.NewError(http.StatusBadRequest, "invalid_user", "The user may only consist of up to 128 letters, digits and the characters .:_@-")
+	}
+	return nil
+}
+
+func validateExifPolicy(policy string) (string, *service.Error) {
+	if len(policy) == 0 {
+		return exifKeep, nil
+	}
+	if !isValidExifPolicy(policy) {
+		return "", service.NewError(http.StatusBadRequest, "invalid_exif_policy", "The exif policy must be keep, nogps or strip.")
+	}
+	return policy, nil
+}
+
+// Limits for uploaded images. A small compressed file may decode into a huge bitmap, so the dimensions
+// get checked from the header, before anyone decodes the whole image.
+var maxUploadBytes int64
+var maxPixels int64
+var maxDimension int
+
+func checkImageDimensions(data []byte) (image.Config, string, *service.Error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return config, format, service.NewError(http.StatusBadRequest, "invalid_image", "Unsupported or broken image: "+err.Error())
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return config, format, service.NewError(http.StatusBadRequest, "invalid_image", "The image has no pixels.")
+	}
+	if config.Width > maxDimension || config.Height > maxDimension || int64(config.Width)*int64(config.Height) > maxPixels {
+		return config, format, service.NewError(http.StatusRequestEntityTooLarge, "image_too_large",
+			fmt.Sprintf("The image is %dx%d, at most %d pixels and %d pixels per side are allowed.", config.Width, config.Height, maxPixels, maxDimension))
+	}
+	return config, format, nil
+}
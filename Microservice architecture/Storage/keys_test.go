@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"../service"
+)
+
+// The handlers are fuzzed against a filesystem backend in a directory of its own. Next to it lies a file which no
+// request may ever reach, and nothing may be written outside of it.
+
+const secret = "not for the clients"
+
+func setupStore(t *testing.T) (root string, store string) {
+	root = t.TempDir()
+	store = filepath.Join(root, "store")
+	var err error
+	backend, err = NewFilesystemBackend(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicas = nil
+	selfAddress = ""
+	tombstones = make(map[string]time.Time)
+	err = os.WriteFile(filepath.Join(root, "secret.png"), []byte(secret), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, store
+}
+
+// checkConfined fails if anything besides the store and the secret turned up in the root.
+func checkConfined(t *testing.T, root string) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "store" && entry.Name() != "secret.png" {
+			t.Fatalf("%s was written outside of the store", entry.Name())
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(root, "secret.png"))
+	if err != nil || string(data) != secret {
+		t.Fatalf("The file outside of the store was changed: %q, %v", data, err)
+	}
+}
+
+// checkKey fails if the key of the image could point outside of the store.
+func checkKey(t *testing.T, key string) {
+	if path := filepath.Clean(filepath.FromSlash(key)); path != filepath.FromSlash(key) || filepath.IsAbs(path) || strings.HasPrefix(path, "..") {
+		t.Fatalf("The key %q leaves the store", key)
+	}
+}
+
+func validPng(t testing.TB) []byte {
+	out := &bytes.Buffer{}
+	err := png.Encode(out, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// pngHeader is the start of a PNG which claims the dimensions, enough for image.DecodeConfig.
+func pngHeader(width, height uint32) []byte {
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:], width)
+	binary.BigEndian.PutUint32(header[4:], height)
+	header[8] = 8 // Bit depth.
+	header[9] = 6 // RGBA.
+	chunk := append([]byte("IHDR"), header...)
+	out := []byte("\x89PNG\r\n\x1a\n")
+	out = binary.BigEndian.AppendUint32(out, uint32(len(header)))
+	out = append(out, chunk...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(chunk))
+}
+
+func FuzzParseId(f *testing.F) {
+	for _, seed := range []string{"0", "7", "07", "+7", "-1", "1e3", "../7", "7/..", "99999999999999999999", "", " 7", "7\x00"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, id string) {
+		parsed, err := parseId(id)
+		if err != nil {
+			return
+		}
+		if parsed != id || len(id) == 0 || strings.Trim(id, "0123456789") != "" || (len(id) > 1 && id[0] == '0') {
+			t.Fatalf("%q accepted as %q", id, parsed)
+		}
+		checkKey(t, imageKey("working", parsed))
+	})
+}
+
+func FuzzParseImageKey(f *testing.F) {
+	f.Add("working", "7")
+	f.Add("finished", "0")
+	f.Add("staging", "0123456789abcdef0123456789abcdef")
+	f.Add("staging", "../../../../../../../etc/passwd")
+	f.Add("../working", "7")
+	f.Add("working/..", "7")
+	f.Add("", "")
+	f.Fuzz(func(t *testing.T, state string, id string) {
+		key, err := parseImageKey(state, id)
+		if err != nil {
+			return
+		}
+		if key.state != "staging" && key.state != "working" && key.state != "finished" {
+			t.Fatalf("The state %q was accepted", state)
+		}
+		checkKey(t, key.String())
+		checkKey(t, key.metadataKey())
+	})
+}
+
+func FuzzReceiveImage(f *testing.F) {
+	f.Add("state=working&id=7", validPng(f))
+	f.Add("state=staging&id=0123456789abcdef0123456789abcdef&exif=strip", validPng(f))
+	f.Add("state=finished&id=3", validPng(f))
+	f.Add("state=working&id=7", pngHeader(100000, 100000))
+	f.Add("state=working&id=7", pngHeader(0, 0))
+	f.Add("state=working&id=7", pngHeader(1<<31, 1))
+	f.Add("state=working&id=7", []byte("not an image"))
+	f.Add("state=working&id=..%2F..%2Fsecret", validPng(f))
+	f.Add("state=..&id=secret", validPng(f))
+	f.Add("state=working&id=7&user=..%2F..", validPng(f))
+	f.Add("%zz", []byte{})
+	handler := service.Methods{http.MethodPost: receiveImage}
+	f.Fuzz(func(t *testing.T, query string, body []byte) {
+		root, _ := setupStore(t)
+		r := httptest.NewRequest(http.MethodPost, "/sendImage", bytes.NewReader(body))
+		r.URL.RawQuery = query
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code >= http.StatusInternalServerError {
+			t.Fatalf("%s answered %d: %s", query, w.Code, w.Body)
+		}
+		checkConfined(t, root)
+	})
+}
+
+func FuzzServeImage(f *testing.F) {
+	for _, seed := range []string{
+		"state=working&id=7",
+		"state=finished&id=7",
+		"state=staging&id=0123456789abcdef0123456789abcdef",
+		"state=working&id=..%2F..%2Fsecret",
+		"state=..&id=secret",
+		"state=working%2F..%2F..&id=secret",
+		"state=working&id=7&id=..",
+		"%zz",
+	} {
+		f.Add(seed)
+	}
+	handler := service.Methods{http.MethodGet: serveImage}
+	f.Fuzz(func(t *testing.T, query string) {
+		root, _ := setupStore(t)
+		err := backend.Put(imageKey("working", "7"), validPng(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodGet, "/getImage", nil)
+		r.URL.RawQuery = query
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code >= http.StatusInternalServerError {
+			t.Fatalf("%s answered %d: %s", query, w.Code, w.Body)
+		}
+		if strings.Contains(w.Body.String(), secret) {
+			t.Fatalf("%s served the file outside of the store", query)
+		}
+		checkConfined(t, root)
+	})
+}
@@ -0,0 +1,502 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"../service"
+)
+
+// Exif policies decide what happens to the metadata of the original image when the finished image is stored.
+const (
+	exifKeep  = "keep"  // Copy the EXIF block to the finished image.
+	exifNoGPS = "nogps" // Copy the EXIF block without the GPS data.
+	exifStrip = "strip" // Don't copy anything.
+)
+
+type GPSInfo = service.GPSInfo
+type ImageMetadata = service.ImageMetadata
+
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagExposureTime     = 0x829A
+	tagFNumber          = 0x829D
+	tagISO              = 0x8827
+	tagDateTimeOriginal = 0x9003
+	tagFocalLength      = 0x920A
+	tagGPSLatitudeRef   = 0x0001
+	tagGPSLatitude      = 0x0002
+	tagGPSLongitudeRef  = 0x0003
+	tagGPSLongitude     = 0x0004
+	tagGPSAltitudeRef   = 0x0005
+	tagGPSAltitude      = 0x0006
+)
+
+// Sizes of the TIFF field types, indexed by type id.
+var tiffTypeSize = []int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+func isValidExifPolicy(policy string) bool {
+	return policy == exifKeep || policy == exifNoGPS || policy == exifStrip
+}
+
+func metadataKey(id string) string {
+	return "working/" + id + ".json"
+}
+
+// extractMetadata reads the dimensions, format and color model of the image and whatever EXIF data it carries.
+func extractMetadata(data []byte) (ImageMetadata, error) {
+	config, format, checkErr := checkImageDimensions(data)
+	if checkErr != nil {
+		return ImageMetadata{}, checkErr
+	}
+
+	metadata := ImageMetadata{
+		Width:       config.Width,
+		Height:      config.Height,
+		Format:      format,
+		ColorModel:  colorModelName(config.ColorModel),
+		Orientation: 1,
+		ExifPolicy:  exifKeep,
+	}
+
+	exif := findExif(data)
+	if exif != nil {
+		// Broken EXIF data shouldn't make the image itself unusable, so we keep what we've got.
+		parseExif(exif, &metadata)
+	}
+
+	return metadata, nil
+}
+
+func colorModelName(model color.Model) string {
+	switch model {
+	case color.RGBAModel:
+		return "RGBA"
+	case color.RGBA64Model:
+		return "RGBA64"
+	case color.NRGBAModel:
+		return "NRGBA"
+	case color.NRGBA64Model:
+		return "NRGBA64"
+	case color.GrayModel:
+		return "Gray"
+	case color.Gray16Model:
+		return "Gray16"
+	case color.AlphaModel:
+		return "Alpha"
+	case color.Alpha16Model:
+		return "Alpha16"
+	case color.YCbCrModel:
+		return "YCbCr"
+	case color.CMYKModel:
+		return "CMYK"
+	}
+	if _, ok := model.(color.Palette); ok {
+		return "Paletted"
+	}
+	return "Unknown"
+}
+
+// findExif returns the TIFF structured EXIF block of a JPEG (APP1 segment) or PNG (eXIf chunk) file, or nil.
+func findExif(data []byte) []byte {
+	if len(data) > 2 && data[0] == 0xFF && data[1] == 0xD8 {
+		offset := 2
+		for offset+4 <= len(data) && data[offset] == 0xFF {
+			marker := data[offset+1]
+			if marker == 0xDA || marker == 0xD9 { // Start of scan or end of image, no more metadata.
+				return nil
+			}
+			length := int(binary.BigEndian.Uint16(data[offset+2:]))
+			if length < 2 || offset+2+length > len(data) {
+				return nil
+			}
+			segment := data[offset+4 : offset+2+length]
+			if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+				return segment[6:]
+			}
+			offset += 2 + length
+		}
+		return nil
+	}
+
+	if len(data) > 8 && string(data[:8]) == "\x89PNG\r\n\x1a\n" {
+		offset := 8
+		for offset+8 <= len(data) {
+			length := int(binary.BigEndian.Uint32(data[offset:]))
+			chunkType := string(data[offset+4 : offset+8])
+			if length < 0 || offset+12+length > len(data) {
+				return nil
+			}
+			if chunkType == "eXIf" {
+				return data[offset+8 : offset+8+length]
+			}
+			if chunkType == "IDAT" {
+				return nil
+			}
+			offset += 12 + length
+		}
+	}
+
+	return nil
+}
+
+type tiffEntry struct {
+	position int // Where the 12 byte entry starts.
+	tag      uint16
+	kind     uint16
+	count    uint32
+	data     []byte // The value of the entry, inline or not.
+	external int    // Offset of the value if it doesn't fit inline, otherwise -1.
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func newTiffReader(exif []byte) (*tiffReader, uint32, error) {
+	if len(exif) < 8 {
+		return nil, 0, errors.New("EXIF block too short")
+	}
+	reader := &tiffReader{data: exif}
+	switch string(exif[:2]) {
+	case "II":
+		reader.order = binary.LittleEndian
+	case "MM":
+		reader.order = binary.BigEndian
+	default:
+		return nil, 0, errors.New("Unknown EXIF byte order")
+	}
+	if reader.order.Uint16(exif[2:]) != 42 {
+		return nil, 0, errors.New("Wrong TIFF magic number")
+	}
+	return reader, reader.order.Uint32(exif[4:]), nil
+}
+
+func (t *tiffReader) readIFD(offset uint32) ([]tiffEntry, error) {
+	if int(offset)+2 > len(t.data) {
+		return nil, errors.New("IFD offset out of range")
+	}
+	count := int(t.order.Uint16(t.data[offset:]))
+	if int(offset)+2+count*12 > len(t.data) {
+		return nil, errors.New("IFD entries out of range")
+	}
+
+	entries := make([]tiffEntry, 0, count)
+	for i := 0; i < count; i++ {
+		position := int(offset) + 2 + i*12
+		entry := tiffEntry{
+			position: position,
+			tag:      t.order.Uint16(t.data[position:]),
+			kind:     t.order.Uint16(t.data[position+2:]),
+			count:    t.order.Uint32(t.data[position+4:]),
+			external: -1,
+		}
+		if int(entry.kind) >= len(tiffTypeSize) || entry.kind == 0 {
+			continue
+		}
+		size := tiffTypeSize[entry.kind] * int(entry.count)
+		if size < 0 || size > len(t.data) {
+			continue
+		}
+		if size <= 4 {
+			entry.data = t.data[position+8 : position+8+size]
+		} else {
+			valueOffset := int(t.order.Uint32(t.data[position+8:]))
+			if valueOffset+size > len(t.data) {
+				continue
+			}
+			entry.data = t.data[valueOffset : valueOffset+size]
+			entry.external = valueOffset
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (t *tiffReader) uint(entry tiffEntry) uint32 {
+	switch entry.kind {
+	case 1, 7:
+		if len(entry.data) >= 1 {
+			return uint32(entry.data[0])
+		}
+	case 3:
+		if len(entry.data) >= 2 {
+			return uint32(t.order.Uint16(entry.data))
+		}
+	case 4:
+		if len(entry.data) >= 4 {
+			return t.order.Uint32(entry.data)
+		}
+	}
+	return 0
+}
+
+func (t *tiffReader) rational(entry tiffEntry, index int) float64 {
+	if (entry.kind != 5 && entry.kind != 10) || len(entry.data) < (index+1)*8 {
+		return 0
+	}
+	numerator := t.order.Uint32(entry.data[index*8:])
+	denominator := t.order.Uint32(entry.data[index*8+4:])
+	if denominator == 0 {
+		return 0
+	}
+	if entry.kind == 10 {
+		return float64(int32(numerator)) / float64(int32(denominator))
+	}
+	return float64(numerator) / float64(denominator)
+}
+
+func (t *tiffReader) ascii(entry tiffEntry) string {
+	if entry.kind != 2 {
+		return ""
+	}
+	return string(bytes.TrimRight(entry.data, "\x00 "))
+}
+
+func (t *tiffReader) degrees(entry tiffEntry) float64 {
+	return t.rational(entry, 0) + t.rational(entry, 1)/60 + t.rational(entry, 2)/3600
+}
+
+func parseExif(exif []byte, metadata *ImageMetadata) error {
+	reader, ifdOffset, err := newTiffReader(exif)
+	if err != nil {
+		return err
+	}
+	entries, err := reader.readIFD(ifdOffset)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		switch entry.tag {
+		case tagMake:
+			metadata.CameraMake = reader.ascii(entry)
+		case tagModel:
+			metadata.CameraModel = reader.ascii(entry)
+		case tagOrientation:
+			if orientation := int(reader.uint(entry)); orientation >= 1 && orientation <= 8 {
+				metadata.Orientation = orientation
+			}
+		case tagExifIFD:
+			exifEntries, err := reader.readIFD(reader.uint(entry))
+			if err != nil {
+				continue
+			}
+			for _, exifEntry := range exifEntries {
+				switch exifEntry.tag {
+				case tagDateTimeOriginal:
+					metadata.DateTimeOriginal = reader.ascii(exifEntry)
+				case tagExposureTime:
+					metadata.ExposureTime = reader.rational(exifEntry, 0)
+				case tagFNumber:
+					metadata.FNumber = reader.rational(exifEntry, 0)
+				case tagISO:
+					metadata.ISO = int(reader.uint(exifEntry))
+				case tagFocalLength:
+					metadata.FocalLength = reader.rational(exifEntry, 0)
+				}
+			}
+		case tagGPSIFD:
+			gpsEntries, err := reader.readIFD(reader.uint(entry))
+			if err != nil {
+				continue
+			}
+			gps := GPSInfo{}
+			found := false
+			latitudeSign, longitudeSign, altitudeSign := 1.0, 1.0, 1.0
+			for _, gpsEntry := range gpsEntries {
+				switch gpsEntry.tag {
+				case tagGPSLatitudeRef:
+					if reader.ascii(gpsEntry) == "S" {
+						latitudeSign = -1
+					}
+				case tagGPSLatitude:
+					gps.Latitude = reader.degrees(gpsEntry)
+					found = true
+				case tagGPSLongitudeRef:
+					if reader.ascii(gpsEntry) == "W" {
+						longitudeSign = -1
+					}
+				case tagGPSLongitude:
+					gps.Longitude = reader.degrees(gpsEntry)
+					found = true
+				case tagGPSAltitudeRef:
+					if reader.uint(gpsEntry) == 1 {
+						altitudeSign = -1
+					}
+				case tagGPSAltitude:
+					gps.Altitude = reader.rational(gpsEntry, 0)
+				}
+			}
+			if found {
+				gps.Latitude *= latitudeSign
+				gps.Longitude *= longitudeSign
+				gps.Altitude *= altitudeSign
+				metadata.GPS = &gps
+			}
+		}
+	}
+
+	return nil
+}
+
+// prepareExifForOutput returns a copy of the EXIF block fit for the processed image.
+// The orientation is reset, as the worker already rotated the pixels, and the GPS data is erased if asked to.
+func prepareExifForOutput(exif []byte, removeGPS bool) ([]byte, error) {
+	out := make([]byte, len(exif))
+	copy(out, exif)
+
+	reader, ifdOffset, err := newTiffReader(out)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := reader.readIFD(ifdOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		switch entry.tag {
+		case tagOrientation:
+			if entry.kind == 3 && len(entry.data) >= 2 {
+				reader.order.PutUint16(entry.data, 1)
+			}
+		case tagGPSIFD:
+			if !removeGPS {
+				continue
+			}
+			gpsOffset := reader.uint(entry)
+			gpsEntries, err := reader.readIFD(gpsOffset)
+			if err == nil {
+				// Wipe the values themselves, not only the reference to them.
+				for _, gpsEntry := range gpsEntries {
+					if gpsEntry.external != -1 {
+						zero(gpsEntry.data)
+					}
+				}
+				gpsCount := int(reader.order.Uint16(out[gpsOffset:]))
+				zero(out[gpsOffset : int(gpsOffset)+2+gpsCount*12])
+			}
+			removeEntry(reader, ifdOffset, entry.position)
+		}
+	}
+
+	return out, nil
+}
+
+// removeEntry deletes a 12 byte entry from the IFD, moving the following entries and the next IFD offset up.
+func removeEntry(reader *tiffReader, ifdOffset uint32, position int) {
+	count := int(reader.order.Uint16(reader.data[ifdOffset:]))
+	end := int(ifdOffset) + 2 + count*12 + 4
+	if end > len(reader.data) {
+		end = len(reader.data)
+	}
+	copy(reader.data[position:], reader.data[position+12:end])
+	zero(reader.data[end-12 : end])
+	reader.order.PutUint16(reader.data[ifdOffset:], uint16(count-1))
+}
+
+func zero(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
+
+// insertPNGExif puts the EXIF block into an eXIf chunk right before the image data of a PNG file.
+func insertPNGExif(pngData []byte, exif []byte) ([]byte, error) {
+	if len(pngData) < 8 || string(pngData[:8]) != "\x89PNG\r\n\x1a\n" {
+		return nil, errors.New("Not a PNG file")
+	}
+
+	offset := 8
+	for offset+8 <= len(pngData) {
+		length := int(binary.BigEndian.Uint32(pngData[offset:]))
+		if string(pngData[offset+4:offset+8]) == "IDAT" {
+			chunk := make([]byte, 12+len(exif))
+			binary.BigEndian.PutUint32(chunk, uint32(len(exif)))
+			copy(chunk[4:], "eXIf")
+			copy(chunk[8:], exif)
+			binary.BigEndian.PutUint32(chunk[8+len(exif):], crc32.ChecksumIEEE(chunk[4:8+len(exif)]))
+
+			out := make([]byte, 0, len(pngData)+len(chunk))
+			out = append(out, pngData[:offset]...)
+			out = append(out, chunk...)
+			out = append(out, pngData[offset:]...)
+			return out, nil
+		}
+		offset += 12 + length
+	}
+
+	return nil, errors.New("No image data found in PNG file")
+}
+
+// saveMetadata extracts the metadata of a freshly uploaded image and stores it next to it.
+func saveMetadata(key ImageKey, data []byte, exifPolicy string, user string) (ImageMetadata, error) {
+	metadata, err := extractMetadata(data)
+	if err != nil {
+		return metadata, err
+	}
+	metadata.ExifPolicy = exifPolicy
+	metadata.User = user
+	if exifPolicy != exifKeep {
+		// The metadata is served with the job, the location mustn't get out through it either.
+		metadata.GPS = nil
+	}
+
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return metadata, err
+	}
+	return metadata, backend.Put(key.metadataKey(), encoded)
+}
+
+func loadMetadata(id string) (ImageMetadata, error) {
+	metadata := ImageMetadata{}
+	data, err := backend.Get(metadataKey(id))
+	if err != nil {
+		return metadata, err
+	}
+	err = json.Unmarshal(data, &metadata)
+	return metadata, err
+}
+
+// carryOverExif copies the EXIF data of the original image into the processed one, according to the policy of the task.
+func carryOverExif(id string, finished []byte) []byte {
+	metadata, err := loadMetadata(id)
+	if err != nil || metadata.ExifPolicy == exifStrip {
+		return finished
+	}
+
+	original, err := backend.Get(imageKey("working", id))
+	if err != nil {
+		return finished
+	}
+	exif := findExif(original)
+	if exif == nil {
+		return finished
+	}
+
+	exif, err = prepareExifForOutput(exif, metadata.ExifPolicy == exifNoGPS)
+	if err != nil {
+		return finished
+	}
+	withExif, err := insertPNGExif(finished, exif)
+	if err != nil {
+		return finished
+	}
+	return withExif
+}
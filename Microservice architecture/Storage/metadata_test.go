@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"../service"
+)
+
+// gpsExif is a little endian EXIF block with the camera make and a latitude of 52°30' south.
+func gpsExif() []byte {
+	out := &bytes.Buffer{}
+	entry := func(tag, kind uint16, count uint32, value []byte) {
+		binary.Write(out, binary.LittleEndian, tag)
+		binary.Write(out, binary.LittleEndian, kind)
+		binary.Write(out, binary.LittleEndian, count)
+		out.Write(value)
+	}
+	offset := func(value uint32) []byte {
+		return binary.LittleEndian.AppendUint32(nil, value)
+	}
+	out.WriteString("II*\x00")
+	out.Write(offset(8))
+	// IFD0 at 8, 2 entries, ends at 38. The make follows at 38, the GPS IFD at 44, its latitude at 74.
+	binary.Write(out, binary.LittleEndian, uint16(2))
+	entry(0x010F, 2, 6, offset(38))
+	entry(tagGPSIFD, 4, 1, offset(44))
+	out.Write(offset(0))
+	out.WriteString("Canon\x00")
+	binary.Write(out, binary.LittleEndian, uint16(2))
+	entry(tagGPSLatitudeRef, 2, 2, []byte("S\x00\x00\x00"))
+	entry(tagGPSLatitude, 5, 3, offset(74))
+	out.Write(offset(0))
+	binary.Write(out, binary.LittleEndian, []uint32{52, 1, 30, 1, 0, 1})
+	return out.Bytes()
+}
+
+// uploadedMetadata uploads the image with the EXIF policy and returns the metadata which the job is going to show.
+func uploadedMetadata(t *testing.T, image []byte, exifPolicy string) ImageMetadata {
+	r := httptest.NewRequest(http.MethodPost, "/sendImage?state=working&id=7&exif="+exifPolicy, bytes.NewReader(image))
+	w := httptest.NewRecorder()
+	service.Methods{http.MethodPost: receiveImage}.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("The upload answered %d: %s", w.Code, w.Body)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/getMetadata?id=7", nil)
+	w = httptest.NewRecorder()
+	service.Methods{http.MethodGet: serveMetadata}.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("The metadata answered %d: %s", w.Code, w.Body)
+	}
+	metadata := ImageMetadata{}
+	err := json.Unmarshal(w.Body.Bytes(), &metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata
+}
+
+func TestMetadataKeepsTheLocationOnlyIfAllowed(t *testing.T) {
+	setupStore(t)
+	image, err := insertPNGExif(validPng(t), gpsExif())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := uploadedMetadata(t, image, exifKeep)
+	if metadata.GPS == nil || metadata.GPS.Latitude != -52.5 {
+		t.Fatalf("The location was lost with %s: %+v", exifKeep, metadata.GPS)
+	}
+	for _, policy := range []string{exifNoGPS, exifStrip} {
+		metadata = uploadedMetadata(t, image, policy)
+		if metadata.GPS != nil {
+			t.Fatalf("The location %+v is shown with %s", *metadata.GPS, policy)
+		}
+		if metadata.CameraMake != "Canon" {
+			t.Fatalf("The rest of the metadata was lost with %s: %+v", policy, metadata)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"../metrics"
+)
+
+// The size of the store is taken from the backend when it's scraped, so it's right even after images were removed
+// by hand or by another replica's repair. Both gauges share one listing.
+
+var bytesStored = metrics.NewCounter("images_store_stored_bytes_total", "Bytes of images written to this replica, replicated ones included", "state")
+
+var measurement struct {
+	sync.Mutex
+	at     time.Time
+	sizes  map[string]float64
+	counts map[string]float64
+}
+
+func init() {
+	metrics.NewLabeledGaugeFunc("images_store_bytes", "Bytes of the images in the store", "state", func() map[string]float64 {
+		sizes, _ := storeSizes()
+		return sizes
+	})
+	metrics.NewLabeledGaugeFunc("images_store_images", "Images in the store", "state", func() map[string]float64 {
+		_, counts := storeSizes()
+		return counts
+	})
+}
+
+// storeSizes sums up the images of each state, at most once a second. Without a backend, or if it fails, it
+// returns nothing.
+func storeSizes() (map[string]float64, map[string]float64) {
+	measurement.Lock()
+	defer measurement.Unlock()
+	if time.Since(measurement.at) < time.Second {
+		return measurement.sizes, measurement.counts
+	}
+	sizes := map[string]float64{}
+	counts := map[string]float64{}
+	if backend == nil {
+		return sizes, counts
+	}
+	for _, state := range []string{"staging", "working", "finished"} {
+		blobs, err := backend.List(state + "/")
+		if err != nil {
+			slog.Warn("Couldn't measure the store", "err", err)
+			return map[string]float64{}, map[string]float64{}
+		}
+		sizes[state], counts[state] = 0, 0
+		for _, blob := range blobs {
+			if !strings.HasSuffix(blob.Key, ".png") {
+				continue
+			}
+			sizes[state] += float64(blob.Size)
+			counts[state]++
+		}
+	}
+	measurement.at = time.Now()
+	measurement.sizes, measurement.counts = sizes, counts
+	return sizes, counts
+}
@@ -0,0 +1,378 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"../httpclient"
+	"../service"
+)
+
+// Every images-store knows the whole replica set. An instance receiving an upload from a client stores it and forwards it
+// to its peers, the upload succeeds once a quorum of replicas has it. Requests between replicas carry "replicated=1",
+// so that they aren't forwarded again. They go through httpclient like the other calls between the services, and as
+// storing or deleting an image by its key is idempotent, they're retried as well.
+//
+// A replica remembers the images it deleted for a while. It refuses to get them back from a repair, and tells the
+// replicas repairing them that they're deleted, so that a replica which missed the delete removes its copy too. Only a
+// new upload from a client, which the peers get with "revive=1", brings an image back.
+
+var replicas []string // All the replicas, this one included.
+var selfAddress string
+var writeQuorum int
+var antiEntropyInterval time.Duration
+
+// Images deleted or removed by the garbage collector, so that the repairs don't bring them back from slower replicas.
+var tombstones = make(map[string]time.Time)
+var tombstonesMutex sync.Mutex
+
+const tombstoneLifetime = time.Hour
+
+type imageChecksum struct {
+	Id       int    `json:"id"`
+	State    string `json:"state"`
+	Checksum string `json:"checksum"`
+}
+
+func peers() []string {
+	result := []string{}
+	for _, replica := range replicas {
+		if replica != selfAddress {
+			result = append(result, replica)
+		}
+	}
+	return result
+}
+
+func checksumOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func localChecksum(state, id string) (string, error) {
+	data, err := backend.Get(imageKey(state, id))
+	if err != nil {
+		return "", err
+	}
+	return checksumOf(data), nil
+}
+
+func addTombstone(state, id string) {
+	tombstonesMutex.Lock()
+	tombstones[state+"/"+id] = time.Now()
+	tombstonesMutex.Unlock()
+}
+
+var errDeleted = service.NewError(http.StatusGone, "deleted", "The image was deleted.")
+
+func removeTombstone(state, id string) {
+	tombstonesMutex.Lock()
+	delete(tombstones, state+"/"+id)
+	tombstonesMutex.Unlock()
+}
+
+func isTombstoned(state, id string) bool {
+	tombstonesMutex.Lock()
+	defer tombstonesMutex.Unlock()
+	removed, ok := tombstones[state+"/"+id]
+	if ok && time.Since(removed) > tombstoneLifetime {
+		delete(tombstones, state+"/"+id)
+		return false
+	}
+	return ok
+}
+
+// peerURL is the URL of an endpoint of the peer.
+func peerURL(peer, path string) string {
+	return "http://" + peer + path
+}
+
+// replicateImage sends the image to all the peers and returns how many of them stored it.
+func replicateImage(ctx context.Context, values url.Values, data []byte) int {
+	forwarded := url.Values{}
+	for key := range values {
+		forwarded.Set(key, values.Get(key))
+	}
+	forwarded.Set("replicated", "1")
+	forwarded.Set("revive", "1")
+
+	successes := make(chan bool)
+	for _, peer := range peers() {
+		go func(peer string) {
+			response, err := sendToPeer(ctx, peerURL(peer, "/sendImage?"+forwarded.Encode()), "image", data)
+			if err != nil {
+				slog.WarnContext(ctx, "Replication failed", "peer", peer, "err", err)
+				successes <- false
+				return
+			}
+			if response.StatusCode != http.StatusOK {
+				slog.WarnContext(ctx, "Replication failed", "peer", peer, "status", response.StatusCode, "response", string(response.Body))
+				successes <- false
+				return
+			}
+			successes <- true
+		}(peer)
+	}
+
+	count := 0
+	for range peers() {
+		if <-successes {
+			count++
+		}
+	}
+	return count
+}
+
+// sendToPeer posts to a peer, retried like a read as the request stores or deletes by key.
+func sendToPeer(ctx context.Context, url string, contentType string, body []byte) (*httpclient.Response, error) {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	return httpclient.Default.Do(ctx, http.MethodPost, url, header, body, true)
+}
+
+func getFromPeer(ctx context.Context, peer, path string) ([]byte, error) {
+	response, err := httpclient.Get(ctx, peerURL(peer, path))
+	if err != nil {
+		return nil, err
+	}
+	data := response.Body
+	if response.StatusCode == http.StatusNotFound {
+		return nil, os.ErrNotExist
+	}
+	if response.StatusCode == http.StatusGone {
+		return nil, errDeleted
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.New("Error: " + peer + " responded: " + string(data))
+	}
+	return data, nil
+}
+
+// repairImage makes sure the local copy of the image agrees with the majority of the replicas.
+// The local copy is fixed by fetching a correct one and peers holding a wrong or no copy get it pushed.
+// An image which any replica deleted is removed instead, and errDeleted returned.
+func repairImage(ctx context.Context, state, id string) error {
+	peerList := peers()
+	if len(peerList) == 0 {
+		return nil
+	}
+	if isTombstoned(state, id) {
+		return errDeleted
+	}
+
+	checksums := make(map[string]string) // Replica address -> checksum, replicas without the image are left out.
+	local, err := localChecksum(state, id)
+	if err == nil {
+		checksums[selfAddress] = local
+	}
+
+	var checksumsMutex sync.Mutex
+	deleted := false
+	wg := sync.WaitGroup{}
+	wg.Add(len(peerList))
+	for _, peer := range peerList {
+		go func(peer string) {
+			defer wg.Done()
+			data, err := getFromPeer(ctx, peer, "/checksum?replicated=1&state="+state+"&id="+id)
+			checksumsMutex.Lock()
+			defer checksumsMutex.Unlock()
+			if err == errDeleted {
+				deleted = true
+			}
+			if err != nil {
+				return
+			}
+			checksums[peer] = string(data)
+		}(peer)
+	}
+	wg.Wait()
+
+	if deleted {
+		// This replica missed the delete.
+		key, keyErr := parseImageKey(state, id)
+		if keyErr != nil {
+			return keyErr
+		}
+		err = deleteEverywhere(ctx, key, false)
+		if err != nil {
+			return err
+		}
+		return errDeleted
+	}
+
+	if len(checksums) == 0 {
+		return os.ErrNotExist
+	}
+
+	votes := make(map[string]int)
+	for _, checksum := range checksums {
+		votes[checksum]++
+	}
+	majority := local
+	for checksum, count := range votes {
+		if count > votes[majority] {
+			majority = checksum
+		}
+	}
+
+	if local != majority {
+		err = pullImage(ctx, state, id, majority, checksums)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, peer := range peerList {
+		if checksums[peer] != majority {
+			go pushImage(context.WithoutCancel(ctx), state, id, peer)
+		}
+	}
+	return nil
+}
+
+// pullImage fetches the image with the given checksum from one of the peers having it and stores it locally.
+func pullImage(ctx context.Context, state, id, checksum string, checksums map[string]string) error {
+	for peer, peerChecksum := range checksums {
+		if peer == selfAddress || peerChecksum != checksum {
+			continue
+		}
+		data, err := getFromPeer(ctx, peer, "/getImage?replicated=1&state="+state+"&id="+id)
+		if err != nil || checksumOf(data) != checksum {
+			continue
+		}
+		if state == "working" {
+			metadata, err := getFromPeer(ctx, peer, "/getMetadata?replicated=1&id="+id)
+			if err == nil {
+				backend.Put(metadataKey(id), metadata)
+			}
+		}
+		slog.InfoContext(ctx, "Repaired an image", "state", state, "id", id, "peer", peer)
+		return backend.Put(imageKey(state, id), data)
+	}
+	return errors.New("Error: no replica could provide " + state + " " + id)
+}
+
+func pushImage(ctx context.Context, state, id, peer string) {
+	if isTombstoned(state, id) {
+		return
+	}
+	data, err := backend.Get(imageKey(state, id))
+	if err != nil {
+		return
+	}
+	values := url.Values{}
+	values.Set("state", state)
+	values.Set("id", id)
+	values.Set("replicated", "1")
+	if metadata, err := loadMetadata(id); err == nil {
+		values.Set("exif", metadata.ExifPolicy)
+		values.Set("user", metadata.User)
+	}
+
+	_, err = sendToPeer(ctx, peerURL(peer, "/sendImage?"+values.Encode()), "image", data)
+	if err != nil {
+		slog.WarnContext(ctx, "Repairing a peer failed", "peer", peer, "err", err)
+	}
+}
+
+// forwardDelete removes the image from all the peers, as far as they're reachable.
+func forwardDelete(ctx context.Context, key ImageKey) {
+	for _, peer := range peers() {
+		_, err := sendToPeer(ctx, peerURL(peer, "/deleteImage?replicated=1&state="+key.state+"&id="+key.id), "text/plain", nil)
+		if err != nil {
+			slog.WarnContext(ctx, "Deleting an image on a peer failed", "image", key.String(), "peer", peer, "err", err)
+		}
+	}
+}
+
+func serveChecksum(w http.ResponseWriter, r *http.Request) error {
+	key, err := requestedKey(r)
+	if err != nil {
+		return err
+	}
+	if isTombstoned(key.state, key.id) {
+		return errDeleted
+	}
+
+	checksum, err := localChecksum(key.state, key.id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(w, checksum)
+	return nil
+}
+
+func listChecksums(w http.ResponseWriter, r *http.Request) error {
+	images, err := listStoredImages()
+	if err != nil {
+		return err
+	}
+
+	result := []imageChecksum{}
+	for _, image := range images {
+		checksum, err := localChecksum(image.state, strconv.Itoa(image.id))
+		if err != nil {
+			continue
+		}
+		result = append(result, imageChecksum{Id: image.id, State: image.state, Checksum: checksum})
+	}
+
+	return service.WriteJSON(w, result)
+}
+
+func startAntiEntropy() {
+	for {
+		time.Sleep(antiEntropyInterval)
+		for _, peer := range peers() {
+			err := reconcileWithPeer(context.Background(), peer)
+			if err != nil {
+				slog.Warn("Anti-entropy failed", "peer", peer, "err", err)
+			}
+		}
+	}
+}
+
+// reconcileWithPeer compares the images of the peer with the local ones and repairs the ones which differ.
+func reconcileWithPeer(ctx context.Context, peer string) error {
+	data, err := getFromPeer(ctx, peer, "/listChecksums?replicated=1")
+	if err != nil {
+		return err
+	}
+	remote := []imageChecksum{}
+	err = json.Unmarshal(data, &remote)
+	if err != nil {
+		return err
+	}
+
+	for _, image := range remote {
+		key, keyErr := parseImageKey(image.State, strconv.Itoa(image.Id))
+		if keyErr != nil {
+			continue
+		}
+		id := key.id
+		if isTombstoned(image.State, id) {
+			continue
+		}
+		local, err := localChecksum(image.State, id)
+		if err == nil && local == image.Checksum {
+			continue
+		}
+		err = repairImage(ctx, image.State, id)
+		if err != nil && err != errDeleted {
+			slog.Warn("Repairing an image failed", "state", image.State, "id", id, "err", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"../service"
+)
+
+// fakePeer is a replica which holds one image and missed its delete, or deleted it when the image is nil.
+type fakePeer struct {
+	image []byte
+
+	mutex  sync.Mutex
+	pushed []string
+}
+
+func (peer *fakePeer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/checksum":
+		if peer.image == nil {
+			http.Error(w, "deleted", http.StatusGone)
+			return
+		}
+		w.Write([]byte(checksumOf(peer.image)))
+	case "/getImage":
+		w.Write(peer.image)
+	case "/getMetadata":
+		w.Write([]byte("{}"))
+	case "/sendImage":
+		peer.mutex.Lock()
+		peer.pushed = append(peer.pushed, r.URL.RawQuery)
+		peer.mutex.Unlock()
+	default:
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}
+}
+
+func setupReplicas(t *testing.T, peer *fakePeer) {
+	setupStore(t)
+	server := httptest.NewServer(peer)
+	t.Cleanup(server.Close)
+	selfAddress = "self.invalid"
+	replicas = []string{selfAddress, strings.TrimPrefix(server.URL, "http://")}
+	writeQuorum = 1
+	t.Cleanup(func() { replicas, selfAddress = nil, "" })
+}
+
+func call(handler func(http.ResponseWriter, *http.Request) error, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	service.Methods{method: handler}.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestReadingADeletedImageDoesntBringItBack(t *testing.T) {
+	image := validPng(t)
+	peer := &fakePeer{image: image}
+	setupReplicas(t, peer)
+	err := backend.Put(imageKey("working", "7"), image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := call(deleteImage, http.MethodPost, "/deleteImage?state=working&id=7")
+	if w.Code != http.StatusOK {
+		t.Fatalf("The delete answered %d: %s", w.Code, w.Body)
+	}
+	w = call(serveImage, http.MethodGet, "/getImage?state=working&id=7")
+	if w.Code == http.StatusOK {
+		t.Fatal("The deleted image was served")
+	}
+	_, err = backend.Stat(imageKey("working", "7"))
+	if err == nil {
+		t.Fatal("The deleted image was pulled from the peer")
+	}
+
+	// A repair pushing it from the peer is refused, a new upload isn't.
+	values := url.Values{"state": {"working"}, "id": {"7"}, "replicated": {"1"}}
+	err = storeImage(context.Background(), values, image)
+	if err != errDeleted {
+		t.Fatalf("A repair of the deleted image got %v", err)
+	}
+	values.Set("revive", "1")
+	err = storeImage(context.Background(), values, image)
+	if err != nil {
+		t.Fatalf("A new upload of the deleted image got %v", err)
+	}
+}
+
+func TestAReplicaWhichMissedTheDeleteRemovesItsCopy(t *testing.T) {
+	peer := &fakePeer{}
+	setupReplicas(t, peer)
+	err := backend.Put(imageKey("finished", "7"), validPng(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := call(serveImage, http.MethodGet, "/getImage?state=finished&id=7")
+	if w.Code == http.StatusOK {
+		t.Fatal("The image deleted on the peer was served")
+	}
+	_, err = backend.Stat(imageKey("finished", "7"))
+	if err == nil {
+		t.Fatal("The image deleted on the peer was kept")
+	}
+	peer.mutex.Lock()
+	defer peer.mutex.Unlock()
+	if len(peer.pushed) != 0 {
+		t.Fatalf("The image was pushed back to the peer: %v", peer.pushed)
+	}
+}
@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"../rpc"
+	"../service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetentionPolicy decides how long the images are kept around.
+type RetentionPolicy struct {
+	MaxAge                   time.Duration // Images older than this get removed, unless a task in the queue needs them. Zero means forever.
+	MaxTotalBytes            int64         // Images no task needs get removed, oldest first, while the store is bigger than this. Zero means no limit.
+	DeleteWorkingAfterFinish bool          // Remove the original image once the task is finished.
+	UserQuota                int64         // Bytes a single user may occupy. Zero means no limit.
+	OrphanGracePeriod        time.Duration // How long an image may exist without a task, as the upload precedes the task registration.
+	GCInterval               time.Duration
+}
+
+var retentionPolicy RetentionPolicy
+var taskStore rpc.TaskStoreClient
+
+// quota holds the bytes each user stores, so that an upload is checked without going through the store. It's built
+// on the first upload and rebuilt by every garbage collection, the uploads in between are added as they come. The
+// uploads without a user share the quota of a single anonymous user.
+var quota struct {
+	sync.Mutex
+	usage map[string]int64
+}
+
+type storedImage struct {
+	id       int
+	state    string
+	size     int64
+	modified time.Time
+}
+
+var errUnknownTask = errors.New("Unknown task")
+
+// listStoredImages returns all the images in the store, oldest first.
+func listStoredImages() ([]storedImage, error) {
+	images := []storedImage{}
+	for _, state := range []string{"working", "finished"} {
+		blobs, err := backend.List(state + "/")
+		if err != nil {
+			return nil, err
+		}
+		for _, blob := range blobs {
+			name := strings.TrimPrefix(blob.Key, state+"/")
+			if !strings.HasSuffix(name, ".png") {
+				continue
+			}
+			id, err := strconv.Atoi(strings.TrimSuffix(name, ".png"))
+			if err != nil {
+				continue
+			}
+			images = append(images, storedImage{
+				id:       id,
+				state:    state,
+				size:     blob.Size,
+				modified: blob.Modified,
+			})
+		}
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].modified.Before(images[j].modified)
+	})
+	return images, nil
+}
+
+// removeImage deletes the image and, once neither of the two images of a task is left, its metadata too.
+func removeImage(image storedImage) error {
+	id := strconv.Itoa(image.id)
+	err := backend.Delete(imageKey(image.state, id))
+	if err != nil {
+		return err
+	}
+
+	addTombstone(image.state, id)
+	_, errWorking := backend.Stat(imageKey("working", id))
+	_, errFinished := backend.Stat(imageKey("finished", id))
+	if os.IsNotExist(errWorking) && os.IsNotExist(errFinished) {
+		return backend.Delete(metadataKey(id))
+	}
+	return nil
+}
+
+// usageByUser sums up the sizes of the images uploaded by each user, processed ones included.
+func usageByUser() (map[string]int64, error) {
+	images, err := listStoredImages()
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make(map[int]string)
+	usage := make(map[string]int64)
+	for _, image := range images {
+		owner, ok := owners[image.id]
+		if !ok {
+			metadata, err := loadMetadata(strconv.Itoa(image.id))
+			if err == nil {
+				owner = metadata.User
+			}
+			owners[image.id] = owner
+		}
+		usage[owner] += image.size
+	}
+	return usage, nil
+}
+
+// rebuildQuota counts the usage of the users in the store again.
+func rebuildQuota() error {
+	usage, err := usageByUser()
+	if err != nil {
+		return err
+	}
+	quota.Lock()
+	quota.usage = usage
+	quota.Unlock()
+	return nil
+}
+
+// reserveQuota counts the upload against the quota of the user, if it still fits. The returned function gives the
+// bytes back, for an upload which couldn't be stored.
+func reserveQuota(user string, size int64) (func(), error) {
+	quota.Lock()
+	built := quota.usage != nil
+	quota.Unlock()
+	if !built {
+		err := rebuildQuota()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	quota.Lock()
+	defer quota.Unlock()
+	if quota.usage[user]+size > retentionPolicy.UserQuota {
+		return nil, service.NewError(http.StatusForbidden, "quota_exceeded", "Quota exceeded.")
+	}
+	quota.usage[user] += size
+	return func() {
+		quota.Lock()
+		quota.usage[user] -= size
+		quota.Unlock()
+	}, nil
+}
+
+func getTaskInfo(id int) (*rpc.Task, error) {
+	myTask, err := taskStore.GetTask(context.Background(), &rpc.TaskId{Id: int64(id)})
+	if status.Code(err) == codes.NotFound {
+		return nil, errUnknownTask
+	}
+	return myTask, err
+}
+
+func startGarbageCollector() {
+	for {
+		time.Sleep(retentionPolicy.GCInterval)
+		err := collectGarbage()
+		if err != nil {
+			slog.Warn("Garbage collection failed", "err", err)
+		}
+	}
+}
+
+// unneeded tells whether no task is going to read the image anymore: it's finished, or its task is over.
+func unneeded(image storedImage, task *rpc.Task) bool {
+	return image.state == "finished" || task.State == rpc.TaskState_TASK_STATE_FINISHED ||
+		task.State == rpc.TaskState_TASK_STATE_FAILED
+}
+
+// collectGarbage reconciles the stored images with the tasks in the database and applies the retention policy.
+func collectGarbage() error {
+	if taskStore == nil {
+		client, err := config.TaskStore(context.Background())
+		if err != nil {
+			return err
+		}
+		taskStore = client
+	}
+
+	images, err := listStoredImages()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	kept := []storedImage{}
+	tasks := make(map[int]*rpc.Task)
+	removed := 0
+
+	// Staged uploads are promoted within a single request, the ones left behind come from aborted submissions.
+	staged, err := backend.List("staging/")
+	if err != nil {
+		return err
+	}
+	for _, blob := range staged {
+		if now.Sub(blob.Modified) > retentionPolicy.OrphanGracePeriod {
+			err = backend.Delete(blob.Key)
+			if err != nil {
+				return err
+			}
+			removed++
+		}
+	}
+
+	for _, image := range images {
+		task, ok := tasks[image.id]
+		if !ok {
+			task, err = getTaskInfo(image.id)
+			if err == errUnknownTask {
+				task = &rpc.Task{Id: -1}
+			} else if err != nil {
+				// Better keep the image than remove one which belongs to a task.
+				return err
+			}
+			tasks[image.id] = task
+		}
+
+		remove := false
+		switch {
+		case task.Id == -1 && now.Sub(image.modified) > retentionPolicy.OrphanGracePeriod:
+			remove = true
+		case task.State == rpc.TaskState_TASK_STATE_FAILED && task.Attempts == 0:
+			// The submission of the task failed, nobody is going to process it. When the processing failed, the image
+			// is kept to look into what went wrong, as long as the policy allows.
+			remove = true
+		case retentionPolicy.MaxAge > 0 && now.Sub(image.modified) > retentionPolicy.MaxAge && (unneeded(image, task) || task.Id == -1):
+			// The originals of the tasks still in the queue are kept however old, or the tasks would fail.
+			remove = true
+		case retentionPolicy.DeleteWorkingAfterFinish && image.state == "working" && task.State == rpc.TaskState_TASK_STATE_FINISHED:
+			remove = true
+		}
+
+		if remove {
+			err = removeImage(image)
+			if err != nil {
+				return err
+			}
+			removed++
+		} else {
+			kept = append(kept, image)
+		}
+	}
+
+	if retentionPolicy.MaxTotalBytes > 0 {
+		var total int64
+		for _, image := range kept {
+			total += image.size
+		}
+		// The originals are still needed by the tasks in the queue, only the other images may go to make room.
+		for _, image := range kept {
+			if total <= retentionPolicy.MaxTotalBytes {
+				break
+			}
+			if !unneeded(image, tasks[image.id]) {
+				continue
+			}
+			err = removeImage(image)
+			if err != nil {
+				return err
+			}
+			total -= image.size
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		slog.Info("Garbage collection removed images", "removed", removed)
+	}
+	if retentionPolicy.UserQuota > 0 {
+		return rebuildQuota()
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"../rpc"
+	"../service"
+)
+
+// fakeTaskStore knows the states of some tasks, the others don't exist.
+type fakeTaskStore struct {
+	rpc.TaskStoreClient
+	states map[int64]rpc.TaskState
+}
+
+func (store fakeTaskStore) GetTask(ctx context.Context, id *rpc.TaskId, options ...grpc.CallOption) (*rpc.Task, error) {
+	state, ok := store.states[id.Id]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "no such task")
+	}
+	return &rpc.Task{Id: id.Id, State: state, Attempts: 1}, nil
+}
+
+// putOld stores an image which is two hours old.
+func putOld(t *testing.T, key string) {
+	err := backend.Put(key, validPng(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := backend.(*FilesystemBackend).path(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	err = os.Chtimes(path, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxAgeKeepsTheOriginalsOfQueuedTasks(t *testing.T) {
+	setupStore(t)
+	taskStore = fakeTaskStore{states: map[int64]rpc.TaskState{
+		1: rpc.TaskState_TASK_STATE_NOT_STARTED,
+		2: rpc.TaskState_TASK_STATE_IN_PROGRESS,
+		3: rpc.TaskState_TASK_STATE_FINISHED,
+		4: rpc.TaskState_TASK_STATE_FAILED,
+	}}
+	defer func() { taskStore = nil }()
+	retentionPolicy = RetentionPolicy{MaxAge: time.Hour, OrphanGracePeriod: 3 * time.Hour}
+	defer func() { retentionPolicy = RetentionPolicy{} }()
+
+	for _, key := range []string{"working/1", "working/2", "working/3", "finished/3", "working/4", "working/5"} {
+		putOld(t, key+".png")
+	}
+	err := collectGarbage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, kept := range map[string]bool{
+		"working/1":  true,
+		"working/2":  true,
+		"working/3":  false,
+		"finished/3": false,
+		"working/4":  false,
+		"working/5":  false, // Of no task at all.
+	} {
+		_, err := backend.Stat(key + ".png")
+		if kept && err != nil {
+			t.Errorf("%s was removed: %v", key, err)
+		} else if !kept && err == nil {
+			t.Errorf("%s was kept", key)
+		}
+	}
+}
+
+func TestQuotaCountsAnonymousUploadsTogether(t *testing.T) {
+	setupStore(t)
+	image := validPng(t)
+	retentionPolicy = RetentionPolicy{UserQuota: int64(2 * len(image))}
+	defer func() { retentionPolicy = RetentionPolicy{} }()
+	quota.usage = nil
+
+	upload := func(id, user string) error {
+		return storeImage(context.Background(), url.Values{"state": {"working"}, "id": {id}, "user": {user}}, image)
+	}
+	for _, id := range []string{"1", "2"} {
+		err := upload(id, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := upload("3", "")
+	if serviceErr, ok := err.(*service.Error); !ok || serviceErr.Code != "quota_exceeded" {
+		t.Fatalf("A third anonymous upload got %v", err)
+	}
+	err = upload("3", "alice")
+	if err != nil {
+		t.Fatalf("The quota of another user was used up: %v", err)
+	}
+
+	// A garbage collection counts the store again, with the removed images gone.
+	err = backend.Delete(imageKey("working", "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rebuildQuota()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = upload("4", "")
+	if err != nil {
+		t.Fatalf("The removed image still counts: %v", err)
+	}
+}
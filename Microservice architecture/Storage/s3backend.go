@@ -0,0 +1,337 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Backend keeps the blobs in a bucket of an S3 compatible object storage (AWS S3, MinIO, ...).
+// Requests are signed with AWS Signature Version 4 and use path style addressing, which every implementation supports.
+type S3Backend struct {
+	endpoint  *url.URL // Like http://127.0.0.1:9000
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	partSize  int // Blobs bigger than this are uploaded in parts. S3 requires at least 5MB per part.
+	client    *http.Client
+}
+
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+func NewS3Backend(endpoint, region, bucket, accessKey, secretKey string, partSize int) (*S3Backend, error) {
+	parsedEndpoint, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if parsedEndpoint.Scheme != "http" && parsedEndpoint.Scheme != "https" {
+		return nil, errors.New("Error: The S3 endpoint must be an http or https URL.")
+	}
+	if len(bucket) == 0 || len(accessKey) == 0 || len(secretKey) == 0 {
+		return nil, errors.New("Error: The S3 backend needs a bucket, an access key and a secret key.")
+	}
+	if partSize < 5*1024*1024 {
+		return nil, errors.New("Error: The S3 part size must be at least 5MB.")
+	}
+	return &S3Backend{
+		endpoint:  parsedEndpoint,
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		partSize:  partSize,
+		client:    &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do sends a signed request and returns the response body, failing on any non 2xx status.
+func (b *S3Backend) do(method, key string, query url.Values, body []byte) ([]byte, *http.Response, error) {
+	request, err := http.NewRequest(method, b.objectURL(key, query), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	request.ContentLength = int64(len(body))
+	b.sign(request, body, time.Now().UTC())
+
+	response, err := b.client.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, response, os.ErrNotExist
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		failure := s3Error{}
+		xml.Unmarshal(data, &failure)
+		return nil, response, fmt.Errorf("Error: S3 %s %s failed with %s: %s %s", method, key, response.Status, failure.Code, failure.Message)
+	}
+	return data, response, nil
+}
+
+func (b *S3Backend) objectURL(key string, query url.Values) string {
+	target := *b.endpoint
+	target.Path = "/" + b.bucket
+	if len(key) != 0 {
+		target.Path += "/" + key
+	}
+	target.RawPath = uriEncode(target.Path, false)
+	target.RawQuery = canonicalQuery(query)
+	return target.String()
+}
+
+func (b *S3Backend) Put(key string, data []byte) error {
+	if len(data) > b.partSize {
+		return b.putMultipart(key, data)
+	}
+	_, _, err := b.do(http.MethodPut, key, nil, data)
+	return err
+}
+
+type initiateMultipartUploadResult struct {
+	UploadId string `xml:"UploadId"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+func (b *S3Backend) putMultipart(key string, data []byte) error {
+	response, _, err := b.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	initiated := initiateMultipartUploadResult{}
+	err = xml.Unmarshal(response, &initiated)
+	if err != nil {
+		return err
+	}
+
+	err = b.uploadParts(key, initiated.UploadId, data)
+	if err != nil {
+		// Don't leave the already uploaded parts lying around in the bucket.
+		b.do(http.MethodDelete, key, url.Values{"uploadId": {initiated.UploadId}}, nil)
+		return err
+	}
+	return nil
+}
+
+func (b *S3Backend) uploadParts(key, uploadId string, data []byte) error {
+	complete := completeMultipartUpload{}
+	for offset, partNumber := 0, 1; offset < len(data); offset, partNumber = offset+b.partSize, partNumber+1 {
+		end := offset + b.partSize
+		if end > len(data) {
+			end = len(data)
+		}
+		query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadId}}
+		_, response, err := b.do(http.MethodPut, key, query, data[offset:end])
+		if err != nil {
+			return err
+		}
+		complete.Parts = append(complete.Parts, completedPart{PartNumber: partNumber, ETag: response.Header.Get("ETag")})
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	response, _, err := b.do(http.MethodPost, key, url.Values{"uploadId": {uploadId}}, body)
+	if err != nil {
+		return err
+	}
+	// S3 may report a failure of the completion with a 200 status code.
+	if bytes.Contains(response, []byte("<Error>")) {
+		return errors.New("Error: S3 multipart upload completion failed: " + string(response))
+	}
+	return nil
+}
+
+func (b *S3Backend) Get(key string) ([]byte, error) {
+	data, _, err := b.do(http.MethodGet, key, nil, nil)
+	return data, err
+}
+
+func (b *S3Backend) Stat(key string) (BlobInfo, error) {
+	_, response, err := b.do(http.MethodHead, key, nil, nil)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	modified, _ := http.ParseTime(response.Header.Get("Last-Modified"))
+	return BlobInfo{Key: key, Size: response.ContentLength, Modified: modified}, nil
+}
+
+func (b *S3Backend) Delete(key string) error {
+	_, _, err := b.do(http.MethodDelete, key, nil, nil)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (b *S3Backend) List(prefix string) ([]BlobInfo, error) {
+	blobs := []BlobInfo{}
+	continuationToken := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if len(continuationToken) != 0 {
+			query.Set("continuation-token", continuationToken)
+		}
+		response, _, err := b.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		result := listBucketResult{}
+		err = xml.Unmarshal(response, &result)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			blobs = append(blobs, BlobInfo{Key: object.Key, Size: object.Size, Modified: object.LastModified})
+		}
+		if !result.IsTruncated {
+			return blobs, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+// PresignGet returns a URL which lets anyone download the blob until it expires, without any credentials.
+func (b *S3Backend) PresignGet(key string, expiry time.Duration) (string, error) {
+	now := time.Now().UTC()
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", b.accessKey+"/"+b.scope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	request, err := http.NewRequest(http.MethodGet, b.objectURL(key, query), nil)
+	if err != nil {
+		return "", err
+	}
+	signature := b.signature(request, []string{"host"}, unsignedPayload, now)
+	return request.URL.String() + "&X-Amz-Signature=" + signature, nil
+}
+
+// sign adds the Signature Version 4 authorization header to the request.
+func (b *S3Backend) sign(request *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	request.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	request.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	signature := b.signature(request, signedHeaders, hex.EncodeToString(payloadHash[:]), now)
+	request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+b.accessKey+"/"+b.scope(now)+
+		", SignedHeaders="+strings.Join(signedHeaders, ";")+", Signature="+signature)
+}
+
+func (b *S3Backend) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + b.region + "/s3/aws4_request"
+}
+
+func (b *S3Backend) signature(request *http.Request, signedHeaders []string, payloadHash string, now time.Time) string {
+	canonicalHeaders := ""
+	for _, header := range signedHeaders {
+		value := request.Header.Get(header)
+		if header == "host" {
+			value = request.URL.Host
+		}
+		canonicalHeaders += header + ":" + strings.TrimSpace(value) + "\n"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		uriEncode(request.URL.Path, false),
+		canonicalQuery(request.URL.Query()),
+		canonicalHeaders,
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + b.scope(now) + "\n" + hex.EncodeToString(canonicalRequestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+b.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, b.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery sorts and encodes the query the way Signature Version 4 expects it.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := []string{}
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode escapes everything but the unreserved characters, slashes only if asked to.
+func uriEncode(value string, encodeSlash bool) string {
+	encoded := strings.Builder{}
+	for _, c := range []byte(value) {
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
@@ -1,137 +1,438 @@
-package main
+package storage
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"io/ioutil"
 	"os"
 	"net/url"
-	"io"
-	"strconv"
+	"strings"
+	"time"
+	"context"
+
+	"../rpc"
+	"../service"
 )
 
-func main() {
-	if !registerInKVStore() {
-		return
+var config *service.ConfigStore
+var backend Backend
+var presignExpiry time.Duration
+
+// Backend is where the images-store keeps its blobs. The keys look like "working/3.png".
+type Backend interface {
+	Put(key string, data []byte) error
+	// Get returns an error satisfying os.IsNotExist if there's no such blob.
+	Get(key string) ([]byte, error)
+	Stat(key string) (BlobInfo, error)
+	// Delete doesn't fail if there's no such blob.
+	Delete(key string) error
+	List(prefix string) ([]BlobInfo, error)
+	// PresignGet returns a URL which allows downloading the blob directly from the backend, if it supports it.
+	PresignGet(key string, expiry time.Duration) (string, error)
+}
+
+type BlobInfo struct {
+	Key      string
+	Size     int64
+	Modified time.Time
+}
+
+func init() {
+	flag.DurationVar(&retentionPolicy.MaxAge, "max-age", 0, "Remove images older than this. Zero keeps them forever.")
+	flag.Int64Var(&retentionPolicy.MaxTotalBytes, "max-bytes", 0, "Remove the oldest finished images while the store is bigger than this. Zero means no limit.")
+	flag.BoolVar(&retentionPolicy.DeleteWorkingAfterFinish, "delete-working-after-finish", false, "Remove the original image once its task is finished.")
+	flag.Int64Var(&retentionPolicy.UserQuota, "user-quota", 0, "Bytes a single user may store. Zero means no limit.")
+	flag.DurationVar(&retentionPolicy.OrphanGracePeriod, "orphan-grace", time.Minute*10, "Remove images without a task after this long.")
+	flag.DurationVar(&retentionPolicy.GCInterval, "gc-interval", time.Minute, "How often the garbage collector runs.")
+	flag.DurationVar(&presignExpiry, "presign-expiry", time.Minute*15, "How long pre-signed download URLs stay valid.")
+	flag.Int64Var(&maxUploadBytes, "max-upload-bytes", 20*1024*1024, "Biggest accepted upload.")
+	flag.Int64Var(&maxPixels, "max-pixels", 50*1000*1000, "Most pixels an image may have, to keep decompression bombs out.")
+	flag.IntVar(&maxDimension, "max-dimension", 16384, "Biggest accepted width or height of an image.")
+	flag.IntVar(&writeQuorum, "write-quorum", 0, "Replicas which must store an upload for it to succeed. Zero means a majority.")
+	flag.DurationVar(&antiEntropyInterval, "anti-entropy-interval", time.Minute, "How often the replicas get compared with each other.")
+}
+
+var backendName = flag.String("backend", "fs", "Where to keep the images: fs or s3.")
+var dataDirectory = flag.String("dir", "/tmp", "Directory holding the working and finished images, for the fs backend.")
+var s3Endpoint = flag.String("s3-endpoint", "http://127.0.0.1:9000", "URL of the S3 compatible object storage.")
+var s3Region = flag.String("s3-region", "us-east-1", "Region of the S3 bucket.")
+var s3Bucket = flag.String("s3-bucket", "images", "Bucket holding the images.")
+var s3AccessKey = flag.String("s3-access-key", os.Getenv("AWS_ACCESS_KEY_ID"), "S3 access key, AWS_ACCESS_KEY_ID by default.")
+var s3SecretKey = flag.String("s3-secret-key", os.Getenv("AWS_SECRET_ACCESS_KEY"), "S3 secret key, AWS_SECRET_ACCESS_KEY by default.")
+var s3PartSize = flag.Int("s3-part-size", 5*1024*1024, "Images bigger than this are uploaded to S3 in parts.")
+var replicaList = flag.String("replicas", "", "Comma separated addresses of all the images-store replicas, this one included. Empty means no replication.")
+
+// Main runs an images-store replica. The args are its address and the one of the config store.
+func Main(args []string) {
+	selfAddress = args[0]
+	replicas = []string{selfAddress}
+	if len(*replicaList) != 0 {
+		replicas = strings.Split(*replicaList, ",")
+	}
+	if writeQuorum == 0 {
+		writeQuorum = len(replicas)/2 + 1
+	}
+	if writeQuorum > len(replicas) {
+		service.Fatal(errors.New("Error: The write quorum can't be bigger than the replica count."))
+	}
+
+	myService := service.New("images-store", selfAddress, args[1])
+	config = myService.Config
+	// All the replicas register the same list, the clients fail over between them.
+	err := config.Set(context.Background(), service.ImageStoreKey, strings.Join(replicas, ","))
+	if err != nil {
+		service.Fatal(err)
+	}
+
+	switch *backendName {
+	case "fs":
+		backend, err = NewFilesystemBackend(*dataDirectory)
+	case "s3":
+		backend, err = NewS3Backend(*s3Endpoint, *s3Region, *s3Bucket, *s3AccessKey, *s3SecretKey, *s3PartSize)
+	default:
+		err = errors.New("Error: Unknown backend " + *backendName)
+	}
+	if err != nil {
+		service.Fatal(err)
+	}
+
+	go startGarbageCollector()
+	if len(replicas) > 1 {
+		go startAntiEntropy()
+	}
+
+	myService.Handle("/sendImage", service.Methods{http.MethodPost: receiveImage})
+	myService.Handle("/getImage", service.Methods{http.MethodGet: serveImage})
+	myService.Handle("/getMetadata", service.Methods{http.MethodGet: serveMetadata})
+	myService.Handle("/checksum", service.Methods{http.MethodGet: serveChecksum})
+	myService.Handle("/listChecksums", service.Methods{http.MethodGet: listChecksums})
+	myService.Handle("/presign", service.Methods{http.MethodGet: presignImage})
+	myService.Handle("/promote", service.Methods{http.MethodPost: promoteImage})
+	myService.Handle("/deleteImage", service.Methods{http.MethodPost: deleteImage, http.MethodDelete: deleteImage})
+	rpc.RegisterImageStoreServer(myService.EnableGrpc(), imageStoreServer{})
+	err = myService.Run()
+	if err != nil {
+		service.Fatal(err)
 	}
-	http.HandleFunc("/sendImage", receiveImage)
-	http.HandleFunc("/getImage", serveImage)
-	http.ListenAndServe(":3002", nil)
 }
 
-func receiveImage(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		values, err := url.ParseQuery(r.URL.RawQuery)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
-		if len(values.Get("id")) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:","Wrong input id.")
-			return
-		}
-		if values.Get("state") != "working" && values.Get("state") != "finished" {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:","Wrong input state.")
-			return
+func imageKey(state, id string) string {
+	return state + "/" + id + ".png"
+}
+
+// requestedKey returns the image the state and id parameters of the request refer to.
+func requestedKey(r *http.Request) (ImageKey, error) {
+	values, err := service.Query(r)
+	if err != nil {
+		return ImageKey{}, err
+	}
+	key, keyErr := parseImageKey(values.Get("state"), values.Get("id"))
+	if keyErr != nil {
+		return ImageKey{}, keyErr
+	}
+	return key, nil
+}
+
+func receiveImage(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+	_, _, err = validateUpload(values)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadBytes))
+	if err != nil {
+		if _, ok := err.(*http.MaxBytesError); ok {
+			return errUploadTooLarge()
 		}
-		_, err = strconv.Atoi(values.Get("id"))
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:","Wrong input id.")
-			return
+		return service.NewError(http.StatusBadRequest, "invalid_body", err.Error())
+	}
+
+	err = storeImage(r.Context(), values, data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(w, "success")
+	return nil
+}
+
+func errUploadTooLarge() *service.Error {
+	return service.NewError(http.StatusRequestEntityTooLarge, "upload_too_large", fmt.Sprintf("Uploads may be at most %d bytes.", maxUploadBytes))
+}
+
+// validateUpload checks the parameters of an upload: state, id, exif and user.
+func validateUpload(values url.Values) (ImageKey, string, error) {
+	key, keyErr := parseImageKey(values.Get("state"), values.Get("id"))
+	if keyErr != nil {
+		return ImageKey{}, "", keyErr
+	}
+	exifPolicy, policyErr := validateExifPolicy(values.Get("exif"))
+	if policyErr != nil {
+		return ImageKey{}, "", policyErr
+	}
+	if userErr := validateUser(values.Get("user")); userErr != nil {
+		return ImageKey{}, "", userErr
+	}
+	return key, exifPolicy, nil
+}
+
+// storeImage stores an upload, described by the parameters of validateUpload. Uploads which aren't marked
+// as replicated are passed on to the other replicas.
+func storeImage(ctx context.Context, values url.Values, data []byte) (err error) {
+	key, exifPolicy, err := validateUpload(values)
+	if err != nil {
+		return err
+	}
+	_, _, dimensionsErr := checkImageDimensions(data)
+	if dimensionsErr != nil {
+		return dimensionsErr
+	}
+
+	isReplica := len(values.Get("replicated")) != 0
+	if !isReplica || len(values.Get("revive")) != 0 {
+		removeTombstone(key.state, key.id)
+	} else if isTombstoned(key.state, key.id) {
+		// A repair of a peer which missed the delete.
+		return errDeleted
+	}
+
+	if key.state == "working" || key.state == "staging" {
+		if retentionPolicy.UserQuota > 0 && !isReplica {
+			var release func()
+			release, err = reserveQuota(values.Get("user"), int64(len(data)))
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err != nil {
+					release()
+				}
+			}()
 		}
 
-		file, err := os.Create("/tmp/" + values.Get("state") + "/" + values.Get("id") + ".png")
-		defer file.Close()
+		_, err = saveMetadata(key, data, exifPolicy, values.Get("user"))
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
+			return err
 		}
+	} else if !isReplica {
+		data = carryOverExif(key.id, data)
+	}
 
-		_, err = io.Copy(file, r.Body)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
+	err = backend.Put(key.String(), data)
+	if err != nil {
+		return err
+	}
+	bytesStored.Add(float64(len(data)), key.state)
+
+	if !isReplica && len(replicas) > 1 {
+		stored := 1 + replicateImage(ctx, values, data)
+		if stored < writeQuorum {
+			return service.NewError(http.StatusServiceUnavailable, "quorum_not_reached", fmt.Sprintf("Stored on %d of %d required replicas.", stored, writeQuorum))
 		}
+	}
+	return nil
+}
 
-		fmt.Fprint(w, "success")
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only POST accepted")
+func serveImage(w http.ResponseWriter, r *http.Request) error {
+	key, err := requestedKey(r)
+	if err != nil {
+		return err
+	}
+
+	data, err := loadImage(r.Context(), key, len(r.URL.Query().Get("replicated")) == 0)
+	if err != nil {
+		return err
 	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Write(data)
+	return nil
 }
 
-func serveImage(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		values, err := url.ParseQuery(r.URL.RawQuery)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
-		if len(values.Get("id")) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:","Wrong input id.")
-			return
-		}
-		if values.Get("state") != "working" && values.Get("state") != "finished" {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:","Wrong input state.")
-			return
-		}
-		_, err = strconv.Atoi(values.Get("id"))
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:","Wrong input id.")
-			return
+// loadImage returns the image, after checking it against the other replicas unless it's a replica asking.
+func loadImage(ctx context.Context, key ImageKey, repair bool) ([]byte, error) {
+	if repair {
+		err := repairImage(ctx, key.state, key.id)
+		if err != nil && err != errDeleted {
+			// Serve whatever we've got locally.
+			slog.Warn("Repairing an image failed", "image", key.String(), "err", err)
 		}
+	}
+	return backend.Get(key.String())
+}
 
-		file, err := os.Open("/tmp/" + values.Get("state") + "/" + values.Get("id") + ".png")
-		defer file.Close()
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
+func serveMetadata(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+	id, idErr := parseId(values.Get("id"))
+	if idErr != nil {
+		return idErr
+	}
 
-		_, err = io.Copy(w, file)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
+	metadata, err := findMetadata(r.Context(), id, len(values.Get("replicated")) == 0)
+	if err != nil {
+		return err
+	}
+
+	return service.WriteJSON(w, metadata)
+}
+
+// findMetadata returns the metadata of the image, fetching the image from the other replicas if it's missing here.
+func findMetadata(ctx context.Context, id string, repair bool) (ImageMetadata, error) {
+	metadata, err := loadMetadata(id)
+	if err != nil && repair {
+		// The image may only have reached the other replicas.
+		repairImage(ctx, "working", id)
+		metadata, err = loadMetadata(id)
+	}
+	return metadata, err
+}
+
+func presignImage(w http.ResponseWriter, r *http.Request) error {
+	key, err := requestedKey(r)
+	if err != nil {
+		return err
+	}
+
+	presigned, err := presign(key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(w, presigned)
+	return nil
+}
+
+func presign(key ImageKey) (string, error) {
+	_, err := backend.Stat(key.String())
+	if err != nil {
+		return "", err
+	}
+
+	presigned, err := backend.PresignGet(key.String(), presignExpiry)
+	if err == errPresignNotSupported {
+		return "", service.NewError(http.StatusNotImplemented, "presign_not_supported", err.Error())
+	}
+	return presigned, err
+}
+
+// promoteImage turns a staged upload into the working image of a task, once the task exists.
+func promoteImage(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+
+	err = promote(r.Context(), values.Get("token"), values.Get("id"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(w, "success")
+	return nil
+}
+
+func promote(ctx context.Context, token string, id string) error {
+	staged, keyErr := parseImageKey("staging", token)
+	if keyErr != nil {
+		return keyErr
+	}
+	working, keyErr := parseImageKey("working", id)
+	if keyErr != nil {
+		return keyErr
+	}
+
+	data, err := backend.Get(staged.String())
+	if os.IsNotExist(err) {
+		// The upload may only have reached the other replicas.
+		repairImage(ctx, staged.state, staged.id)
+		data, err = backend.Get(staged.String())
+	}
+	if err != nil {
+		return err
+	}
+	metadata, err := backend.Get(staged.metadataKey())
+	if err != nil {
+		return err
+	}
+
+	err = backend.Put(working.metadataKey(), metadata)
+	if err != nil {
+		return err
+	}
+	err = backend.Put(working.String(), data)
+	if err != nil {
+		return err
+	}
+
+	if len(replicas) > 1 {
+		// The peers get the working image the same way as any other upload.
+		replicated := url.Values{}
+		replicated.Set("state", working.state)
+		replicated.Set("id", working.id)
+		if stagedMetadata, err := loadMetadata(working.id); err == nil {
+			replicated.Set("exif", stagedMetadata.ExifPolicy)
+			replicated.Set("user", stagedMetadata.User)
+		}
+		stored := 1 + replicateImage(ctx, replicated, data)
+		if stored < writeQuorum {
+			return service.NewError(http.StatusServiceUnavailable, "quorum_not_reached", fmt.Sprintf("Stored on %d of %d required replicas.", stored, writeQuorum))
 		}
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only GET accepted")
 	}
+
+	// Leftovers of the staged upload are harmless, the garbage collector removes them eventually.
+	removeBlobs(staged)
+	if len(replicas) > 1 {
+		go forwardDelete(context.WithoutCancel(ctx), staged)
+	}
+	return nil
 }
 
-func registerInKVStore() bool {
-	if len(os.Args) < 3 {
-		fmt.Println("Error: Too few arguments.")
-		return false
+// deleteImage removes an image and its metadata, on all the replicas.
+func deleteImage(w http.ResponseWriter, r *http.Request) error {
+	key, err := requestedKey(r)
+	if err != nil {
+		return err
 	}
-	storageAddress := os.Args[1] // The address of itself
-	keyValueStoreAddress := os.Args[2]
 
-	response, err := http.Post("http://" + keyValueStoreAddress + "/set?key=storageAddress&value=" + storageAddress, "", nil)
+	err = deleteEverywhere(r.Context(), key, len(r.URL.Query().Get("replicated")) == 0)
 	if err != nil {
-		fmt.Println(err)
-		return false
+		return err
 	}
-	data, err := ioutil.ReadAll(response.Body)
+
+	fmt.Fprint(w, "success")
+	return nil
+}
+
+// deleteEverywhere removes the image here and, unless it's a replica asking, on the other replicas.
+func deleteEverywhere(ctx context.Context, key ImageKey, forward bool) error {
+	err := removeBlobs(key)
+	if err != nil {
+		return err
+	}
+	addTombstone(key.state, key.id)
+	if forward && len(replicas) > 1 {
+		forwardDelete(ctx, key)
+	}
+	return nil
+}
+
+func removeBlobs(key ImageKey) error {
+	err := backend.Delete(key.String())
 	if err != nil {
-		fmt.Println(err)
-		return false
+		return err
 	}
-	if response.StatusCode != http.StatusOK {
-		fmt.Println("Error: Failure when contacting key-value store: ", string(data))
-		return false
+	if key.state == "finished" {
+		return nil // The metadata belongs to the working image.
 	}
-	return true
-}
\ No newline at end of file
+	return backend.Delete(key.metadataKey())
+}
@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"../rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// A task the worker couldn't process is reported to the Master with an error code. Transient failures, like an
+// unreachable images-store, let another worker try again. Permanent ones, like an image which can't be decoded,
+// fail the task right away.
+
+type taskError struct {
+	code      string
+	err       error
+	transient bool
+}
+
+func (e *taskError) Error() string {
+	return e.code + ": " + e.err.Error()
+}
+
+func permanentError(code string, err error) error {
+	return &taskError{code: code, err: err}
+}
+
+// storageError classifies an error of the images-store. Only a missing image won't get better with another attempt.
+func storageError(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return &taskError{code: "image_missing", err: err}
+	}
+	return &taskError{code: "storage_unavailable", err: err, transient: true}
+}
+
+// reportFailure tells the Master why the task failed. Other errors, like a failure to report the finished task, leave
+// the task to the timeout of the tasks-store.
+func reportFailure(ctx context.Context, myTask *rpc.Task, err error) {
+	failure, ok := err.(*taskError)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err = master.FailTask(ctx, &rpc.FailTaskRequest{
+		Id:        myTask.Id,
+		Code:      failure.code,
+		Message:   failure.err.Error(),
+		Transient: failure.transient,
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "Couldn't report the failure of a task", "job", myTask.Id, "err", err)
+	}
+}
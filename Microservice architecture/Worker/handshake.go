@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"../rpc"
+	"../service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Before it takes any task, the worker shakes hands with the Master. It gets a worker id and a credential, which go
+// along with all its calls from then on.
+
+var token = flag.String("token", os.Getenv("WORKER_TOKEN"), "Shared secret of the workers, $WORKER_TOKEN by default")
+
+// session implements credentials.PerRPCCredentials with the result of the handshake.
+type session struct {
+	mutex sync.Mutex
+	*rpc.WorkerSession
+}
+
+var mySession = &session{WorkerSession: &rpc.WorkerSession{}}
+
+func (s *session) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.WorkerId) == 0 {
+		return nil, nil
+	}
+	return map[string]string{service.WorkerIdKey: s.WorkerId, service.WorkerCredentialKey: s.Credential}, nil
+}
+
+func (s *session) RequireTransportSecurity() bool {
+	return false
+}
+
+func (s *session) operations() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.Operations
+}
+
+// renewSession shakes hands again when the Master doesn't know the worker, like a new leader without a
+// -worker-token, and repeats the call once with the new session.
+func renewSession(ctx context.Context, method string, request, reply interface{}, conn *grpc.ClientConn, invoker grpc.UnaryInvoker, options ...grpc.CallOption) error {
+	workerId := currentWorkerId()
+	err := invoker(ctx, method, request, reply, conn, options...)
+	if status.Code(err) != codes.Unauthenticated || method == rpc.Master_Handshake_FullMethodName {
+		return err
+	}
+	renew(workerId)
+	return invoker(ctx, method, request, reply, conn, options...)
+}
+
+var renewing sync.Mutex
+
+// renew shakes hands again, unless another call did so since the session of the worker id was refused.
+func renew(workerId string) {
+	renewing.Lock()
+	defer renewing.Unlock()
+	if currentWorkerId() != workerId {
+		return
+	}
+	slog.Warn("The Master doesn't know the worker, shaking hands again", "worker", workerId)
+	shakeHands()
+}
+
+func currentWorkerId() string {
+	mySession.mutex.Lock()
+	defer mySession.mutex.Unlock()
+	return mySession.WorkerId
+}
+
+// shakeHands registers the worker with the Master, trying again until the Master answers. A refusal ends the worker.
+func shakeHands() {
+	hostname, _ := os.Hostname()
+	hello := &rpc.WorkerHello{
+		Name:       hostname + "/" + strconv.Itoa(os.Getpid()),
+		Version:    service.Version,
+		Operations: supportedOperations(),
+		Token:      *token,
+	}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		result, err := master.Handshake(ctx, hello)
+		cancel()
+		switch status.Code(err) {
+		case codes.OK:
+			mySession.mutex.Lock()
+			mySession.WorkerSession = result
+			mySession.mutex.Unlock()
+			slog.Info("Registered", "worker", result.WorkerId, "masterVersion", result.MasterVersion)
+			return
+		case codes.Unauthenticated, codes.FailedPrecondition:
+			service.Fatal(err)
+		}
+		slog.Warn("Handshake failed", "err", err, "delay", retryDelay.Get())
+		time.Sleep(retryDelay.Get())
+	}
+}
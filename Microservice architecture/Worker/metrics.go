@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"../metrics"
+	"../rpc"
+)
+
+// The throughput of the worker, how long its tasks take, and the state of its pool. They're served on the -listen
+// address.
+
+// processingBuckets reach further than the ones of requests, a large image takes its time.
+var processingBuckets = []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120}
+
+var tasksProcessed = metrics.NewCounter("worker_tasks_total", "Tasks the worker took on, by whether it finished them, failed or released them", "operation", "result")
+var taskDuration = metrics.NewHistogram("worker_task_duration_seconds", "Time taken by a task, from the download of the image to the upload of the result", processingBuckets, "operation")
+var operationDuration = metrics.NewHistogram("worker_operation_duration_seconds", "Time taken by the operation on the decoded image", processingBuckets, "operation")
+
+func init() {
+	metrics.NewLabeledGaugeFunc("worker_pool_threads", "Tasks the pool allows at once, min, max and target, and the ones active", "kind", func() map[string]float64 {
+		if workerPool == nil {
+			return nil
+		}
+		myStatus := workerPool.status()
+		return map[string]float64{"min": float64(myStatus.Min), "max": float64(myStatus.Max), "target": float64(myStatus.Target), "active": float64(myStatus.Active)}
+	})
+	metrics.NewGaugeFunc("worker_pool_utilisation", "Share of the maximum thread count in use, averaged over about a minute", func() float64 {
+		if workerPool == nil {
+			return 0
+		}
+		return workerPool.status().Utilisation
+	})
+	metrics.NewLabeledGaugeFunc("worker_memory_bytes", "Memory budget of the decoded images, and the bytes reserved of it", "kind", func() map[string]float64 {
+		if workerPool == nil {
+			return nil
+		}
+		myStatus := workerPool.status()
+		return map[string]float64{"budget": float64(myStatus.MemoryBudget), "reserved": float64(myStatus.MemoryReserved)}
+	})
+}
+
+func operationLabel(myTask *rpc.Task) string {
+	if len(myTask.Operation) == 0 {
+		return builtinOperation
+	}
+	return myTask.Operation
+}
@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"image"
+
+	"../service"
+)
+
+type ImageMetadata = service.ImageMetadata
+
+// applyOrientation turns the image upright according to its EXIF orientation tag (1-8).
+// Orientations 5 to 8 swap the width and the height.
+func applyOrientation(myImage image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return myImage
+	}
+
+	bounds := myImage.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	outWidth, outHeight := width, height
+	if orientation >= 5 {
+		outWidth, outHeight = height, width
+	}
+	myCanvas := image.NewRGBA(image.Rect(0, 0, outWidth, outHeight))
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			var outX, outY int
+			switch orientation {
+			case 2: // Mirrored horizontally.
+				outX, outY = width-1-x, y
+			case 3: // Rotated 180°.
+				outX, outY = width-1-x, height-1-y
+			case 4: // Mirrored vertically.
+				outX, outY = x, height-1-y
+			case 5: // Mirrored along the top-left to bottom-right diagonal.
+				outX, outY = y, x
+			case 6: // Rotated 90° clockwise to be upright.
+				outX, outY = height-1-y, x
+			case 7: // Mirrored along the top-right to bottom-left diagonal.
+				outX, outY = height-1-y, width-1-x
+			case 8: // Rotated 90° counter-clockwise to be upright.
+				outX, outY = y, width-1-x
+			}
+			myCanvas.Set(outX, outY, myImage.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	return myCanvas
+}
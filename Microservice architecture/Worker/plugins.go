@@ -0,0 +1,283 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Besides the built-in swapChannels the worker runs plugins: executables in a subdirectory of -plugins, each with a
+// manifest.json declaring the operation it implements and its parameters. A plugin runs in a temporary directory of
+// its own, which is removed afterwards, with nothing of the worker's environment but PATH. It gets the image as PNG
+// on stdin and in the file $PLUGIN_INPUT, the parameters as JSON in $PLUGIN_PARAMETERS, and writes the result to the
+// file $PLUGIN_OUTPUT or to stdout. A plugin failing or running over its timeout fails the task, with the end of its
+// stderr as the error message. WebAssembly plugins are declared with a module instead of a command, see wasm.go.
+
+var pluginsDir = flag.String("plugins", "", "Directory with a subdirectory per plugin")
+
+const builtinOperation = "swapChannels"
+
+const defaultPluginTimeout = time.Minute
+
+// maxStderr is how much of the end of a plugin's stderr goes into the error of the task.
+const maxStderr = 4 << 10
+
+type pluginParameter struct {
+	Type     string          `json:"type"` // string, number, integer or boolean.
+	Required bool            `json:"required"`
+	Default  json.RawMessage `json:"default"`
+}
+
+type pluginManifest struct {
+	Operation  string                     `json:"operation"`
+	Command    []string                   `json:"command"`  // Relative to the directory of the plugin.
+	Module     string                     `json:"module"`   // A WebAssembly module, instead of a command.
+	Memory     int                        `json:"memory"`   // MiB a module may use.
+	MaxCalls   int64                      `json:"maxCalls"` // Function calls a module may make per task.
+	Timeout    string                     `json:"timeout"`  // e.g. "30s", a minute by default.
+	Parameters map[string]pluginParameter `json:"parameters"`
+
+	dir     string
+	timeout time.Duration
+	module  *wasmModule
+}
+
+// Operation -> plugin.
+var plugins = map[string]*pluginManifest{}
+
+// loadPlugins reads the manifests in the plugins directory. A broken plugin ends the worker, so it's noticed.
+func loadPlugins() error {
+	if len(*pluginsDir) == 0 {
+		return nil
+	}
+	entries, err := ioutil.ReadDir(*pluginsDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir, err := filepath.Abs(filepath.Join(*pluginsDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		plugin, err := readManifest(dir)
+		if err != nil {
+			return fmt.Errorf("Error: Plugin %s: %v", entry.Name(), err)
+		}
+		if plugin.Operation == builtinOperation || plugins[plugin.Operation] != nil {
+			return fmt.Errorf("Error: Plugin %s: operation %s is already taken", entry.Name(), plugin.Operation)
+		}
+		plugins[plugin.Operation] = plugin
+		slog.Info("Loaded plugin", "operation", plugin.Operation, "dir", dir)
+	}
+	return nil
+}
+
+func readManifest(dir string) (*pluginManifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	plugin := &pluginManifest{dir: dir, timeout: defaultPluginTimeout}
+	err = json.Unmarshal(data, plugin)
+	if err != nil {
+		return nil, err
+	}
+	if len(plugin.Operation) == 0 || (len(plugin.Command) == 0) == (len(plugin.Module) == 0) {
+		return nil, errors.New("the manifest needs an operation and either a command or a module")
+	}
+	if len(plugin.Timeout) != 0 {
+		plugin.timeout, err = time.ParseDuration(plugin.Timeout)
+		if err != nil || plugin.timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", plugin.Timeout)
+		}
+	}
+	for name, parameter := range plugin.Parameters {
+		if len(parameter.Default) != 0 && !parameter.accepts(parameter.Default) {
+			return nil, fmt.Errorf("the default of parameter %s isn't of type %s", name, parameter.Type)
+		}
+	}
+	if len(plugin.Module) != 0 {
+		err = loadModule(plugin)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return plugin, nil
+}
+
+// supportedOperations returns the built-in operation and those of the plugins.
+func supportedOperations() []string {
+	operations := []string{builtinOperation}
+	for operation := range plugins {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations[1:])
+	return operations
+}
+
+func (parameter pluginParameter) accepts(value json.RawMessage) bool {
+	var decoded interface{}
+	if json.Unmarshal(value, &decoded) != nil {
+		return false
+	}
+	switch parameter.Type {
+	case "string":
+		_, ok := decoded.(string)
+		return ok
+	case "number":
+		_, ok := decoded.(float64)
+		return ok
+	case "integer":
+		number, ok := decoded.(float64)
+		return ok && number == float64(int64(number))
+	case "boolean":
+		_, ok := decoded.(bool)
+		return ok
+	}
+	return false
+}
+
+// checkParameters validates the parameters of a task against the manifest and fills in the defaults.
+func (plugin *pluginManifest) checkParameters(parameters []byte) ([]byte, error) {
+	values := map[string]json.RawMessage{}
+	if len(parameters) != 0 {
+		err := json.Unmarshal(parameters, &values)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range values {
+		parameter, ok := plugin.Parameters[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown parameter %s", name)
+		}
+		if !parameter.accepts(value) {
+			return nil, fmt.Errorf("parameter %s must be of type %s", name, parameter.Type)
+		}
+	}
+	for name, parameter := range plugin.Parameters {
+		if _, ok := values[name]; ok {
+			continue
+		}
+		if parameter.Required {
+			return nil, fmt.Errorf("parameter %s is missing", name)
+		}
+		if len(parameter.Default) != 0 {
+			values[name] = parameter.Default
+		}
+	}
+	return json.Marshal(values)
+}
+
+// run passes the image through the plugin.
+func (plugin *pluginManifest) run(myImage image.Image, parameters []byte) (image.Image, error) {
+	parameters, err := plugin.checkParameters(parameters)
+	if err != nil {
+		return nil, permanentError("invalid_parameters", err)
+	}
+	if plugin.module != nil {
+		return plugin.runModule(myImage, parameters)
+	}
+
+	sandbox, err := ioutil.TempDir("", "plugin-"+plugin.Operation+"-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(sandbox)
+
+	input := bytes.Buffer{}
+	err = png.Encode(&input, myImage)
+	if err != nil {
+		return nil, permanentError("processing_failed", err)
+	}
+	inputPath := filepath.Join(sandbox, "input.png")
+	outputPath := filepath.Join(sandbox, "output.png")
+	err = ioutil.WriteFile(inputPath, input.Bytes(), 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), plugin.timeout)
+	defer cancel()
+	command := plugin.Command[0]
+	if !filepath.IsAbs(command) && strings.ContainsRune(command, filepath.Separator) {
+		command = filepath.Join(plugin.dir, command)
+	}
+	cmd := exec.CommandContext(ctx, command, plugin.Command[1:]...)
+	cmd.Dir = sandbox
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + sandbox,
+		"TMPDIR=" + sandbox,
+		"PLUGIN_INPUT=" + inputPath,
+		"PLUGIN_OUTPUT=" + outputPath,
+		"PLUGIN_PARAMETERS=" + string(parameters),
+	}
+	cmd.Stdin = &input
+	stdout := bytes.Buffer{}
+	stderr := tailBuffer{limit: maxStderr}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait forever for children of the plugin which hold on to its output.
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, permanentError("plugin_timeout", fmt.Errorf("%s ran longer than %v%s", plugin.Operation, plugin.timeout, stderr.suffix()))
+	}
+	if err != nil {
+		return nil, permanentError("plugin_failed", fmt.Errorf("%s: %v%s", plugin.Operation, err, stderr.suffix()))
+	}
+
+	result, err := ioutil.ReadFile(outputPath)
+	if os.IsNotExist(err) {
+		result, err = stdout.Bytes(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	resultImage, _, err := image.Decode(bytes.NewReader(result))
+	if err != nil {
+		return nil, permanentError("plugin_failed", fmt.Errorf("%s returned no image: %v%s", plugin.Operation, err, stderr.suffix()))
+	}
+	return resultImage, nil
+}
+
+// tailBuffer keeps the last limit bytes written to it.
+type tailBuffer struct {
+	limit int
+	data  []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	if len(b.data) > b.limit {
+		b.data = b.data[len(b.data)-b.limit:]
+	}
+	return len(p), nil
+}
+
+// suffix is the stderr to append to an error message, if there is any.
+func (b *tailBuffer) suffix() string {
+	text := strings.TrimSpace(string(b.data))
+	if len(text) == 0 {
+		return ""
+	}
+	return ": " + text
+}
@@ -0,0 +1,289 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"../metrics"
+	"../service"
+)
+
+// The worker pool runs between a minimum and a maximum of tasks at once. Every scaleInterval it looks at the CPU
+// usage of the machine, the memory reserved for decoded images and the tasks waiting, and allows one task more or
+// less. Decoding an image first reserves the memory it'll take, so the worker never decodes more large images than
+// fit into the memory budget.
+
+var memoryBudget = flag.Int64("memory-budget", 1024, "MiB of decoded images the worker holds at once")
+var statusAddress = flag.String("listen", "", "Address to serve the pool status and the metrics on, e.g. 127.0.0.1:3010")
+
+const scaleInterval = 2 * time.Second
+
+// maxCpuUsage is the share of the machine's CPU above which the pool shrinks.
+const maxCpuUsage = 0.9
+
+// imageCopies is how many copies of the pixels a task holds: the decoded image, the oriented one and the result.
+const imageCopies = 3
+
+type PoolStatus struct {
+	Min            int     `json:"min"`
+	Max            int     `json:"max"`
+	Target         int     `json:"target"`
+	Active         int     `json:"active"`
+	Queued         int     `json:"queued"`
+	Utilisation    float64 `json:"utilisation"`
+	CpuUsage       float64 `json:"cpuUsage"`
+	MemoryBudget   int64   `json:"memoryBudget"`
+	MemoryReserved int64   `json:"memoryReserved"`
+	WaitingMemory  int     `json:"waitingForMemory"`
+}
+
+type pool struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+	// queued returns the number of tasks waiting for the pool. Without it, in poll mode, the queue counts as
+	// non-empty until a claim finds no task.
+	queued func() int
+
+	min, max, target int
+	active           int
+	waitingSlot      int
+	emptyClaims      int
+
+	budget, reserved int64
+	waitingMemory    int
+
+	cpuUsage    float64
+	utilisation float64
+}
+
+var workerPool *pool
+
+func newPool(min, max int, budget int64) *pool {
+	p := &pool{min: min, max: max, target: min, budget: budget, cpuUsage: -1}
+	p.cond = sync.NewCond(&p.mutex)
+	return p
+}
+
+// parseConcurrency parses the thread count argument, either a fixed count like "4" or a range like "1-8".
+func parseConcurrency(argument string) (int, int, error) {
+	parts := strings.SplitN(argument, "-", 2)
+	min, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	max := min
+	if len(parts) == 2 {
+		max, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if min < 1 || max < min {
+		return 0, 0, fmt.Errorf("invalid range %d-%d", min, max)
+	}
+	return min, max, nil
+}
+
+// setQueue sets where the tasks wait for the pool, in push mode.
+func (p *pool) setQueue(queued func() int) {
+	p.mutex.Lock()
+	p.queued = queued
+	p.mutex.Unlock()
+}
+
+// acquire waits for a free slot. It returns false, without a slot, once the worker is stopping.
+func (p *pool) acquire() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.waitingSlot++
+	defer func() { p.waitingSlot-- }()
+	for p.active >= p.target {
+		if isStopping() {
+			return false
+		}
+		p.cond.Wait()
+	}
+	if isStopping() {
+		return false
+	}
+	p.active++
+	return true
+}
+
+func (p *pool) done() {
+	p.mutex.Lock()
+	p.active--
+	p.mutex.Unlock()
+	p.cond.Broadcast()
+}
+
+// noteEmptyQueue records that a claim found no task.
+func (p *pool) noteEmptyQueue() {
+	p.mutex.Lock()
+	p.emptyClaims++
+	p.mutex.Unlock()
+}
+
+// reserve waits until the decoded image fits into the memory budget and returns the bytes reserved for it. An
+// image larger than the whole budget is still decoded, but only when nothing else is.
+func (p *pool) reserve(data []byte) (int64, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	size := int64(config.Width) * int64(config.Height) * 4 * imageCopies
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.waitingMemory++
+	for p.reserved > 0 && p.reserved+size > p.budget {
+		p.cond.Wait()
+	}
+	p.waitingMemory--
+	p.reserved += size
+	return size, nil
+}
+
+func (p *pool) free(size int64) {
+	p.mutex.Lock()
+	p.reserved -= size
+	p.mutex.Unlock()
+	p.cond.Broadcast()
+}
+
+// queueLength must be called with the mutex held.
+func (p *pool) queueLength() int {
+	if p.queued != nil {
+		return p.queued() + p.waitingSlot
+	}
+	if p.emptyClaims > 0 {
+		return 0
+	}
+	return 1
+}
+
+// autoscale adjusts the target concurrency until the worker stops.
+func (p *pool) autoscale() {
+	cpu := cpuSampler{}
+	cpu.usage()
+	for {
+		select {
+		case <-stopping:
+			p.cond.Broadcast()
+			return
+		case <-time.After(scaleInterval):
+		}
+		p.adjust(cpu.usage())
+	}
+}
+
+func (p *pool) adjust(cpuUsage float64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	queued := p.queueLength()
+	switch {
+	case cpuUsage > maxCpuUsage || p.reserved > p.budget/10*9:
+		p.target--
+	case queued > 0 && p.active >= p.target:
+		p.target++
+	case queued == 0 && p.active < p.target:
+		p.target--
+	}
+	if p.target < p.min {
+		p.target = p.min
+	}
+	if p.target > p.max {
+		p.target = p.max
+	}
+	p.emptyClaims = 0
+	p.cpuUsage = cpuUsage
+	// The utilisation is the share of the maximum in use, averaged over about the last minute.
+	p.utilisation += (float64(p.active)/float64(p.max) - p.utilisation) / 30
+	p.cond.Broadcast()
+}
+
+func (p *pool) status() PoolStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return PoolStatus{
+		Min:            p.min,
+		Max:            p.max,
+		Target:         p.target,
+		Active:         p.active,
+		Queued:         p.queueLength(),
+		Utilisation:    p.utilisation,
+		CpuUsage:       p.cpuUsage,
+		MemoryBudget:   p.budget,
+		MemoryReserved: p.reserved,
+		WaitingMemory:  p.waitingMemory,
+	}
+}
+
+func (p *pool) servePool(w http.ResponseWriter, r *http.Request) error {
+	return service.WriteJSON(w, p.status())
+}
+
+// serveStatus serves the pool status and the metrics on the -listen address, if one is given.
+func serveStatus(p *pool) {
+	if *statusAddress == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/pool", service.Methods{http.MethodGet: p.servePool})
+	mux.Handle(service.MetricsPath, metrics.Handler())
+	err := http.ListenAndServe(*statusAddress, mux)
+	if err != nil {
+		slog.Error("Couldn't serve the pool status", "err", err)
+	}
+}
+
+// cpuSampler measures the CPU usage of the machine from /proc/stat, between two calls of usage.
+type cpuSampler struct {
+	idle, total uint64
+}
+
+// usage returns the share of the CPU used since the last call, or -1 where /proc/stat isn't available.
+func (c *cpuSampler) usage() float64 {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return -1
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return -1
+	}
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return -1
+	}
+	var idle, total uint64
+	for i, field := range fields[1:] {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return -1
+		}
+		total += value
+		// idle and iowait
+		if i == 3 || i == 4 {
+			idle += value
+		}
+	}
+
+	idleDelta, totalDelta := idle-c.idle, total-c.total
+	c.idle, c.total = idle, total
+	if totalDelta == 0 {
+		return 0
+	}
+	return 1 - float64(idleDelta)/float64(totalDelta)
+}
@@ -0,0 +1,106 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"../rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// In push mode the worker registers with the Master and keeps the ReceiveTasks stream open, over which the Master
+// sends the tasks. Keepalive of the connection notices a dead Master, the stream then fails and is opened again.
+// The worker registers with its maximum thread count as capacity, the pool decides how many of the pushed tasks run
+// at once. When the worker stops, the stream stays open until the running tasks are done, because the Master reassigns all
+// tasks of a disconnected worker.
+
+// receivePushedTasks starts the processors and the stream. The returned function closes the stream and releases
+// the tasks that were pushed but not started.
+func receivePushedTasks(threadCount int, processors *sync.WaitGroup) func() {
+	tasks := make(chan *rpc.Task, threadCount)
+	workerPool.setQueue(func() int {
+		return len(tasks)
+	})
+	processors.Add(threadCount)
+	for i := 0; i < threadCount; i++ {
+		go func() {
+			defer processors.Done()
+			for {
+				select {
+				case <-stopping:
+					return
+				case myTask := <-tasks:
+					// Without a slot the worker is stopping, and runTask releases the task.
+					acquired := workerPool.acquire()
+					err := runTask(myTask)
+					if acquired {
+						workerPool.done()
+					}
+					if err != nil {
+						// Logged by runTask.
+						continue
+					}
+				}
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for {
+			workerId := currentWorkerId()
+			err := receiveTasks(ctx, threadCount, tasks)
+			if ctx.Err() != nil {
+				return
+			}
+			if status.Code(err) == codes.Unauthenticated {
+				renew(workerId)
+				continue
+			}
+			slog.Warn("Receiving tasks failed, reconnecting", "err", err, "delay", retryDelay.Get())
+			time.Sleep(retryDelay.Get())
+		}
+	}()
+
+	return func() {
+		for {
+			select {
+			case myTask := <-tasks:
+				releaseTask(myTask)
+			default:
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// receiveTasks registers with the Master and passes the pushed tasks on until the stream breaks.
+func receiveTasks(ctx context.Context, threadCount int, tasks chan *rpc.Task) error {
+	hostname, _ := os.Hostname()
+	stream, err := master.ReceiveTasks(ctx, &rpc.RegisterWorkerRequest{
+		Name:       hostname + "/" + strconv.Itoa(os.Getpid()),
+		Capacity:   int32(threadCount),
+		Operations: mySession.operations(),
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		myTask, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		select {
+		case tasks <- myTask:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package worker
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"../rpc"
+	"../tracing"
+)
+
+// On SIGTERM or SIGINT the worker stops claiming new tasks and finishes the ones it is running. What is still running
+// after the drain timeout, and what was claimed or pushed in the meantime, is released back to the queue, so another
+// worker picks it up right away instead of after the in-progress timeout.
+
+var drainTimeout = flag.Duration("drain-timeout", 30*time.Second, "How long the running tasks may take to finish after SIGTERM before they are released")
+
+var stopping = make(chan struct{})
+
+var running = struct {
+	sync.Mutex
+	tasks                      map[int64]*rpc.Task
+	finished, failed, released int
+}{tasks: map[int64]*rpc.Task{}}
+
+func watchSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	received := <-signals
+	slog.Info("Finishing the running tasks", "signal", received.String(), "drainTimeout", *drainTimeout)
+	close(stopping)
+}
+
+func isStopping() bool {
+	select {
+	case <-stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits for the duration, or less if the worker is stopping.
+func sleep(duration time.Duration) {
+	select {
+	case <-time.After(duration):
+	case <-stopping:
+	}
+}
+
+// runTask processes the task, unless the worker is stopping, in which case the task goes back to the queue.
+func runTask(myTask *rpc.Task) error {
+	if isStopping() {
+		releaseTask(myTask)
+		return nil
+	}
+
+	running.Lock()
+	running.tasks[myTask.Id] = myTask
+	running.Unlock()
+
+	// Part of the trace of the submission of the task.
+	ctx, span := tracing.Start(tracing.WithTraceParent(context.Background(), myTask.Trace), "process job", tracing.Internal)
+	ctx = tracing.WithRequestId(ctx, tracing.NewRequestId())
+	span.SetAttribute("job.id", myTask.Id)
+	span.SetAttribute("job.operation", myTask.Operation)
+	span.SetAttribute("job.attempt", myTask.Attempts)
+	defer span.End()
+
+	start := time.Now()
+	err := processTask(ctx, myTask)
+	span.SetError(err)
+
+	running.Lock()
+	if _, ok := running.tasks[myTask.Id]; !ok {
+		// Released after the drain timeout, the outcome no longer counts.
+		running.Unlock()
+		return err
+	}
+	delete(running.tasks, myTask.Id)
+	if err != nil {
+		running.failed++
+	} else {
+		running.finished++
+	}
+	running.Unlock()
+
+	taskDuration.Observe(time.Since(start).Seconds(), operationLabel(myTask))
+	if err != nil {
+		tasksProcessed.Inc(operationLabel(myTask), "failed")
+	} else {
+		tasksProcessed.Inc(operationLabel(myTask), "finished")
+	}
+
+	if err != nil {
+		slog.WarnContext(ctx, "Task failed", "job", myTask.Id, "err", err)
+		reportFailure(ctx, myTask, err)
+	} else {
+		slog.DebugContext(ctx, "Task finished", "job", myTask.Id)
+	}
+	return err
+}
+
+func releaseTask(myTask *rpc.Task) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := master.ReleaseTask(ctx, &rpc.TaskId{Id: myTask.Id})
+	if err != nil {
+		slog.Warn("Couldn't release a task", "job", myTask.Id, "err", err)
+		return
+	}
+	running.Lock()
+	running.released++
+	running.Unlock()
+	tasksProcessed.Inc(operationLabel(myTask), "released")
+}
+
+// drain waits for the workers to return, at most the drain timeout, and releases the tasks still running after it.
+func drain(workers *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-time.After(*drainTimeout):
+	}
+
+	running.Lock()
+	abandoned := make([]*rpc.Task, 0, len(running.tasks))
+	for id, myTask := range running.tasks {
+		abandoned = append(abandoned, myTask)
+		delete(running.tasks, id)
+	}
+	running.Unlock()
+	slog.Warn("Drain timeout reached, releasing the running tasks", "tasks", len(abandoned))
+	for _, myTask := range abandoned {
+		releaseTask(myTask)
+	}
+}
+
+func printSummary() {
+	running.Lock()
+	defer running.Unlock()
+	slog.Info("Stopped", "finished", running.finished, "failed", running.failed, "released", running.released)
+}
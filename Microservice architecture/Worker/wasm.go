@@ -0,0 +1,229 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// A plugin can also be a WebAssembly module instead of an executable, which then runs inside the worker, in the
+// pure-Go runtime wazero, without access to the file system or the network. Every task gets a fresh instance of the
+// module, which may use at most the memory of the manifest and make at most the function calls of the manifest. The
+// calls are counted, not the instructions, so the call limit stops runaway recursion while only the timeout stops a
+// loop which doesn't call any function. The module is stopped at whichever limit it reaches first.
+//
+// A module exports:
+//
+//	alloc(size i32) i32 - returns a buffer of size bytes in its memory.
+//	process(pixels, width, height, parameters, parametersLength i32) i32 - processes the RGBA pixels in place, 0 on success.
+//
+// and may import from env:
+//
+//	result(pixels, width, height i32) - returns RGBA pixels of another size instead.
+//	error(message, length i32) - tells why process failed.
+
+// defaultModuleMemory is the memory limit of a module in MiB, if its manifest has none.
+const defaultModuleMemory = 256
+
+// defaultMaxCalls is how many function calls a module may make per task, if its manifest doesn't say.
+const defaultMaxCalls = 1000000000
+
+const wasmPageSize = 64 << 10
+
+type wasmModule struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+}
+
+// moduleCall is the state of a running module, which its imports and the call counter get from the context.
+type moduleCall struct {
+	callsLeft int64
+	cancel    context.CancelFunc
+	result    []byte
+	width     uint32
+	height    uint32
+	message   string
+	hasError  bool
+}
+
+type moduleCallKey struct{}
+
+func callOf(ctx context.Context) *moduleCall {
+	call, _ := ctx.Value(moduleCallKey{}).(*moduleCall)
+	return call
+}
+
+// callCounter counts down the calls left to the module on every function call of the module.
+type callCounter struct{}
+
+func (callCounter) NewFunctionListener(api.FunctionDefinition) experimental.FunctionListener {
+	return experimental.FunctionListenerFunc(func(ctx context.Context, _ api.Module, _ api.FunctionDefinition, _ []uint64, _ experimental.StackIterator) {
+		call := callOf(ctx)
+		if call != nil && atomic.AddInt64(&call.callsLeft, -1) == 0 {
+			call.cancel()
+		}
+	})
+}
+
+// loadModule compiles the module of the plugin, in a runtime of its own with the memory limit of the manifest.
+func loadModule(plugin *pluginManifest) error {
+	memory := plugin.Memory
+	if memory == 0 {
+		memory = defaultModuleMemory
+	}
+	if plugin.MaxCalls == 0 {
+		plugin.MaxCalls = defaultMaxCalls
+	}
+	if memory < 0 || plugin.MaxCalls < 0 {
+		return errors.New("the memory and maxCalls must be positive")
+	}
+	code, err := ioutil.ReadFile(filepath.Join(plugin.dir, plugin.Module))
+	if err != nil {
+		return err
+	}
+
+	ctx := experimental.WithFunctionListenerFactory(context.Background(), callCounter{})
+	config := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(uint32(memory << 20 / wasmPageSize)).
+		WithCloseOnContextDone(true)
+	runtime := wazero.NewRuntimeWithConfig(ctx, config)
+	_, err = wasi_snapshot_preview1.Instantiate(ctx, runtime)
+	if err != nil {
+		runtime.Close(ctx)
+		return err
+	}
+	_, err = runtime.NewHostModuleBuilder("env").
+		NewFunctionBuilder().WithFunc(setResult).Export("result").
+		NewFunctionBuilder().WithFunc(setError).Export("error").
+		Instantiate(ctx)
+	if err != nil {
+		runtime.Close(ctx)
+		return err
+	}
+	compiled, err := runtime.CompileModule(ctx, code)
+	if err != nil {
+		runtime.Close(ctx)
+		return err
+	}
+	exports := compiled.ExportedFunctions()
+	if exports["alloc"] == nil || exports["process"] == nil {
+		runtime.Close(ctx)
+		return errors.New("the module must export alloc and process")
+	}
+	plugin.module = &wasmModule{runtime: runtime, compiled: compiled}
+	return nil
+}
+
+func setResult(ctx context.Context, module api.Module, pixels uint32, width uint32, height uint32) {
+	call := callOf(ctx)
+	size := uint64(width) * uint64(height) * 4
+	var data []byte
+	ok := size <= uint64(module.Memory().Size())
+	if ok {
+		data, ok = module.Memory().Read(pixels, uint32(size))
+	}
+	if !ok {
+		call.hasError = true
+		call.message = "result out of memory bounds"
+		return
+	}
+	call.result = append([]byte{}, data...)
+	call.width, call.height = width, height
+}
+
+func setError(ctx context.Context, module api.Module, message uint32, length uint32) {
+	call := callOf(ctx)
+	data, _ := module.Memory().Read(message, length)
+	call.hasError = true
+	call.message = string(data)
+}
+
+// runModule passes the image through a fresh instance of the module of the plugin.
+func (plugin *pluginManifest) runModule(myImage image.Image, parameters []byte) (image.Image, error) {
+	bounds := myImage.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), myImage, bounds.Min, draw.Src)
+
+	call := &moduleCall{callsLeft: plugin.MaxCalls}
+	ctx, cancel := context.WithTimeout(context.Background(), plugin.timeout)
+	defer cancel()
+	call.cancel = cancel
+	ctx = context.WithValue(ctx, moduleCallKey{}, call)
+
+	stderr := tailBuffer{limit: maxStderr}
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize").
+		WithStdout(&stderr).
+		WithStderr(&stderr)
+	instance, err := plugin.module.runtime.InstantiateModule(ctx, plugin.module.compiled, config)
+	if err != nil {
+		return nil, plugin.moduleError(ctx, call, err, &stderr)
+	}
+	defer instance.Close(context.Background())
+
+	pixels, err := writeToModule(ctx, instance, rgba.Pix)
+	if err != nil {
+		return nil, plugin.moduleError(ctx, call, err, &stderr)
+	}
+	parametersPointer, err := writeToModule(ctx, instance, parameters)
+	if err != nil {
+		return nil, plugin.moduleError(ctx, call, err, &stderr)
+	}
+	results, err := instance.ExportedFunction("process").Call(ctx,
+		uint64(pixels), uint64(rgba.Rect.Dx()), uint64(rgba.Rect.Dy()), uint64(parametersPointer), uint64(len(parameters)))
+	if err != nil {
+		return nil, plugin.moduleError(ctx, call, err, &stderr)
+	}
+	if call.hasError || uint32(results[0]) != 0 {
+		message := call.message
+		if len(message) == 0 {
+			message = fmt.Sprint("status ", uint32(results[0]))
+		}
+		return nil, permanentError("plugin_failed", fmt.Errorf("%s: %s%s", plugin.Operation, message, stderr.suffix()))
+	}
+
+	if call.result != nil {
+		return &image.RGBA{Pix: call.result, Stride: int(call.width) * 4, Rect: image.Rect(0, 0, int(call.width), int(call.height))}, nil
+	}
+	data, ok := instance.Memory().Read(pixels, uint32(len(rgba.Pix)))
+	if !ok {
+		return nil, permanentError("plugin_failed", fmt.Errorf("%s: pixels out of memory bounds", plugin.Operation))
+	}
+	copy(rgba.Pix, data)
+	return rgba, nil
+}
+
+// writeToModule copies the data into a buffer allocated by the module.
+func writeToModule(ctx context.Context, instance api.Module, data []byte) (uint32, error) {
+	results, err := instance.ExportedFunction("alloc").Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+	pointer := uint32(results[0])
+	if !instance.Memory().Write(pointer, data) {
+		return 0, errors.New("alloc returned a buffer out of memory bounds")
+	}
+	return pointer, nil
+}
+
+// moduleError tells apart a module which ran out of time or calls from one which trapped.
+func (plugin *pluginManifest) moduleError(ctx context.Context, call *moduleCall, err error, stderr *tailBuffer) error {
+	if atomic.LoadInt64(&call.callsLeft) <= 0 {
+		return permanentError("plugin_too_many_calls", fmt.Errorf("%s made more than %d function calls%s", plugin.Operation, plugin.MaxCalls, stderr.suffix()))
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return permanentError("plugin_timeout", fmt.Errorf("%s ran longer than %v%s", plugin.Operation, plugin.timeout, stderr.suffix()))
+	}
+	return permanentError("plugin_failed", fmt.Errorf("%s: %v%s", plugin.Operation, err, stderr.suffix()))
+}
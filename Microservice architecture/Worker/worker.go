@@ -1,157 +1,206 @@
-package main
+package worker
 
 import (
-	"os"
+	"flag"
 	"fmt"
-	"net/http"
-	"io/ioutil"
 	"encoding/json"
+	"log/slog"
 	"time"
-	"strconv"
 	"image"
 	"image/png"
+	_ "image/jpeg"
+	_ "image/gif"
 	"image/color"
 	"bytes"
 	"sync"
 	"errors"
+	"context"
+
+	"../rpc"
+	"../service"
+	"../tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-type Task struct {
-	Id int `json:"id"`
-	State int `json:"state"`
-}
+var master rpc.MasterClient
+var imageStores rpc.ImageStores
 
-var masterLocation string
-var storageLocation string
-var keyValueStoreAddress string
+var errNoTask = errors.New("Error: No non-started task.")
 
-func main() {
-	if len(os.Args) < 3 {
-		fmt.Println("Error: Too few arguments.")
-		return
-	}
-	keyValueStoreAddress = os.Args[1]
+var retryDelay = service.DurationFlag("backoff", time.Second*2, "How long to wait after a failed task or an unreachable Master")
+var _ = flag.String("threads", "", "Thread count, like 4, or 1-8 to scale with the load. It may also be given as argument")
+var pushMode = flag.Bool("push", false, "Let the Master push the tasks instead of polling for them. Same as a push argument")
 
-	response, err := http.Get("http://" + keyValueStoreAddress + "/get?key=masterAddress")
-	if response.StatusCode != http.StatusOK {
-		fmt.Println("Error: can't get master address.")
-		fmt.Println(response.Body)
-		return
-	}
-	data, err := ioutil.ReadAll(response.Body)
+// Main runs a worker. The args are the address of the config store, the thread count and optionally "push", see -push.
+func Main(args []string) {
+	config := service.NewConfigStore(args[0])
+
+	var err error
+	master, err = config.Master(context.Background(), grpc.WithPerRPCCredentials(mySession), grpc.WithChainUnaryInterceptor(renewSession))
 	if err != nil {
-		fmt.Println(err)
-		return
+		service.Fatal(err)
 	}
-	masterLocation = string(data)
-	if len(masterLocation) == 0 {
-		fmt.Println("Error: can't get master address. Length is zero.")
-		return
+	imageStores, err = config.ImageStores(context.Background())
+	if err != nil {
+		service.Fatal(err)
 	}
 
-	response, err = http.Get("http://" + keyValueStoreAddress + "/get?key=storageAddress")
-	if response.StatusCode != http.StatusOK {
-		fmt.Println("Error: can't get storage address.")
-		fmt.Println(response.Body)
-		return
-	}
-	data, err = ioutil.ReadAll(response.Body)
+	err = loadPlugins()
 	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	storageLocation = string(data)
-	if len(storageLocation) == 0 {
-		fmt.Println("Error: can't get storage address. Length is zero.")
-		return
+		service.Fatal(err)
 	}
+	shakeHands()
 
-	threadCount, err := strconv.Atoi(os.Args[2])
+	minThreads, maxThreads, err := parseConcurrency(args[1])
 	if err != nil {
-		fmt.Println("Error: Couldn't parse thread count.")
+		slog.Error("Couldn't parse the thread count", "err", err)
 		return
 	}
-	myWG := sync.WaitGroup{}
-	myWG.Add(threadCount)
-	for i := 0; i < threadCount; i++ {
-		go func() {
-			for {
-				myTask, err := getNewTask(masterLocation)
-				if err != nil || myTask.Id == -1 {
-					fmt.Println(err)
-					fmt.Println("Waiting 2 second timeout...")
-					time.Sleep(time.Second * 2)
-					continue
-				}
-
-				myImage, err := getImageFromStorage(storageLocation, myTask)
-				if err != nil {
-					fmt.Println(err)
-					fmt.Println("Waiting 2 second timeout...")
-					time.Sleep(time.Second * 2)
-					continue
-				}
+	workerPool = newPool(minThreads, maxThreads, *memoryBudget<<20)
+	go watchSignals()
+	go workerPool.autoscale()
+	go serveStatus(workerPool)
 
-				myImage, err = doWorkOnImage(myImage)
-				if err != nil {
-					fmt.Println(err)
-					fmt.Println("Waiting 2 second timeout...")
-					time.Sleep(time.Second * 2)
-					registerFinishedTask(masterLocation, myTask)
-					continue
-				}
+	myWG := sync.WaitGroup{}
+	if *pushMode || (len(args) > 2 && args[2] == "push") {
+		// Let the Master push the tasks instead of polling for them.
+		closeStream := receivePushedTasks(maxThreads, &myWG)
+		<-stopping
+		drain(&myWG)
+		closeStream()
+		printSummary()
+		return
+	}
 
-				err = sendImageToStorage(storageLocation, myTask, myImage)
+	myWG.Add(maxThreads)
+	for i := 0; i < maxThreads; i++ {
+		go func() {
+			defer myWG.Done()
+			for workerPool.acquire() {
+				myTask, err := getNewTask()
 				if err != nil {
-					fmt.Println(err)
-					fmt.Println("Waiting 2 second timeout...")
-					time.Sleep(time.Second * 2)
+					workerPool.done()
+					if err == errNoTask {
+						workerPool.noteEmptyQueue()
+						slog.Debug("No task, waiting", "delay", retryDelay.Get())
+					} else {
+						slog.Warn("Claiming a task failed, waiting", "err", err, "delay", retryDelay.Get())
+					}
+					sleep(retryDelay.Get())
 					continue
 				}
 
-				err = registerFinishedTask(masterLocation, myTask)
+				err = runTask(myTask)
+				workerPool.done()
 				if err != nil {
-					fmt.Println(err)
-					fmt.Println("Waiting 2 second timeout...")
-					time.Sleep(time.Second * 2)
+					// Logged by runTask.
+					sleep(retryDelay.Get())
 					continue
 				}
 			}
 		}()
 	}
-	myWG.Wait()
+	<-stopping
+	drain(&myWG)
+	printSummary()
 }
 
-func getNewTask(masterAddress string) (Task, error) {
-	response, err := http.Post("http://" + masterAddress + "/getNewTask", "text/plain", nil)
-	if err != nil || response.StatusCode != http.StatusOK {
-		return Task{-1, -1}, err
+func processTask(ctx context.Context, myTask *rpc.Task) error {
+	data, err := getImageFromStorage(ctx, myTask)
+	if err != nil {
+		return storageError(err)
 	}
-	data, err := ioutil.ReadAll(response.Body)
+	reserved, err := workerPool.reserve(data)
 	if err != nil {
-		return Task{-1, -1}, err
+		return permanentError("invalid_image", err)
 	}
+	defer workerPool.free(reserved)
 
-	myTask := Task{}
-	err = json.Unmarshal(data, &myTask)
+	myImage, _, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
-		return Task{-1, -1}, err
+		return permanentError("invalid_image", err)
 	}
+	reportProgress(ctx, myTask, 25)
 
-	return myTask, nil
+	myMetadata, err := getMetadataFromStorage(ctx, myTask)
+	if err != nil {
+		// Without the metadata we can't know the orientation, so the image is processed as is.
+		slog.WarnContext(ctx, "Couldn't get the metadata", "job", myTask.Id, "err", err)
+	} else {
+		myImage = applyOrientation(myImage, myMetadata.Orientation)
+	}
+
+	myImage, err = applyOperation(ctx, myTask, myImage)
+	if err != nil {
+		if _, ok := err.(*taskError); ok {
+			return err
+		}
+		return permanentError("processing_failed", err)
+	}
+	reportProgress(ctx, myTask, 75)
+
+	err = sendImageToStorage(ctx, myTask, myImage)
+	if err != nil {
+		return storageError(err)
+	}
+
+	return registerFinishedTask(ctx, myTask)
+}
+
+// applyOperation runs the operation of the task, either the built-in one or a plugin.
+func applyOperation(ctx context.Context, myTask *rpc.Task, myImage image.Image) (result image.Image, err error) {
+	_, span := tracing.Start(ctx, "apply "+myTask.Operation, tracing.Internal)
+	start := time.Now()
+	defer func() {
+		span.SetError(err)
+		span.End()
+		operationDuration.Observe(time.Since(start).Seconds(), operationLabel(myTask))
+	}()
+	if len(myTask.Operation) == 0 || myTask.Operation == builtinOperation {
+		return doWorkOnImage(myImage)
+	}
+	plugin, ok := plugins[myTask.Operation]
+	if !ok {
+		// Another worker may have the plugin.
+		return nil, &taskError{code: "unsupported_operation", err: fmt.Errorf("No plugin for %s", myTask.Operation), transient: true}
+	}
+	return plugin.run(myImage, myTask.Parameters)
 }
-func getImageFromStorage(storageAddress string, myTask Task) (image.Image, error) {
-	response, err := http.Get("http://" + storageAddress + "/getImage?state=working&id=" + strconv.Itoa(myTask.Id))
-	if err != nil || response.StatusCode != http.StatusOK {
+
+func getNewTask() (*rpc.Task, error) {
+	myTask, err := master.ClaimTask(context.Background(), &rpc.ClaimTaskRequest{Operations: mySession.operations()})
+	if status.Code(err) == codes.NotFound {
+		return nil, errNoTask
+	}
+	if err != nil {
 		return nil, err
 	}
 
-	myImage, err := png.Decode(response.Body)
+	return myTask, nil
+}
+func getImageFromStorage(ctx context.Context, myTask *rpc.Task) ([]byte, error) {
+	return imageStores.Download(ctx, &rpc.ImageRef{State: rpc.ImageState_IMAGE_STATE_WORKING, Id: myTask.Id})
+}
+func getMetadataFromStorage(ctx context.Context, myTask *rpc.Task) (ImageMetadata, error) {
+	var metadata *rpc.ImageMetadata
+	err := imageStores.Call(func(store rpc.ImageStoreClient) error {
+		var err error
+		metadata, err = store.GetMetadata(ctx, &rpc.ImageRef{State: rpc.ImageState_IMAGE_STATE_WORKING, Id: myTask.Id})
+		return err
+	})
 	if err != nil {
-		return nil, err
+		return ImageMetadata{}, err
 	}
 
-	return myImage, nil
+	myMetadata := ImageMetadata{}
+	err = json.Unmarshal(metadata.Json, &myMetadata)
+	if err != nil {
+		return ImageMetadata{}, err
+	}
+
+	return myMetadata, nil
 }
 func doWorkOnImage(myImage image.Image) (image.Image, error) {
 	if myImage != nil {
@@ -174,26 +223,24 @@ func doWorkOnImage(myImage image.Image) (image.Image, error) {
 		return myImage, errors.New("Image can't be nil.")
 	}
 }
-func sendImageToStorage(storageAddress string, myTask Task, myImage image.Image) error {
+func sendImageToStorage(ctx context.Context, myTask *rpc.Task, myImage image.Image) error {
 	data := []byte{}
 	buffer := bytes.NewBuffer(data)
 	err := png.Encode(buffer, myImage)
 	if err != nil {
 		return err
 	}
-	response, err := http.Post("http://" + storageAddress + "/sendImage?state=finished&id=" + strconv.Itoa(myTask.Id), "image/png", buffer)
-	if err != nil || response.StatusCode != http.StatusOK {
-		return err
-	}
-
-	return nil
+	header := &rpc.UploadHeader{Image: &rpc.ImageRef{State: rpc.ImageState_IMAGE_STATE_FINISHED, Id: myTask.Id}}
+	return imageStores.Upload(ctx, header, buffer.Bytes())
 }
-func registerFinishedTask(masterAddress string, myTask Task) error {
-	response, err := http.Post("http://" + masterAddress + "/registerTaskFinished?id=" + strconv.Itoa(myTask.Id), "test/plain", nil)
-	if err != nil || response.StatusCode != http.StatusOK {
-		return err
+// reportProgress tells the Master how far the task got. It's only informational, so failures are just logged.
+func reportProgress(ctx context.Context, myTask *rpc.Task, progress int32) {
+	_, err := master.ReportProgress(ctx, &rpc.SetProgressRequest{Id: myTask.Id, Progress: progress})
+	if err != nil {
+		slog.WarnContext(ctx, "Reporting the progress failed", "job", myTask.Id, "err", err)
 	}
-
-	return nil
 }
-
+func registerFinishedTask(ctx context.Context, myTask *rpc.Task) error {
+	_, err := master.FinishTask(ctx, &rpc.TaskId{Id: myTask.Id})
+	return err
+}
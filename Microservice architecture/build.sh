@@ -1,29 +1,43 @@
 #!/bin/bash
 
-mkdir /tmp/{working,finished}
+echo Fetching dependencies...
+go get github.com/gorilla/websocket google.golang.org/grpc google.golang.org/protobuf/... github.com/tetratelabs/wazero/... gopkg.in/yaml.v3 github.com/BurntSushi/toml
 
 echo Building Config store...
-cd keyvaluestore
-go build -o ../bin/config-store
+cd cmd/config-store
+go build -o ../../bin/config-store
 
 echo Building Tasks store...
-cd ../Database
-go build -o ../bin/tasks-store
+cd ../tasks-store
+go build -o ../../bin/tasks-store
 
 echo Building Images store...
-cd ../Storage
-go build -o ../bin/images-store
+cd ../images-store
+go build -o ../../bin/images-store
 
 echo Building Master...
-cd ../Master
-go build -o ../bin/master
+cd ../master
+go build -o ../../bin/master
 
 echo Building Worker...
-cd ../Worker
-go build -o ../bin/worker
+cd ../worker
+go build -o ../../bin/worker
 
 echo Building Frontend...
-cd ../Frontend
-go build -o ../bin/frontend
+cd ../frontend
+go build -o ../../bin/frontend
+
+echo Building Stack...
+cd ../stack
+go build -o ../../bin/stack
+
+echo Building plugins...
+cd ../..
+mkdir -p bin/plugins/grayscale
+cp plugins/grayscale/manifest.json bin/plugins/grayscale/
+go build -o bin/plugins/grayscale/grayscale ./plugins/grayscale
+mkdir -p bin/plugins/invert
+cp plugins/invert/manifest.json bin/plugins/invert/
+(cd plugins/invert && GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o ../../bin/plugins/invert/invert.wasm)
 
 echo Done.
@@ -0,0 +1,11 @@
+// config-store is the key-value store in which the services find each other and their settings.
+package main
+
+import (
+	"../../keyvaluestore"
+	"../../service"
+)
+
+func main() {
+	keyvaluestore.Main(service.Configure("config-store", "address=:3000"))
+}
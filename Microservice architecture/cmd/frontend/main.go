@@ -0,0 +1,11 @@
+// frontend serves the web interface.
+package main
+
+import (
+	"../../Frontend"
+	"../../service"
+)
+
+func main() {
+	frontend.Main(service.Configure("frontend", "config-store", "address=:80"))
+}
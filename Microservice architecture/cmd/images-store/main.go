@@ -0,0 +1,11 @@
+// images-store keeps the images and their metadata.
+package main
+
+import (
+	"../../Storage"
+	"../../service"
+)
+
+func main() {
+	storage.Main(service.Configure("images-store", "address", "config-store"))
+}
@@ -0,0 +1,11 @@
+// master takes the uploads and hands the tasks out to the workers.
+package main
+
+import (
+	"../../Master"
+	"../../service"
+)
+
+func main() {
+	master.Main(service.Configure("master", "address", "config-store"))
+}
@@ -0,0 +1,276 @@
+// stack runs the whole system, or a part of it, from a single binary. It starts the services one stage after the
+// other, each once the previous ones answer on their health endpoint, restarts the ones which crash and stops them
+// all, in the opposite order, on SIGTERM or SIGINT.
+//
+// Each service runs as a child process, which is the stack binary itself run with -run, or in the stack's own process
+// with -in-process. In-process services share the flags of the stack and aren't restarted, a crash of one of them ends
+// the stack. The services get the -config file of the stack, and the settings of the config store of the layout.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"../../Database"
+	"../../Frontend"
+	"../../Master"
+	"../../Storage"
+	"../../Worker"
+	"../../keyvaluestore"
+	"../../service"
+)
+
+var layoutFile = flag.String("layout", "", "JSON file with the services to run, the default layout if empty")
+var inProcess = flag.Bool("in-process", false, "Run all the services in this process instead of as child processes")
+var readyTimeout = flag.Duration("ready-timeout", 30*time.Second, "How long a service may take to answer on "+service.HealthPath)
+var stopTimeout = flag.Duration("stop-timeout", 45*time.Second, "How long a service may take to stop before it's killed")
+var runKind = flag.String("run", "", "Run only this kind of service, in the foreground. The stack starts its child processes this way")
+
+// kind is a service the stack knows how to run. Services of a lower stage start first and stop last.
+type kind struct {
+	stage int
+	main  func(args []string)
+	// args returns the positional arguments of the service.
+	args func(service *stackService, configStore string) []string
+	// settings are the settings of the service which may be given as positional arguments, see service.Configure.
+	settings []string
+}
+
+func ownAddress(service *stackService, configStore string) []string {
+	return append([]string{service.Address, configStore}, service.Args...)
+}
+
+var kinds = map[string]kind{
+	"config-store": {0, keyvaluestore.Main, func(service *stackService, configStore string) []string {
+		return []string{service.Address}
+	}, []string{"address=:3000"}},
+	"tasks-store":  {1, database.Main, ownAddress, []string{"address", "config-store"}},
+	"images-store": {1, storage.Main, ownAddress, []string{"address", "config-store"}},
+	"master":       {2, master.Main, ownAddress, []string{"address", "config-store"}},
+	"worker": {3, worker.Main, func(service *stackService, configStore string) []string {
+		return append([]string{configStore}, service.Args...)
+	}, []string{"config-store", "threads"}},
+	"frontend": {3, frontend.Main, func(service *stackService, configStore string) []string {
+		return []string{configStore, service.Address}
+	}, []string{"config-store", "address=:80"}},
+}
+
+// stackService is one service of the layout.
+type stackService struct {
+	Name      string   `json:"name"` // Unique in the layout, the kind by default.
+	Kind      string   `json:"kind"`
+	Address   string   `json:"address"`   // Where it serves HTTP, gRPC is on the port plus 1000. Workers have none.
+	Flags     []string `json:"flags"`     // e.g. "-dir=/tmp/images".
+	Args      []string `json:"args"`      // Positional arguments after the addresses, like the thread count of a worker.
+	InProcess bool     `json:"inProcess"` // Run in the stack's process, like -in-process does for all.
+}
+
+type layout struct {
+	ConfigStore string          `json:"configStore"`
+	Services    []*stackService `json:"services"`
+}
+
+var defaultLayout = layout{
+	ConfigStore: "127.0.0.1:3000",
+	Services: []*stackService{
+		{Kind: "config-store", Address: "127.0.0.1:3000"},
+		{Kind: "tasks-store", Address: "127.0.0.1:3001"},
+		{Kind: "images-store", Address: "127.0.0.1:3002", Flags: []string{"-dir=/tmp/images-store"}},
+		{Kind: "master", Address: "127.0.0.1:3003"},
+		{Kind: "worker", Args: []string{"1-4"}},
+		{Kind: "frontend", Address: "127.0.0.1:8080"},
+	},
+}
+
+func main() {
+	flag.Parse()
+	if len(*runKind) != 0 {
+		runOne(*runKind)
+		return
+	}
+	args := service.Configure("stack")
+
+	myLayout, err := loadLayout(*layoutFile)
+	if err != nil {
+		service.Fatal(err)
+	}
+	selected, err := myLayout.selected(args)
+	if err != nil {
+		service.Fatal(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	stopping := make(chan struct{})
+	go func() {
+		received := <-signals
+		slog.Info("Stopping the stack", "signal", received.String())
+		close(stopping)
+	}()
+
+	started := []*runner{}
+	for stage, services := range stages(selected) {
+		if len(services) == 0 {
+			continue
+		}
+		runners := []*runner{}
+		for _, myService := range services {
+			myRunner, err := start(myService, myLayout.ConfigStore, stopping)
+			if err != nil {
+				slog.Error(err.Error())
+				stopAll(started)
+				os.Exit(1)
+			}
+			runners = append(runners, myRunner)
+			started = append(started, myRunner)
+		}
+		err = waitReady(runners, stopping)
+		if err != nil {
+			slog.Error(err.Error())
+			stopAll(started)
+			os.Exit(1)
+		}
+		slog.Info("The stage is ready", "stage", stage)
+	}
+	slog.Info("The stack is running")
+
+	<-stopping
+	stopAll(started)
+	slog.Info("The stack stopped")
+}
+
+// runOne runs a single service in the foreground, as a child process of the stack.
+func runOne(name string) {
+	myKind, ok := kinds[name]
+	if !ok {
+		service.Fatal(fmt.Errorf("Error: Unknown service %s", name))
+	}
+	myKind.main(service.Configure(name, myKind.settings...))
+}
+
+func loadLayout(file string) (*layout, error) {
+	myLayout := defaultLayout
+	if len(file) != 0 {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		myLayout = layout{}
+		err = json.Unmarshal(data, &myLayout)
+		if err != nil {
+			return nil, fmt.Errorf("Error: Invalid layout %s: %v", file, err)
+		}
+	}
+	return &myLayout, myLayout.validate()
+}
+
+func (myLayout *layout) validate() error {
+	if len(myLayout.ConfigStore) == 0 {
+		return errors.New("Error: The layout needs the address of the config store")
+	}
+	names := map[string]bool{}
+	addresses := map[string]bool{}
+	inProcessKinds := map[string]bool{}
+	for _, myService := range myLayout.Services {
+		if _, ok := kinds[myService.Kind]; !ok {
+			return fmt.Errorf("Error: Unknown kind of service %q", myService.Kind)
+		}
+		if len(myService.Name) == 0 {
+			myService.Name = myService.Kind
+		}
+		if names[myService.Name] {
+			return fmt.Errorf("Error: Two services are called %s, give them names", myService.Name)
+		}
+		names[myService.Name] = true
+		if myService.Kind != "worker" && len(myService.Address) == 0 {
+			return fmt.Errorf("Error: The %s needs an address", myService.Name)
+		}
+		if myService.Kind == "worker" && len(myService.Args) == 0 {
+			return fmt.Errorf("Error: The %s needs its thread count in args", myService.Name)
+		}
+		if len(myService.Address) != 0 {
+			if addresses[myService.Address] {
+				return fmt.Errorf("Error: Two services are on %s", myService.Address)
+			}
+			addresses[myService.Address] = true
+		}
+		if *inProcess {
+			myService.InProcess = true
+		}
+		if myService.InProcess {
+			// The state of a service lives in its package, so there can only be one of each kind.
+			if inProcessKinds[myService.Kind] {
+				return fmt.Errorf("Error: Only one %s can run in-process", myService.Kind)
+			}
+			inProcessKinds[myService.Kind] = true
+		}
+	}
+	return nil
+}
+
+// selected returns the services with the given names or kinds, all of them without any.
+func (myLayout *layout) selected(names []string) ([]*stackService, error) {
+	if len(names) == 0 {
+		return myLayout.Services, nil
+	}
+	result := []*stackService{}
+	for _, name := range names {
+		found := false
+		for _, myService := range myLayout.Services {
+			if myService.Name == name || myService.Kind == name {
+				result = append(result, myService)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Error: No service %s in the layout, there are %s", name, strings.Join(myLayout.names(), ", "))
+		}
+	}
+	return result, nil
+}
+
+func (myLayout *layout) names() []string {
+	names := []string{}
+	for _, myService := range myLayout.Services {
+		names = append(names, myService.Name)
+	}
+	return names
+}
+
+// stages groups the services by the stage of their kind.
+func stages(services []*stackService) [][]*stackService {
+	result := make([][]*stackService, 4)
+	for _, myService := range services {
+		stage := kinds[myService.Kind].stage
+		result[stage] = append(result[stage], myService)
+	}
+	return result
+}
+
+// stopAll stops the services stage by stage, the last started first.
+func stopAll(runners []*runner) {
+	for stage := len(kinds); stage >= 0; stage-- {
+		stopping := sync.WaitGroup{}
+		for _, myRunner := range runners {
+			if kinds[myRunner.Kind].stage != stage {
+				continue
+			}
+			stopping.Add(1)
+			go func(myRunner *runner) {
+				defer stopping.Done()
+				myRunner.stop(*stopTimeout)
+			}(myRunner)
+		}
+		stopping.Wait()
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"../../service"
+)
+
+// A child process which crashes is started again after restartDelay, twice as long after every crash in a row, up
+// to maxRestartDelay. A child which ran for stableAfter counts as running fine again.
+const restartDelay = time.Second
+const maxRestartDelay = 30 * time.Second
+const stableAfter = time.Minute
+
+// runner runs one service of the stack, either as a child process or in this process.
+type runner struct {
+	*stackService
+	args []string
+	log  *slog.Logger // Logs the events of the service, with its name and kind.
+
+	mutex    sync.Mutex
+	process  *os.Process
+	stopped  chan struct{} // Closed once the service doesn't run anymore and won't be restarted.
+	stopping chan struct{} // Closed when the stack asks the service to stop.
+	stopOnce sync.Once
+}
+
+// start starts the service. stackStopping is closed when the whole stack stops.
+func start(myService *stackService, configStore string, stackStopping <-chan struct{}) (*runner, error) {
+	myRunner := &runner{
+		stackService: myService,
+		args:         kinds[myService.Kind].args(myService, configStore),
+		log:          slog.With("name", myService.Name, "kind", myService.Kind),
+		stopped:      make(chan struct{}),
+		stopping:     make(chan struct{}),
+	}
+	go func() {
+		select {
+		case <-stackStopping:
+			myRunner.stopOnce.Do(func() { close(myRunner.stopping) })
+		case <-myRunner.stopped:
+		}
+	}()
+
+	if myService.InProcess {
+		return myRunner, myRunner.runInProcess(configStore)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	go myRunner.supervise(executable)
+	return myRunner, nil
+}
+
+// runInProcess runs the service in a goroutine. Its settings are loaded into the flags of the stack, and its flags
+// of the layout set on them.
+func (myRunner *runner) runInProcess(configStore string) error {
+	err := service.LoadSettings(myRunner.Kind)
+	if err != nil {
+		return err
+	}
+	err = service.SetFlags(myRunner.Flags)
+	if err != nil {
+		return fmt.Errorf("Error: Flags of the %s: %v", myRunner.Name, err)
+	}
+	if myRunner.Kind != "config-store" {
+		service.WatchSettings(myRunner.Kind, configStore)
+	}
+	myRunner.log.Info("Starting the service in-process")
+	go func() {
+		defer close(myRunner.stopped)
+		kinds[myRunner.Kind].main(myRunner.args)
+		myRunner.log.Info("The service returned")
+	}()
+	return nil
+}
+
+// supervise runs the child process of the service until the stack stops, starting it again when it crashes.
+func (myRunner *runner) supervise(executable string) {
+	defer close(myRunner.stopped)
+	delay := restartDelay
+	for {
+		arguments := []string{"-run=" + myRunner.Kind}
+		if config := flag.Lookup("config").Value.String(); len(config) != 0 {
+			arguments = append(arguments, "-config="+config)
+		}
+		arguments = append(arguments, myRunner.Flags...)
+		arguments = append(arguments, myRunner.args...)
+		cmd := exec.Command(executable, arguments...)
+		// A process group of its own, so that a Ctrl-C in the terminal reaches only the stack, which stops the
+		// services in order.
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		output, err := cmd.StdoutPipe()
+		if err != nil {
+			myRunner.log.Error("Couldn't start the service", "err", err)
+			return
+		}
+		cmd.Stderr = cmd.Stdout
+		myRunner.mutex.Lock()
+		select {
+		case <-myRunner.stopping:
+			myRunner.mutex.Unlock()
+			return
+		default:
+		}
+		err = cmd.Start()
+		if err != nil {
+			myRunner.mutex.Unlock()
+			myRunner.log.Error("Couldn't start the service", "err", err)
+			return
+		}
+		myRunner.process = cmd.Process
+		myRunner.mutex.Unlock()
+		myRunner.log.Info("Started the service", "pid", cmd.Process.Pid)
+		started := time.Now()
+		prefixLines(output, myRunner.Name)
+		err = cmd.Wait()
+
+		select {
+		case <-myRunner.stopping:
+			myRunner.log.Info("The service stopped", "status", exitStatus(err))
+			return
+		default:
+		}
+		if time.Since(started) > stableAfter {
+			delay = restartDelay
+		}
+		myRunner.log.Warn("The service crashed, restarting it", "status", exitStatus(err), "delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-myRunner.stopping:
+			return
+		}
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
+
+func exitStatus(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
+
+// prefixLines copies the output of a child to ours, each line prefixed with the name of the service. The child logs
+// with slog itself, the prefix tells whose the other output, like a panic, is.
+func prefixLines(output io.Reader, name string) {
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		fmt.Fprintln(os.Stderr, name+" |", scanner.Text())
+	}
+}
+
+// ready tells whether the service answers on its health endpoint. Workers don't serve HTTP, they're ready once started.
+func (myRunner *runner) ready(ctx context.Context) bool {
+	if len(myRunner.Address) == 0 {
+		myRunner.mutex.Lock()
+		defer myRunner.mutex.Unlock()
+		return myRunner.InProcess || myRunner.process != nil
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+myRunner.Address+service.HealthPath, nil)
+	if err != nil {
+		return false
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return false
+	}
+	response.Body.Close()
+	return response.StatusCode == http.StatusOK
+}
+
+// waitReady waits until all the services are ready, at most -ready-timeout.
+func waitReady(runners []*runner, stopping <-chan struct{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *readyTimeout)
+	defer cancel()
+	for _, myRunner := range runners {
+		for !myRunner.ready(ctx) {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("Error: The %s wasn't ready after %v", myRunner.Name, *readyTimeout)
+			case <-stopping:
+				return fmt.Errorf("Error: The stack was stopped while starting the %s", myRunner.Name)
+			case <-myRunner.stopped:
+				return fmt.Errorf("Error: The %s ended while starting", myRunner.Name)
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+		myRunner.log.Info("The service is ready")
+	}
+	return nil
+}
+
+// stop asks the service to stop with SIGTERM and kills it if it doesn't within the timeout. In-process services
+// stop on the signal the stack got, so stop only waits for them.
+func (myRunner *runner) stop(timeout time.Duration) {
+	myRunner.mutex.Lock()
+	myRunner.stopOnce.Do(func() { close(myRunner.stopping) })
+	myRunner.mutex.Unlock()
+	if !myRunner.InProcess {
+		myRunner.mutex.Lock()
+		if myRunner.process != nil {
+			myRunner.process.Signal(syscall.SIGTERM)
+		}
+		myRunner.mutex.Unlock()
+	}
+
+	select {
+	case <-myRunner.stopped:
+		return
+	case <-time.After(timeout):
+	}
+	if myRunner.InProcess {
+		myRunner.log.Warn("The service didn't stop in time", "timeout", timeout)
+		return
+	}
+	myRunner.log.Warn("Killing the service, which didn't stop in time", "timeout", timeout)
+	myRunner.mutex.Lock()
+	if myRunner.process != nil {
+		myRunner.process.Kill()
+	}
+	myRunner.mutex.Unlock()
+	<-myRunner.stopped
+}
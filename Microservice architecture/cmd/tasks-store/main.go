@@ -0,0 +1,11 @@
+// tasks-store keeps the tasks.
+package main
+
+import (
+	"../../Database"
+	"../../service"
+)
+
+func main() {
+	database.Main(service.Configure("tasks-store", "address", "config-store"))
+}
@@ -0,0 +1,11 @@
+// worker processes the images.
+package main
+
+import (
+	"../../Worker"
+	"../../service"
+)
+
+func main() {
+	worker.Main(service.Configure("worker", "config-store", "threads"))
+}
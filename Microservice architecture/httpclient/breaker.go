@@ -0,0 +1,75 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	closed   breakerState = iota // Requests pass.
+	open                         // Requests fail right away.
+	halfOpen                     // A single request is on its way to check the upstream.
+)
+
+type breaker struct {
+	threshold    int
+	openDuration time.Duration
+
+	state    breakerState
+	failures int // In a row
+	openedAt time.Time
+	mutex    sync.Mutex
+}
+
+func (c *Client) breaker(upstream string) *breaker {
+	c.breakersMutex.Lock()
+	defer c.breakersMutex.Unlock()
+	myBreaker, ok := c.breakers[upstream]
+	if !ok {
+		myBreaker = &breaker{threshold: c.FailureThreshold, openDuration: c.OpenDuration}
+		c.breakers[upstream] = myBreaker
+	}
+	return myBreaker
+}
+
+func (b *breaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case open:
+		if time.Since(b.openedAt) < b.openDuration {
+			return false
+		}
+		b.state = halfOpen
+		return true
+	case halfOpen:
+		return false
+	}
+	return true
+}
+
+func (b *breaker) record(success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if success {
+		b.state = closed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == halfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.state = open
+		b.openedAt = time.Now()
+	}
+}
+
+// cancelled lets the next request check the upstream, if the one which was to do so didn't get an answer.
+func (b *breaker) cancelled() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state == halfOpen {
+		b.state = open
+	}
+}
@@ -0,0 +1,195 @@
+// Package httpclient is the HTTP client the services use to talk to each other.
+//
+// Every attempt has a timeout and follows the context of the caller. Idempotent requests are retried a few times,
+// with a random delay, when the upstream is unreachable or overloaded. Each upstream has a circuit breaker, so that
+// a dead service fails fast instead of tying up its callers. Responses are read completely and closed before they're
+// returned, so no caller can leak a connection. Each call is a span of the trace of the caller, whose request id and
+// trace are passed on in the headers.
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"../tracing"
+)
+
+// Response is a response whose body has already been read.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+type Client struct {
+	Timeout     time.Duration // For each attempt.
+	MaxAttempts int           // How often idempotent requests are tried.
+	RetryDelay  time.Duration // The delay before the first retry, it doubles with every further one.
+
+	// After FailureThreshold failures in a row the breaker of the upstream opens, and requests to it fail
+	// right away for OpenDuration. Then a single request is let through to check if the upstream is back.
+	FailureThreshold int
+	OpenDuration     time.Duration
+
+	client        *http.Client
+	breakers      map[string]*breaker
+	breakersMutex sync.Mutex
+}
+
+var ErrCircuitOpen = errors.New("Error: circuit breaker open, the service is considered down.")
+
+func New(timeout time.Duration) *Client {
+	return &Client{
+		Timeout:          timeout,
+		MaxAttempts:      3,
+		RetryDelay:       time.Millisecond * 100,
+		FailureThreshold: 5,
+		OpenDuration:     time.Second * 10,
+		client:           &http.Client{},
+		breakers:         make(map[string]*breaker),
+	}
+}
+
+// Default is used for the calls between the services.
+var Default = New(time.Second * 10)
+
+func Get(ctx context.Context, url string) (*Response, error) {
+	return Default.Get(ctx, url)
+}
+
+func Post(ctx context.Context, url string, contentType string, body []byte) (*Response, error) {
+	return Default.Post(ctx, url, contentType, body)
+}
+
+// Get is retried, as reading doesn't change anything.
+func (c *Client) Get(ctx context.Context, url string) (*Response, error) {
+	return c.Do(ctx, http.MethodGet, url, nil, nil, true)
+}
+
+// Post isn't retried, as the upstream may have processed the request before failing.
+func (c *Client) Post(ctx context.Context, url string, contentType string, body []byte) (*Response, error) {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	return c.Do(ctx, http.MethodPost, url, header, body, false)
+}
+
+// Do sends the request. Only requests marked idempotent are retried.
+func (c *Client) Do(ctx context.Context, method string, rawURL string, header http.Header, body []byte, idempotent bool) (response *Response, err error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	ctx, span := tracing.Start(ctx, method+" "+parsedURL.Host+parsedURL.Path, tracing.Client)
+	span.SetAttribute("http.method", method)
+	span.SetAttribute("http.url", parsedURL.Host+parsedURL.Path)
+	defer func() {
+		if response != nil {
+			span.SetAttribute("http.status_code", response.StatusCode)
+			if isServerFailure(response.StatusCode) {
+				span.SetError(errors.New(http.StatusText(response.StatusCode)))
+			}
+		}
+		span.SetError(err)
+		span.End()
+	}()
+	upstream := c.breaker(parsedURL.Host)
+
+	attempts := 1
+	if idempotent && c.MaxAttempts > 1 {
+		attempts = c.MaxAttempts
+	}
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			err = sleep(ctx, jitter(c.RetryDelay<<uint(attempt-1)))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !upstream.allow() {
+			return nil, ErrCircuitOpen
+		}
+		response, err = c.attempt(ctx, method, rawURL, header, body)
+		if ctx.Err() != nil {
+			// The caller gave up, which says nothing about the upstream.
+			upstream.cancelled()
+			return nil, ctx.Err()
+		}
+		failed := err != nil || isServerFailure(response.StatusCode)
+		upstream.record(!failed)
+
+		if !isRetryable(response, err) {
+			break
+		}
+	}
+	return response, err
+}
+
+func (c *Client) attempt(ctx context.Context, method string, url string, header http.Header, body []byte) (*Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	request, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request = request.WithContext(ctx)
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	tracing.Inject(ctx, request.Header.Set)
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{StatusCode: response.StatusCode, Header: response.Header, Body: data}, nil
+}
+
+// isServerFailure tells whether the status means the upstream is in trouble. 501 is a deliberate answer.
+func isServerFailure(status int) bool {
+	return status >= 500 && status != http.StatusNotImplemented
+}
+
+func isRetryable(response *Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch response.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
+
+// jitter picks a random delay up to the given one, so that callers failing together don't retry together.
+func jitter(delay time.Duration) time.Duration {
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay)))
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,116 +1,211 @@
-package main
+package keyvaluestore
 
 import (
 	"net/http"
 	"sync"
-	"net/url"
 	"fmt"
+	"strings"
+	"time"
+
+	"../metrics"
+	"../service"
 )
 
 var keyValueStore map[string]string
 var kVStoreMutex sync.RWMutex
 
-func main() {
+// Keys set through /acquire are leases, which expire unless their holder renews them.
+var leaseExpiries map[string]time.Time
+
+var leasesExpired = metrics.NewCounter("keyvaluestore_lease_expirations_total", "Leases which ran out without being renewed or released", "key")
+
+func init() {
+	metrics.NewLabeledGaugeFunc("keyvaluestore_keys", "Keys in the store", "kind", func() map[string]float64 {
+		kVStoreMutex.RLock()
+		defer kVStoreMutex.RUnlock()
+		return map[string]float64{"lease": float64(len(leaseExpiries)), "value": float64(len(keyValueStore) - len(leaseExpiries))}
+	})
+}
+
+// Main runs the config store, on the address of args if there is one.
+func Main(args []string) {
+	address := ":3000"
+	if len(args) > 0 {
+		address = args[0]
+	}
 	keyValueStore = make(map[string]string)
+	leaseExpiries = make(map[string]time.Time)
 	kVStoreMutex = sync.RWMutex{}
-	http.HandleFunc("/get", get)
-	http.HandleFunc("/set", set)
-	http.HandleFunc("/remove", remove)
-	http.HandleFunc("/list", list)
-	http.ListenAndServe(":3000", nil)
-}
+	go expireLeases()
 
-func get(w http.ResponseWriter, r *http.Request) {
-	if(r.Method == http.MethodGet) {
-		values, err := url.ParseQuery(r.URL.RawQuery)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
-		if len(values.Get("key")) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:","Wrong input key.")
-			return
-		}
+	myService := service.New("config-store", address, "")
+	myService.Handle("/get", service.Methods{http.MethodGet: get})
+	myService.Handle("/set", service.Methods{http.MethodPost: set})
+	myService.Handle("/acquire", service.Methods{http.MethodPost: acquire})
+	myService.Handle("/release", service.Methods{http.MethodPost: release})
+	myService.Handle("/remove", service.Methods{http.MethodDelete: remove})
+	myService.Handle("/list", service.Methods{http.MethodGet: list})
+	err := myService.Run()
+	if err != nil {
+		service.Fatal(err)
+	}
+}
 
-		kVStoreMutex.RLock()
-		value := keyValueStore[string(values.Get("key"))]
-		kVStoreMutex.RUnlock()
+func get(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+	key, err := service.Required(values, "key")
+	if err != nil {
+		return err
+	}
 
-		fmt.Fprint(w, value)
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only GET accepted.")
+	kVStoreMutex.RLock()
+	value := keyValueStore[key]
+	if isExpired(key) {
+		value = ""
 	}
+	kVStoreMutex.RUnlock()
+
+	fmt.Fprint(w, value)
+	return nil
 }
 
-func set(w http.ResponseWriter, r *http.Request) {
-	if(r.Method == http.MethodPost) {
-		values, err := url.ParseQuery(r.URL.RawQuery)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
-		if len(values.Get("key")) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", "Wrong input key.")
-			return
-		}
-		if len(values.Get("value")) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", "Wrong input value.")
-			return
-		}
+func set(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+	key, err := service.Required(values, "key")
+	if err != nil {
+		return err
+	}
+	value, err := service.Required(values, "value")
+	if err != nil {
+		return err
+	}
 
-		kVStoreMutex.Lock()
-		keyValueStore[string(values.Get("key"))] = string(values.Get("value"))
-		kVStoreMutex.Unlock()
+	kVStoreMutex.Lock()
+	keyValueStore[key] = value
+	delete(leaseExpiries, key)
+	kVStoreMutex.Unlock()
+
+	fmt.Fprint(w, "success")
+	return nil
+}
 
-		fmt.Fprint(w, "success")
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only POST accepted.")
+// acquire sets the key to the value for ttl, unless the lease of another value on it hasn't expired yet.
+// The holder renews its lease by acquiring it again.
+func acquire(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
 	}
+	key, err := service.Required(values, "key")
+	if err != nil {
+		return err
+	}
+	value, err := service.Required(values, "value")
+	if err != nil {
+		return err
+	}
+	ttl, err := time.ParseDuration(values.Get("ttl"))
+	if err != nil || ttl <= 0 {
+		return service.WrongInput("Wrong input: ttl must be a positive duration")
+	}
+
+	kVStoreMutex.Lock()
+	defer kVStoreMutex.Unlock()
+	holder := keyValueStore[key]
+	_, isLease := leaseExpiries[key]
+	if holder != value && isLease && !isExpired(key) {
+		return service.NewError(http.StatusConflict, "lease_held", "The lease is held by "+holder)
+	}
+	keyValueStore[key] = value
+	leaseExpiries[key] = time.Now().Add(ttl)
+
+	fmt.Fprint(w, "success")
+	return nil
 }
 
-func remove(w http.ResponseWriter, r *http.Request) {
-	if(r.Method == http.MethodDelete) {
-		values, err := url.ParseQuery(r.URL.RawQuery)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", err)
-			return
-		}
-		if len(values.Get("key")) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, "Error:", "Wrong input key.")
-			return
-		}
+// release ends the lease on the key, if the value still holds it.
+func release(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+	key, err := service.Required(values, "key")
+	if err != nil {
+		return err
+	}
+	value, err := service.Required(values, "value")
+	if err != nil {
+		return err
+	}
 
-		kVStoreMutex.Lock()
-		delete(keyValueStore, values.Get("key"))
-		kVStoreMutex.Unlock()
+	kVStoreMutex.Lock()
+	if keyValueStore[key] == value {
+		delete(keyValueStore, key)
+		delete(leaseExpiries, key)
+	}
+	kVStoreMutex.Unlock()
+
+	fmt.Fprint(w, "success")
+	return nil
+}
 
-		fmt.Fprint(w, "success")
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only DELETE accepted.")
+func remove(w http.ResponseWriter, r *http.Request) error {
+	values, err := service.Query(r)
+	if err != nil {
+		return err
+	}
+	key, err := service.Required(values, "key")
+	if err != nil {
+		return err
 	}
+
+	kVStoreMutex.Lock()
+	delete(keyValueStore, key)
+	delete(leaseExpiries, key)
+	kVStoreMutex.Unlock()
+
+	fmt.Fprint(w, "success")
+	return nil
 }
 
-func list(w http.ResponseWriter, r *http.Request) {
-	if(r.Method == http.MethodGet) {
-		kVStoreMutex.RLock()
-		for key, value := range keyValueStore {
-			fmt.Fprintln(w, key, ":", value)
+// list writes a "key : value" line per key, only those starting with the prefix parameter if there is one.
+func list(w http.ResponseWriter, r *http.Request) error {
+	prefix := r.URL.Query().Get("prefix")
+	kVStoreMutex.RLock()
+	for key, value := range keyValueStore {
+		if isExpired(key) || !strings.HasPrefix(key, prefix) {
+			continue
 		}
-		kVStoreMutex.RUnlock()
-	} else {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Error: Only GET accepted.")
+		fmt.Fprintln(w, key, ":", value)
 	}
+	kVStoreMutex.RUnlock()
+	return nil
 }
 
+// expireLeases removes the leases which ran out, so that they're counted. Until then isExpired hides them.
+func expireLeases() {
+	for {
+		time.Sleep(time.Second)
+		kVStoreMutex.Lock()
+		for key := range leaseExpiries {
+			if isExpired(key) {
+				delete(keyValueStore, key)
+				delete(leaseExpiries, key)
+				leasesExpired.Inc(key)
+			}
+		}
+		kVStoreMutex.Unlock()
+	}
+}
 
+// isExpired tells whether the key is a lease which hasn't been renewed in time. The caller holds the mutex.
+func isExpired(key string) bool {
+	expiry, ok := leaseExpiries[key]
+	return ok && time.Now().After(expiry)
+}
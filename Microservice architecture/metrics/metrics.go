@@ -0,0 +1,302 @@
+// Package metrics counts what the services do, for Prometheus to scrape from their /metrics endpoint in its text
+// format. A metric is declared once, usually as a package variable, with the names of its labels, and given the
+// values of the labels when it's updated:
+//
+//	var tasksClaimed = metrics.NewCounter("tasks_claimed_total", "Tasks handed out to the workers", "operation")
+//
+//	tasksClaimed.Inc(task.Operation)
+//
+// Gauges which are cheaper to compute when scraped, like the length of a queue, are functions instead. The Go
+// runtime stats come with every scrape.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets of a histogram of latencies.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// family is a registered metric, with all the values of its labels.
+type family interface {
+	write(out *bytes.Buffer)
+}
+
+var registry struct {
+	sync.Mutex
+	families map[string]family
+}
+
+// register adds the metric. Declaring two metrics of the same name is a mistake of the program.
+func register(name string, metric family) {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.families == nil {
+		registry.families = make(map[string]family)
+	}
+	if _, ok := registry.families[name]; ok {
+		panic("metrics: " + name + " declared twice")
+	}
+	registry.families[name] = metric
+}
+
+// vec holds the series of a metric, one per combination of the values of its labels.
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	buckets     []uint64 // Of a histogram, not cumulative.
+	count       uint64
+}
+
+func (v *vec) init(name, help, kind string, labels []string) {
+	v.name, v.help, v.kind, v.labels = name, help, kind, labels
+	v.series = make(map[string]*series)
+}
+
+// get returns the series of the label values. The caller holds the mutex.
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s has the labels %v, got %d values", v.name, v.labels, len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	mySeries, ok := v.series[key]
+	if !ok {
+		mySeries = &series{labelValues: append([]string{}, labelValues...)}
+		v.series[key] = mySeries
+	}
+	return mySeries
+}
+
+// sorted returns the series ordered by their label values. The caller holds the mutex.
+func (v *vec) sorted() []*series {
+	keys := []string{}
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := []*series{}
+	for _, key := range keys {
+		result = append(result, v.series[key])
+	}
+	return result
+}
+
+func (v *vec) writeHeader(out *bytes.Buffer) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.kind)
+}
+
+func (v *vec) write(out *bytes.Buffer) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.writeHeader(out)
+	for _, mySeries := range v.sorted() {
+		writeSample(out, v.name, v.labels, mySeries.labelValues, mySeries.value)
+	}
+}
+
+// Counter is a number which only goes up, like the requests served.
+type Counter struct {
+	vec
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	counter := &Counter{}
+	counter.init(name, help, "counter", labels)
+	register(name, counter)
+	return counter
+}
+
+func (counter *Counter) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+// Add adds a value, which mustn't be negative.
+func (counter *Counter) Add(value float64, labelValues ...string) {
+	counter.mutex.Lock()
+	counter.get(labelValues).value += value
+	counter.mutex.Unlock()
+}
+
+// Gauge is a number which goes up and down, like the tasks running.
+type Gauge struct {
+	vec
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	gauge := &Gauge{}
+	gauge.init(name, help, "gauge", labels)
+	register(name, gauge)
+	return gauge
+}
+
+func (gauge *Gauge) Set(value float64, labelValues ...string) {
+	gauge.mutex.Lock()
+	gauge.get(labelValues).value = value
+	gauge.mutex.Unlock()
+}
+
+func (gauge *Gauge) Add(value float64, labelValues ...string) {
+	gauge.mutex.Lock()
+	gauge.get(labelValues).value += value
+	gauge.mutex.Unlock()
+}
+
+// Histogram counts observations, like the durations of requests, in buckets.
+type Histogram struct {
+	vec
+	bounds []float64
+}
+
+// NewHistogram declares a histogram with the upper bounds of its buckets, in ascending order. A bucket for
+// everything above them is added.
+func NewHistogram(name, help string, bounds []float64, labels ...string) *Histogram {
+	histogram := &Histogram{bounds: bounds}
+	histogram.init(name, help, "histogram", labels)
+	register(name, histogram)
+	return histogram
+}
+
+func (histogram *Histogram) Observe(value float64, labelValues ...string) {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+	mySeries := histogram.get(labelValues)
+	if mySeries.buckets == nil {
+		mySeries.buckets = make([]uint64, len(histogram.bounds)+1)
+	}
+	mySeries.buckets[sort.SearchFloat64s(histogram.bounds, value)]++
+	mySeries.value += value
+	mySeries.count++
+}
+
+func (histogram *Histogram) write(out *bytes.Buffer) {
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+	histogram.writeHeader(out)
+	labels := append(append([]string{}, histogram.labels...), "le")
+	for _, mySeries := range histogram.sorted() {
+		var cumulative uint64
+		for i, bound := range append(append([]float64{}, histogram.bounds...), math.Inf(1)) {
+			cumulative += mySeries.buckets[i]
+			writeSample(out, histogram.name+"_bucket", labels, append(append([]string{}, mySeries.labelValues...), formatValue(bound)), float64(cumulative))
+		}
+		writeSample(out, histogram.name+"_sum", histogram.labels, mySeries.labelValues, mySeries.value)
+		writeSample(out, histogram.name+"_count", histogram.labels, mySeries.labelValues, float64(mySeries.count))
+	}
+}
+
+// gaugeFunc is a gauge computed when it's scraped.
+type gaugeFunc struct {
+	vec
+	values func() map[string]float64
+}
+
+// NewGaugeFunc declares a gauge whose value is computed when it's scraped.
+func NewGaugeFunc(name, help string, value func() float64) {
+	NewLabeledGaugeFunc(name, help, "", func() map[string]float64 {
+		return map[string]float64{"": value()}
+	})
+}
+
+// NewLabeledGaugeFunc declares a gauge computed when it's scraped, with a value for each value of its label.
+func NewLabeledGaugeFunc(name, help string, label string, values func() map[string]float64) {
+	gauge := &gaugeFunc{values: values}
+	labels := []string{label}
+	if len(label) == 0 {
+		labels = nil
+	}
+	gauge.init(name, help, "gauge", labels)
+	register(name, gauge)
+}
+
+func (gauge *gaugeFunc) write(out *bytes.Buffer) {
+	values := gauge.values()
+	gauge.writeHeader(out)
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeSample(out, gauge.name, gauge.labels, []string{key}, values[key])
+	}
+}
+
+func writeSample(out *bytes.Buffer, name string, labels []string, labelValues []string, value float64) {
+	out.WriteString(name)
+	if len(labels) != 0 {
+		out.WriteByte('{')
+		for i, label := range labels {
+			if i != 0 {
+				out.WriteByte(',')
+			}
+			out.WriteString(label + `="` + escapeLabelValue(labelValues[i]) + `"`)
+		}
+		out.WriteByte('}')
+	}
+	out.WriteString(" " + formatValue(value) + "\n")
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+// Handler serves all the metrics of the program, ordered by their names, and the stats of the Go runtime.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registry.Lock()
+		names := []string{}
+		for name := range registry.families {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		families := []family{}
+		for _, name := range names {
+			families = append(families, registry.families[name])
+		}
+		registry.Unlock()
+
+		out := &bytes.Buffer{}
+		for _, metric := range families {
+			metric.write(out)
+		}
+		writeRuntimeStats(out)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(out.Bytes())
+	})
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// The stats of the Go runtime, under the names the official Prometheus client gives them, so that the usual
+// dashboards work.
+
+var startTime = time.Now()
+
+func writeRuntimeStats(out *bytes.Buffer) {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+
+	gauge := func(name, help string, value float64) {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		writeSample(out, name, nil, nil, value)
+	}
+	counter := func(name, help string, value float64) {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		writeSample(out, name, nil, nil, value)
+	}
+
+	fmt.Fprintf(out, "# HELP go_gc_duration_seconds A summary of the pause duration of garbage collection cycles.\n# TYPE go_gc_duration_seconds summary\n")
+	writeSample(out, "go_gc_duration_seconds_sum", nil, nil, float64(memory.PauseTotalNs)/1e9)
+	writeSample(out, "go_gc_duration_seconds_count", nil, nil, float64(memory.NumGC))
+	gauge("go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	fmt.Fprintf(out, "# HELP go_info Information about the Go environment.\n# TYPE go_info gauge\n")
+	writeSample(out, "go_info", []string{"version"}, []string{runtime.Version()}, 1)
+	gauge("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", float64(memory.Alloc))
+	counter("go_memstats_alloc_bytes_total", "Total number of bytes allocated, even if freed.", float64(memory.TotalAlloc))
+	counter("go_memstats_frees_total", "Total number of frees.", float64(memory.Frees))
+	gauge("go_memstats_heap_alloc_bytes", "Number of heap bytes allocated and still in use.", float64(memory.HeapAlloc))
+	gauge("go_memstats_heap_idle_bytes", "Number of heap bytes waiting to be used.", float64(memory.HeapIdle))
+	gauge("go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", float64(memory.HeapInuse))
+	gauge("go_memstats_heap_objects", "Number of allocated objects.", float64(memory.HeapObjects))
+	gauge("go_memstats_heap_sys_bytes", "Number of heap bytes obtained from system.", float64(memory.HeapSys))
+	gauge("go_memstats_last_gc_time_seconds", "Number of seconds since 1970 of last garbage collection.", float64(memory.LastGC)/1e9)
+	counter("go_memstats_mallocs_total", "Total number of mallocs.", float64(memory.Mallocs))
+	gauge("go_memstats_next_gc_bytes", "Number of heap bytes when next garbage collection will take place.", float64(memory.NextGC))
+	gauge("go_memstats_stack_inuse_bytes", "Number of bytes in use by the stack allocator.", float64(memory.StackInuse))
+	gauge("go_memstats_sys_bytes", "Number of bytes obtained from system.", float64(memory.Sys))
+	gauge("go_threads", "Number of OS threads created.", float64(pprof.Lookup("threadcreate").Count()))
+	gauge("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", float64(startTime.UnixNano())/1e9)
+}
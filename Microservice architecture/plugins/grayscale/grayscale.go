@@ -0,0 +1,60 @@
+// grayscale is an example plugin of the worker. It turns the image into shades of gray, and inverts them if asked to.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+)
+
+type parameters struct {
+	Invert bool `json:"invert"`
+}
+
+func main() {
+	err := run()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	myParameters := parameters{}
+	err := json.Unmarshal([]byte(os.Getenv("PLUGIN_PARAMETERS")), &myParameters)
+	if err != nil {
+		return fmt.Errorf("Invalid parameters: %v", err)
+	}
+
+	input, err := os.Open(os.Getenv("PLUGIN_INPUT"))
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	myImage, err := png.Decode(input)
+	if err != nil {
+		return err
+	}
+
+	bounds := myImage.Bounds()
+	myCanvas := image.NewGray(bounds)
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			gray := color.GrayModel.Convert(myImage.At(x, y)).(color.Gray)
+			if myParameters.Invert {
+				gray.Y = 255 - gray.Y
+			}
+			myCanvas.SetGray(x, y, gray)
+		}
+	}
+
+	output, err := os.Create(os.Getenv("PLUGIN_OUTPUT"))
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+	return png.Encode(output, myCanvas)
+}
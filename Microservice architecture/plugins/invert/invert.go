@@ -0,0 +1,58 @@
+//go:build wasip1
+
+// invert is an example WebAssembly plugin of the worker. It inverts the colours of the image, blended with the original
+// by the amount given as parameter. Build it with:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o invert.wasm
+package main
+
+import (
+	"encoding/json"
+	"unsafe"
+)
+
+type parameters struct {
+	Amount float64 `json:"amount"`
+}
+
+// The buffers handed out to the worker, so that they aren't garbage collected.
+var buffers = map[uint32][]byte{}
+
+func main() {}
+
+//go:wasmexport alloc
+func alloc(size uint32) uint32 {
+	buffer := make([]byte, size)
+	if size == 0 {
+		return 0
+	}
+	pointer := uint32(uintptr(unsafe.Pointer(&buffer[0])))
+	buffers[pointer] = buffer
+	return pointer
+}
+
+//go:wasmexport process
+func process(pixels uint32, width uint32, height uint32, parametersPointer uint32, parametersLength uint32) uint32 {
+	myParameters := parameters{}
+	err := json.Unmarshal(buffers[parametersPointer][:parametersLength], &myParameters)
+	if err != nil {
+		fail(err.Error())
+		return 1
+	}
+
+	rgba := buffers[pixels][:width*height*4]
+	for i := 0; i < len(rgba); i += 4 {
+		for c := i; c < i+3; c++ {
+			rgba[c] = uint8(float64(rgba[c]) + myParameters.Amount*(255-2*float64(rgba[c])))
+		}
+	}
+	return 0
+}
+
+//go:wasmimport env error
+func reportError(message unsafe.Pointer, length uint32)
+
+func fail(message string) {
+	data := []byte(message)
+	reportError(unsafe.Pointer(&data[0]), uint32(len(data)))
+}
@@ -0,0 +1,2285 @@
+// The interface between the services. The HTTP endpoints stay for the frontend and the clients outside.
+//
+// After changing this file, regenerate the Go code in this directory:
+//
+//	protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative imageservice.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: imageservice.proto
+
+package rpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// The states of a task, numbered as in the tasks-store.
+type TaskState int32
+
+const (
+	TaskState_TASK_STATE_NOT_STARTED TaskState = 0
+	TaskState_TASK_STATE_IN_PROGRESS TaskState = 1
+	TaskState_TASK_STATE_FINISHED    TaskState = 2
+	TaskState_TASK_STATE_PENDING     TaskState = 3 // The image is still being submitted, workers mustn't take the task yet.
+	TaskState_TASK_STATE_FAILED      TaskState = 4 // The submission was rolled back, processing failed for good, or the task was canceled.
+)
+
+// Enum value maps for TaskState.
+var (
+	TaskState_name = map[int32]string{
+		0: "TASK_STATE_NOT_STARTED",
+		1: "TASK_STATE_IN_PROGRESS",
+		2: "TASK_STATE_FINISHED",
+		3: "TASK_STATE_PENDING",
+		4: "TASK_STATE_FAILED",
+	}
+	TaskState_value = map[string]int32{
+		"TASK_STATE_NOT_STARTED": 0,
+		"TASK_STATE_IN_PROGRESS": 1,
+		"TASK_STATE_FINISHED":    2,
+		"TASK_STATE_PENDING":     3,
+		"TASK_STATE_FAILED":      4,
+	}
+)
+
+func (x TaskState) Enum() *TaskState {
+	p := new(TaskState)
+	*p = x
+	return p
+}
+
+func (x TaskState) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TaskState) Descriptor() protoreflect.EnumDescriptor {
+	return file_imageservice_proto_enumTypes[0].Descriptor()
+}
+
+func (TaskState) Type() protoreflect.EnumType {
+	return &file_imageservice_proto_enumTypes[0]
+}
+
+func (x TaskState) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TaskState.Descriptor instead.
+func (TaskState) EnumDescriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{0}
+}
+
+type ImageState int32
+
+const (
+	ImageState_IMAGE_STATE_UNSPECIFIED ImageState = 0
+	ImageState_IMAGE_STATE_STAGING     ImageState = 1 // Uploaded, but without a task yet.
+	ImageState_IMAGE_STATE_WORKING     ImageState = 2
+	ImageState_IMAGE_STATE_FINISHED    ImageState = 3
+)
+
+// Enum value maps for ImageState.
+var (
+	ImageState_name = map[int32]string{
+		0: "IMAGE_STATE_UNSPECIFIED",
+		1: "IMAGE_STATE_STAGING",
+		2: "IMAGE_STATE_WORKING",
+		3: "IMAGE_STATE_FINISHED",
+	}
+	ImageState_value = map[string]int32{
+		"IMAGE_STATE_UNSPECIFIED": 0,
+		"IMAGE_STATE_STAGING":     1,
+		"IMAGE_STATE_WORKING":     2,
+		"IMAGE_STATE_FINISHED":    3,
+	}
+)
+
+func (x ImageState) Enum() *ImageState {
+	p := new(ImageState)
+	*p = x
+	return p
+}
+
+func (x ImageState) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ImageState) Descriptor() protoreflect.EnumDescriptor {
+	return file_imageservice_proto_enumTypes[1].Descriptor()
+}
+
+func (ImageState) Type() protoreflect.EnumType {
+	return &file_imageservice_proto_enumTypes[1]
+}
+
+func (x ImageState) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ImageState.Descriptor instead.
+func (ImageState) EnumDescriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{1}
+}
+
+type Task struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	State         TaskState              `protobuf:"varint,2,opt,name=state,proto3,enum=imageservice.TaskState" json:"state,omitempty"`
+	Metadata      []byte                 `protobuf:"bytes,3,opt,name=metadata,proto3" json:"metadata,omitempty"`  // JSON, as extracted by the images-store. The tasks-store keeps it opaque.
+	Progress      int32                  `protobuf:"varint,4,opt,name=progress,proto3" json:"progress,omitempty"` // Percent, as reported by the worker.
+	Error         string                 `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	StartedAt     *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	FinishedAt    *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"`
+	Callback      string                 `protobuf:"bytes,9,opt,name=callback,proto3" json:"callback,omitempty"` // URL to notify when the task finishes or fails.
+	Client        string                 `protobuf:"bytes,10,opt,name=client,proto3" json:"client,omitempty"`
+	Deliveries    []*Delivery            `protobuf:"bytes,11,rep,name=deliveries,proto3" json:"deliveries,omitempty"`
+	ErrorCode     string                 `protobuf:"bytes,12,opt,name=error_code,json=errorCode,proto3" json:"error_code,omitempty"` // Machine readable kind of the error, like "invalid_image".
+	Attempts      int32                  `protobuf:"varint,13,opt,name=attempts,proto3" json:"attempts,omitempty"`                   // How often a worker claimed the task.
+	Worker        string                 `protobuf:"bytes,14,opt,name=worker,proto3" json:"worker,omitempty"`                        // The worker which claimed the task last.
+	Operation     string                 `protobuf:"bytes,15,opt,name=operation,proto3" json:"operation,omitempty"`                  // What the worker does with the image, like "swapChannels".
+	Parameters    []byte                 `protobuf:"bytes,16,opt,name=parameters,proto3" json:"parameters,omitempty"`                // JSON object with the parameters of the operation.
+	Trace         string                 `protobuf:"bytes,17,opt,name=trace,proto3" json:"trace,omitempty"`                          // W3C traceparent of the submission, which the processing of the task continues.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Task) Reset() {
+	*x = Task{}
+	mi := &file_imageservice_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Task) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Task) ProtoMessage() {}
+
+func (x *Task) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Task.ProtoReflect.Descriptor instead.
+func (*Task) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Task) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Task) GetState() TaskState {
+	if x != nil {
+		return x.State
+	}
+	return TaskState_TASK_STATE_NOT_STARTED
+}
+
+func (x *Task) GetMetadata() []byte {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *Task) GetProgress() int32 {
+	if x != nil {
+		return x.Progress
+	}
+	return 0
+}
+
+func (x *Task) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Task) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Task) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+func (x *Task) GetFinishedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FinishedAt
+	}
+	return nil
+}
+
+func (x *Task) GetCallback() string {
+	if x != nil {
+		return x.Callback
+	}
+	return ""
+}
+
+func (x *Task) GetClient() string {
+	if x != nil {
+		return x.Client
+	}
+	return ""
+}
+
+func (x *Task) GetDeliveries() []*Delivery {
+	if x != nil {
+		return x.Deliveries
+	}
+	return nil
+}
+
+func (x *Task) GetErrorCode() string {
+	if x != nil {
+		return x.ErrorCode
+	}
+	return ""
+}
+
+func (x *Task) GetAttempts() int32 {
+	if x != nil {
+		return x.Attempts
+	}
+	return 0
+}
+
+func (x *Task) GetWorker() string {
+	if x != nil {
+		return x.Worker
+	}
+	return ""
+}
+
+func (x *Task) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *Task) GetParameters() []byte {
+	if x != nil {
+		return x.Parameters
+	}
+	return nil
+}
+
+func (x *Task) GetTrace() string {
+	if x != nil {
+		return x.Trace
+	}
+	return ""
+}
+
+// Delivery is an attempt of the Master to notify the callback URL of a task.
+type Delivery struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Event         string                 `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
+	Attempt       int32                  `protobuf:"varint,2,opt,name=attempt,proto3" json:"attempt,omitempty"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=time,proto3" json:"time,omitempty"`
+	StatusCode    int32                  `protobuf:"varint,4,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	Error         string                 `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Delivery) Reset() {
+	*x = Delivery{}
+	mi := &file_imageservice_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Delivery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Delivery) ProtoMessage() {}
+
+func (x *Delivery) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Delivery.ProtoReflect.Descriptor instead.
+func (*Delivery) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Delivery) GetEvent() string {
+	if x != nil {
+		return x.Event
+	}
+	return ""
+}
+
+func (x *Delivery) GetAttempt() int32 {
+	if x != nil {
+		return x.Attempt
+	}
+	return 0
+}
+
+func (x *Delivery) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Delivery) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *Delivery) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type TaskId struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Worker        string                 `protobuf:"bytes,2,opt,name=worker,proto3" json:"worker,omitempty"` // For changes by a worker, the one which has to hold the claim of the task.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TaskId) Reset() {
+	*x = TaskId{}
+	mi := &file_imageservice_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TaskId) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TaskId) ProtoMessage() {}
+
+func (x *TaskId) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TaskId.ProtoReflect.Descriptor instead.
+func (*TaskId) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *TaskId) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *TaskId) GetWorker() string {
+	if x != nil {
+		return x.Worker
+	}
+	return ""
+}
+
+type ClaimTaskRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Worker        string                 `protobuf:"bytes,1,opt,name=worker,proto3" json:"worker,omitempty"`         // Who claims the task.
+	Operations    []string               `protobuf:"bytes,2,rep,name=operations,proto3" json:"operations,omitempty"` // Only tasks of these operations are claimed, of any if empty.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClaimTaskRequest) Reset() {
+	*x = ClaimTaskRequest{}
+	mi := &file_imageservice_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClaimTaskRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClaimTaskRequest) ProtoMessage() {}
+
+func (x *ClaimTaskRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClaimTaskRequest.ProtoReflect.Descriptor instead.
+func (*ClaimTaskRequest) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ClaimTaskRequest) GetWorker() string {
+	if x != nil {
+		return x.Worker
+	}
+	return ""
+}
+
+func (x *ClaimTaskRequest) GetOperations() []string {
+	if x != nil {
+		return x.Operations
+	}
+	return nil
+}
+
+type NewTaskRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Pending       bool                   `protobuf:"varint,1,opt,name=pending,proto3" json:"pending,omitempty"`
+	Callback      string                 `protobuf:"bytes,2,opt,name=callback,proto3" json:"callback,omitempty"`
+	Client        string                 `protobuf:"bytes,3,opt,name=client,proto3" json:"client,omitempty"`
+	Operation     string                 `protobuf:"bytes,4,opt,name=operation,proto3" json:"operation,omitempty"`
+	Parameters    []byte                 `protobuf:"bytes,5,opt,name=parameters,proto3" json:"parameters,omitempty"`
+	Trace         string                 `protobuf:"bytes,6,opt,name=trace,proto3" json:"trace,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NewTaskRequest) Reset() {
+	*x = NewTaskRequest{}
+	mi := &file_imageservice_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NewTaskRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NewTaskRequest) ProtoMessage() {}
+
+func (x *NewTaskRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NewTaskRequest.ProtoReflect.Descriptor instead.
+func (*NewTaskRequest) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *NewTaskRequest) GetPending() bool {
+	if x != nil {
+		return x.Pending
+	}
+	return false
+}
+
+func (x *NewTaskRequest) GetCallback() string {
+	if x != nil {
+		return x.Callback
+	}
+	return ""
+}
+
+func (x *NewTaskRequest) GetClient() string {
+	if x != nil {
+		return x.Client
+	}
+	return ""
+}
+
+func (x *NewTaskRequest) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *NewTaskRequest) GetParameters() []byte {
+	if x != nil {
+		return x.Parameters
+	}
+	return nil
+}
+
+func (x *NewTaskRequest) GetTrace() string {
+	if x != nil {
+		return x.Trace
+	}
+	return ""
+}
+
+type AbortTaskRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AbortTaskRequest) Reset() {
+	*x = AbortTaskRequest{}
+	mi := &file_imageservice_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AbortTaskRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AbortTaskRequest) ProtoMessage() {}
+
+func (x *AbortTaskRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AbortTaskRequest.ProtoReflect.Descriptor instead.
+func (*AbortTaskRequest) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *AbortTaskRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *AbortTaskRequest) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type FailTaskRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Code          string                 `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	Transient     bool                   `protobuf:"varint,4,opt,name=transient,proto3" json:"transient,omitempty"` // Whether another attempt might succeed, like when a service was unreachable.
+	Worker        string                 `protobuf:"bytes,5,opt,name=worker,proto3" json:"worker,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FailTaskRequest) Reset() {
+	*x = FailTaskRequest{}
+	mi := &file_imageservice_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FailTaskRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FailTaskRequest) ProtoMessage() {}
+
+func (x *FailTaskRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FailTaskRequest.ProtoReflect.Descriptor instead.
+func (*FailTaskRequest) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *FailTaskRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *FailTaskRequest) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *FailTaskRequest) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *FailTaskRequest) GetTransient() bool {
+	if x != nil {
+		return x.Transient
+	}
+	return false
+}
+
+func (x *FailTaskRequest) GetWorker() string {
+	if x != nil {
+		return x.Worker
+	}
+	return ""
+}
+
+type SetProgressRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Progress      int32                  `protobuf:"varint,2,opt,name=progress,proto3" json:"progress,omitempty"`
+	Worker        string                 `protobuf:"bytes,3,opt,name=worker,proto3" json:"worker,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetProgressRequest) Reset() {
+	*x = SetProgressRequest{}
+	mi := &file_imageservice_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetProgressRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetProgressRequest) ProtoMessage() {}
+
+func (x *SetProgressRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetProgressRequest.ProtoReflect.Descriptor instead.
+func (*SetProgressRequest) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SetProgressRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *SetProgressRequest) GetProgress() int32 {
+	if x != nil {
+		return x.Progress
+	}
+	return 0
+}
+
+func (x *SetProgressRequest) GetWorker() string {
+	if x != nil {
+		return x.Worker
+	}
+	return ""
+}
+
+type SetMetadataRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Metadata      []byte                 `protobuf:"bytes,2,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetMetadataRequest) Reset() {
+	*x = SetMetadataRequest{}
+	mi := &file_imageservice_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetMetadataRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetMetadataRequest) ProtoMessage() {}
+
+func (x *SetMetadataRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetMetadataRequest.ProtoReflect.Descriptor instead.
+func (*SetMetadataRequest) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SetMetadataRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *SetMetadataRequest) GetMetadata() []byte {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+type AddDeliveryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Delivery      *Delivery              `protobuf:"bytes,2,opt,name=delivery,proto3" json:"delivery,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddDeliveryRequest) Reset() {
+	*x = AddDeliveryRequest{}
+	mi := &file_imageservice_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddDeliveryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddDeliveryRequest) ProtoMessage() {}
+
+func (x *AddDeliveryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddDeliveryRequest.ProtoReflect.Descriptor instead.
+func (*AddDeliveryRequest) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *AddDeliveryRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *AddDeliveryRequest) GetDelivery() *Delivery {
+	if x != nil {
+		return x.Delivery
+	}
+	return nil
+}
+
+type ListTasksRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	State         *TaskState             `protobuf:"varint,1,opt,name=state,proto3,enum=imageservice.TaskState,oneof" json:"state,omitempty"`
+	Since         *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=since,proto3" json:"since,omitempty"`        // Only tasks created since then.
+	After         *int64                 `protobuf:"varint,3,opt,name=after,proto3,oneof" json:"after,omitempty"` // The id of the last task of the previous page.
+	Limit         int32                  `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`       // Zero means the default page size.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListTasksRequest) Reset() {
+	*x = ListTasksRequest{}
+	mi := &file_imageservice_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListTasksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListTasksRequest) ProtoMessage() {}
+
+func (x *ListTasksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListTasksRequest.ProtoReflect.Descriptor instead.
+func (*ListTasksRequest) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListTasksRequest) GetState() TaskState {
+	if x != nil && x.State != nil {
+		return *x.State
+	}
+	return TaskState_TASK_STATE_NOT_STARTED
+}
+
+func (x *ListTasksRequest) GetSince() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Since
+	}
+	return nil
+}
+
+func (x *ListTasksRequest) GetAfter() int64 {
+	if x != nil && x.After != nil {
+		return *x.After
+	}
+	return 0
+}
+
+func (x *ListTasksRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type TaskStats struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Counts             map[int32]int64        `protobuf:"bytes,1,rep,name=counts,proto3" json:"counts,omitempty" protobuf_key:"varint,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"` // Number of tasks by TaskState.
+	FinishedLastMinute int64                  `protobuf:"varint,2,opt,name=finished_last_minute,json=finishedLastMinute,proto3" json:"finished_last_minute,omitempty"`
+	FinishedLastHour   int64                  `protobuf:"varint,3,opt,name=finished_last_hour,json=finishedLastHour,proto3" json:"finished_last_hour,omitempty"`
+	RecentFailures     []*Task                `protobuf:"bytes,4,rep,name=recent_failures,json=recentFailures,proto3" json:"recent_failures,omitempty"` // The latest failed tasks, most recent first.
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *TaskStats) Reset() {
+	*x = TaskStats{}
+	mi := &file_imageservice_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TaskStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TaskStats) ProtoMessage() {}
+
+func (x *TaskStats) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TaskStats.ProtoReflect.Descriptor instead.
+func (*TaskStats) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *TaskStats) GetCounts() map[int32]int64 {
+	if x != nil {
+		return x.Counts
+	}
+	return nil
+}
+
+func (x *TaskStats) GetFinishedLastMinute() int64 {
+	if x != nil {
+		return x.FinishedLastMinute
+	}
+	return 0
+}
+
+func (x *TaskStats) GetFinishedLastHour() int64 {
+	if x != nil {
+		return x.FinishedLastHour
+	}
+	return 0
+}
+
+func (x *TaskStats) GetRecentFailures() []*Task {
+	if x != nil {
+		return x.RecentFailures
+	}
+	return nil
+}
+
+type TaskPage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tasks         []*Task                `protobuf:"bytes,1,rep,name=tasks,proto3" json:"tasks,omitempty"`
+	Next          int64                  `protobuf:"varint,2,opt,name=next,proto3" json:"next,omitempty"` // The after of the following page, -1 on the last page.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TaskPage) Reset() {
+	*x = TaskPage{}
+	mi := &file_imageservice_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TaskPage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TaskPage) ProtoMessage() {}
+
+func (x *TaskPage) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TaskPage.ProtoReflect.Descriptor instead.
+func (*TaskPage) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *TaskPage) GetTasks() []*Task {
+	if x != nil {
+		return x.Tasks
+	}
+	return nil
+}
+
+func (x *TaskPage) GetNext() int64 {
+	if x != nil {
+		return x.Next
+	}
+	return 0
+}
+
+type ImageRef struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	State         ImageState             `protobuf:"varint,1,opt,name=state,proto3,enum=imageservice.ImageState" json:"state,omitempty"`
+	Id            int64                  `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`      // The id of the task.
+	Token         string                 `protobuf:"bytes,3,opt,name=token,proto3" json:"token,omitempty"` // Instead of the id, for staged images.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImageRef) Reset() {
+	*x = ImageRef{}
+	mi := &file_imageservice_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImageRef) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImageRef) ProtoMessage() {}
+
+func (x *ImageRef) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImageRef.ProtoReflect.Descriptor instead.
+func (*ImageRef) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ImageRef) GetState() ImageState {
+	if x != nil {
+		return x.State
+	}
+	return ImageState_IMAGE_STATE_UNSPECIFIED
+}
+
+func (x *ImageRef) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *ImageRef) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+type UploadHeader struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Image         *ImageRef              `protobuf:"bytes,1,opt,name=image,proto3" json:"image,omitempty"`
+	ExifPolicy    string                 `protobuf:"bytes,2,opt,name=exif_policy,json=exifPolicy,proto3" json:"exif_policy,omitempty"` // keep, nogps or strip
+	User          string                 `protobuf:"bytes,3,opt,name=user,proto3" json:"user,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadHeader) Reset() {
+	*x = UploadHeader{}
+	mi := &file_imageservice_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadHeader) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadHeader) ProtoMessage() {}
+
+func (x *UploadHeader) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadHeader.ProtoReflect.Descriptor instead.
+func (*UploadHeader) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *UploadHeader) GetImage() *ImageRef {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
+func (x *UploadHeader) GetExifPolicy() string {
+	if x != nil {
+		return x.ExifPolicy
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+// An upload starts with the header, the image follows in chunks.
+type UploadImageRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Part:
+	//
+	//	*UploadImageRequest_Header
+	//	*UploadImageRequest_Chunk
+	Part          isUploadImageRequest_Part `protobuf_oneof:"part"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadImageRequest) Reset() {
+	*x = UploadImageRequest{}
+	mi := &file_imageservice_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadImageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadImageRequest) ProtoMessage() {}
+
+func (x *UploadImageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadImageRequest.ProtoReflect.Descriptor instead.
+func (*UploadImageRequest) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *UploadImageRequest) GetPart() isUploadImageRequest_Part {
+	if x != nil {
+		return x.Part
+	}
+	return nil
+}
+
+func (x *UploadImageRequest) GetHeader() *UploadHeader {
+	if x != nil {
+		if x, ok := x.Part.(*UploadImageRequest_Header); ok {
+			return x.Header
+		}
+	}
+	return nil
+}
+
+func (x *UploadImageRequest) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Part.(*UploadImageRequest_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isUploadImageRequest_Part interface {
+	isUploadImageRequest_Part()
+}
+
+type UploadImageRequest_Header struct {
+	Header *UploadHeader `protobuf:"bytes,1,opt,name=header,proto3,oneof"`
+}
+
+type UploadImageRequest_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*UploadImageRequest_Header) isUploadImageRequest_Part() {}
+
+func (*UploadImageRequest_Chunk) isUploadImageRequest_Part() {}
+
+type ImageChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImageChunk) Reset() {
+	*x = ImageChunk{}
+	mi := &file_imageservice_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImageChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImageChunk) ProtoMessage() {}
+
+func (x *ImageChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImageChunk.ProtoReflect.Descriptor instead.
+func (*ImageChunk) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ImageChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type ImageMetadata struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Json          []byte                 `protobuf:"bytes,1,opt,name=json,proto3" json:"json,omitempty"` // Dimensions, format, EXIF data etc. as JSON.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImageMetadata) Reset() {
+	*x = ImageMetadata{}
+	mi := &file_imageservice_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImageMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImageMetadata) ProtoMessage() {}
+
+func (x *ImageMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImageMetadata.ProtoReflect.Descriptor instead.
+func (*ImageMetadata) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *ImageMetadata) GetJson() []byte {
+	if x != nil {
+		return x.Json
+	}
+	return nil
+}
+
+type PresignedImage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Url           string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PresignedImage) Reset() {
+	*x = PresignedImage{}
+	mi := &file_imageservice_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PresignedImage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PresignedImage) ProtoMessage() {}
+
+func (x *PresignedImage) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PresignedImage.ProtoReflect.Descriptor instead.
+func (*PresignedImage) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *PresignedImage) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+type PromoteImageRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Id            int64                  `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PromoteImageRequest) Reset() {
+	*x = PromoteImageRequest{}
+	mi := &file_imageservice_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PromoteImageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PromoteImageRequest) ProtoMessage() {}
+
+func (x *PromoteImageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PromoteImageRequest.ProtoReflect.Descriptor instead.
+func (*PromoteImageRequest) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *PromoteImageRequest) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *PromoteImageRequest) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+// StorageUsage is what a replica of the images-store holds.
+type StorageUsage struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	StagedImages   int64                  `protobuf:"varint,1,opt,name=staged_images,json=stagedImages,proto3" json:"staged_images,omitempty"`
+	StagedBytes    int64                  `protobuf:"varint,2,opt,name=staged_bytes,json=stagedBytes,proto3" json:"staged_bytes,omitempty"`
+	WorkingImages  int64                  `protobuf:"varint,3,opt,name=working_images,json=workingImages,proto3" json:"working_images,omitempty"`
+	WorkingBytes   int64                  `protobuf:"varint,4,opt,name=working_bytes,json=workingBytes,proto3" json:"working_bytes,omitempty"`
+	FinishedImages int64                  `protobuf:"varint,5,opt,name=finished_images,json=finishedImages,proto3" json:"finished_images,omitempty"`
+	FinishedBytes  int64                  `protobuf:"varint,6,opt,name=finished_bytes,json=finishedBytes,proto3" json:"finished_bytes,omitempty"`
+	MaxBytes       int64                  `protobuf:"varint,7,opt,name=max_bytes,json=maxBytes,proto3" json:"max_bytes,omitempty"` // The limit of the retention policy, 0 without one.
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *StorageUsage) Reset() {
+	*x = StorageUsage{}
+	mi := &file_imageservice_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StorageUsage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StorageUsage) ProtoMessage() {}
+
+func (x *StorageUsage) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StorageUsage.ProtoReflect.Descriptor instead.
+func (*StorageUsage) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *StorageUsage) GetStagedImages() int64 {
+	if x != nil {
+		return x.StagedImages
+	}
+	return 0
+}
+
+func (x *StorageUsage) GetStagedBytes() int64 {
+	if x != nil {
+		return x.StagedBytes
+	}
+	return 0
+}
+
+func (x *StorageUsage) GetWorkingImages() int64 {
+	if x != nil {
+		return x.WorkingImages
+	}
+	return 0
+}
+
+func (x *StorageUsage) GetWorkingBytes() int64 {
+	if x != nil {
+		return x.WorkingBytes
+	}
+	return 0
+}
+
+func (x *StorageUsage) GetFinishedImages() int64 {
+	if x != nil {
+		return x.FinishedImages
+	}
+	return 0
+}
+
+func (x *StorageUsage) GetFinishedBytes() int64 {
+	if x != nil {
+		return x.FinishedBytes
+	}
+	return 0
+}
+
+func (x *StorageUsage) GetMaxBytes() int64 {
+	if x != nil {
+		return x.MaxBytes
+	}
+	return 0
+}
+
+type SubmitHeader struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ExifPolicy    string                 `protobuf:"bytes,1,opt,name=exif_policy,json=exifPolicy,proto3" json:"exif_policy,omitempty"`
+	User          string                 `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
+	Callback      string                 `protobuf:"bytes,3,opt,name=callback,proto3" json:"callback,omitempty"`
+	Client        string                 `protobuf:"bytes,4,opt,name=client,proto3" json:"client,omitempty"`
+	Operation     string                 `protobuf:"bytes,5,opt,name=operation,proto3" json:"operation,omitempty"`   // swapChannels if empty.
+	Parameters    []byte                 `protobuf:"bytes,6,opt,name=parameters,proto3" json:"parameters,omitempty"` // JSON object.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitHeader) Reset() {
+	*x = SubmitHeader{}
+	mi := &file_imageservice_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitHeader) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitHeader) ProtoMessage() {}
+
+func (x *SubmitHeader) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitHeader.ProtoReflect.Descriptor instead.
+func (*SubmitHeader) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *SubmitHeader) GetExifPolicy() string {
+	if x != nil {
+		return x.ExifPolicy
+	}
+	return ""
+}
+
+func (x *SubmitHeader) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *SubmitHeader) GetCallback() string {
+	if x != nil {
+		return x.Callback
+	}
+	return ""
+}
+
+func (x *SubmitHeader) GetClient() string {
+	if x != nil {
+		return x.Client
+	}
+	return ""
+}
+
+func (x *SubmitHeader) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *SubmitHeader) GetParameters() []byte {
+	if x != nil {
+		return x.Parameters
+	}
+	return nil
+}
+
+// A submission starts with the header, the image follows in chunks.
+type SubmitImageRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Part:
+	//
+	//	*SubmitImageRequest_Header
+	//	*SubmitImageRequest_Chunk
+	Part          isSubmitImageRequest_Part `protobuf_oneof:"part"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitImageRequest) Reset() {
+	*x = SubmitImageRequest{}
+	mi := &file_imageservice_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitImageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitImageRequest) ProtoMessage() {}
+
+func (x *SubmitImageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitImageRequest.ProtoReflect.Descriptor instead.
+func (*SubmitImageRequest) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *SubmitImageRequest) GetPart() isSubmitImageRequest_Part {
+	if x != nil {
+		return x.Part
+	}
+	return nil
+}
+
+func (x *SubmitImageRequest) GetHeader() *SubmitHeader {
+	if x != nil {
+		if x, ok := x.Part.(*SubmitImageRequest_Header); ok {
+			return x.Header
+		}
+	}
+	return nil
+}
+
+func (x *SubmitImageRequest) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Part.(*SubmitImageRequest_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isSubmitImageRequest_Part interface {
+	isSubmitImageRequest_Part()
+}
+
+type SubmitImageRequest_Header struct {
+	Header *SubmitHeader `protobuf:"bytes,1,opt,name=header,proto3,oneof"`
+}
+
+type SubmitImageRequest_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*SubmitImageRequest_Header) isSubmitImageRequest_Part() {}
+
+func (*SubmitImageRequest_Chunk) isSubmitImageRequest_Part() {}
+
+type WorkerHello struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Version       string                 `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	Operations    []string               `protobuf:"bytes,3,rep,name=operations,proto3" json:"operations,omitempty"`
+	Token         string                 `protobuf:"bytes,4,opt,name=token,proto3" json:"token,omitempty"` // The shared secret of the workers, if the Master requires one.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WorkerHello) Reset() {
+	*x = WorkerHello{}
+	mi := &file_imageservice_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WorkerHello) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WorkerHello) ProtoMessage() {}
+
+func (x *WorkerHello) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WorkerHello.ProtoReflect.Descriptor instead.
+func (*WorkerHello) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *WorkerHello) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *WorkerHello) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *WorkerHello) GetOperations() []string {
+	if x != nil {
+		return x.Operations
+	}
+	return nil
+}
+
+func (x *WorkerHello) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+type WorkerSession struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	WorkerId string                 `protobuf:"bytes,1,opt,name=worker_id,json=workerId,proto3" json:"worker_id,omitempty"`
+	// Proves the worker id. Both are sent with every call, as the worker-id and worker-credential metadata.
+	Credential    string   `protobuf:"bytes,2,opt,name=credential,proto3" json:"credential,omitempty"`
+	MasterVersion string   `protobuf:"bytes,3,opt,name=master_version,json=masterVersion,proto3" json:"master_version,omitempty"`
+	Operations    []string `protobuf:"bytes,4,rep,name=operations,proto3" json:"operations,omitempty"` // The operations of the worker the Master dispatches.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WorkerSession) Reset() {
+	*x = WorkerSession{}
+	mi := &file_imageservice_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WorkerSession) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WorkerSession) ProtoMessage() {}
+
+func (x *WorkerSession) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WorkerSession.ProtoReflect.Descriptor instead.
+func (*WorkerSession) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *WorkerSession) GetWorkerId() string {
+	if x != nil {
+		return x.WorkerId
+	}
+	return ""
+}
+
+func (x *WorkerSession) GetCredential() string {
+	if x != nil {
+		return x.Credential
+	}
+	return ""
+}
+
+func (x *WorkerSession) GetMasterVersion() string {
+	if x != nil {
+		return x.MasterVersion
+	}
+	return ""
+}
+
+func (x *WorkerSession) GetOperations() []string {
+	if x != nil {
+		return x.Operations
+	}
+	return nil
+}
+
+type RegisterWorkerRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Capacity      int32                  `protobuf:"varint,2,opt,name=capacity,proto3" json:"capacity,omitempty"` // How many tasks the worker processes at once.
+	Operations    []string               `protobuf:"bytes,3,rep,name=operations,proto3" json:"operations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterWorkerRequest) Reset() {
+	*x = RegisterWorkerRequest{}
+	mi := &file_imageservice_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterWorkerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterWorkerRequest) ProtoMessage() {}
+
+func (x *RegisterWorkerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_imageservice_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterWorkerRequest.ProtoReflect.Descriptor instead.
+func (*RegisterWorkerRequest) Descriptor() ([]byte, []int) {
+	return file_imageservice_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *RegisterWorkerRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *RegisterWorkerRequest) GetCapacity() int32 {
+	if x != nil {
+		return x.Capacity
+	}
+	return 0
+}
+
+func (x *RegisterWorkerRequest) GetOperations() []string {
+	if x != nil {
+		return x.Operations
+	}
+	return nil
+}
+
+var File_imageservice_proto protoreflect.FileDescriptor
+
+const file_imageservice_proto_rawDesc = "" +
+	"\n" +
+	"\x12imageservice.proto\x12\fimageservice\x1a\x1bgoogle/protobuf/empty.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xd9\x04\n" +
+	"\x04Task\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12-\n" +
+	"\x05state\x18\x02 \x01(\x0e2\x17.imageservice.TaskStateR\x05state\x12\x1a\n" +
+	"\bmetadata\x18\x03 \x01(\fR\bmetadata\x12\x1a\n" +
+	"\bprogress\x18\x04 \x01(\x05R\bprogress\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\x129\n" +
+	"\n" +
+	"created_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"started_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\x12;\n" +
+	"\vfinished_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"finishedAt\x12\x1a\n" +
+	"\bcallback\x18\t \x01(\tR\bcallback\x12\x16\n" +
+	"\x06client\x18\n" +
+	" \x01(\tR\x06client\x126\n" +
+	"\n" +
+	"deliveries\x18\v \x03(\v2\x16.imageservice.DeliveryR\n" +
+	"deliveries\x12\x1d\n" +
+	"\n" +
+	"error_code\x18\f \x01(\tR\terrorCode\x12\x1a\n" +
+	"\battempts\x18\r \x01(\x05R\battempts\x12\x16\n" +
+	"\x06worker\x18\x0e \x01(\tR\x06worker\x12\x1c\n" +
+	"\toperation\x18\x0f \x01(\tR\toperation\x12\x1e\n" +
+	"\n" +
+	"parameters\x18\x10 \x01(\fR\n" +
+	"parameters\x12\x14\n" +
+	"\x05trace\x18\x11 \x01(\tR\x05trace\"\xa1\x01\n" +
+	"\bDelivery\x12\x14\n" +
+	"\x05event\x18\x01 \x01(\tR\x05event\x12\x18\n" +
+	"\aattempt\x18\x02 \x01(\x05R\aattempt\x12.\n" +
+	"\x04time\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x1f\n" +
+	"\vstatus_code\x18\x04 \x01(\x05R\n" +
+	"statusCode\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\"0\n" +
+	"\x06TaskId\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x16\n" +
+	"\x06worker\x18\x02 \x01(\tR\x06worker\"J\n" +
+	"\x10ClaimTaskRequest\x12\x16\n" +
+	"\x06worker\x18\x01 \x01(\tR\x06worker\x12\x1e\n" +
+	"\n" +
+	"operations\x18\x02 \x03(\tR\n" +
+	"operations\"\xb2\x01\n" +
+	"\x0eNewTaskRequest\x12\x18\n" +
+	"\apending\x18\x01 \x01(\bR\apending\x12\x1a\n" +
+	"\bcallback\x18\x02 \x01(\tR\bcallback\x12\x16\n" +
+	"\x06client\x18\x03 \x01(\tR\x06client\x12\x1c\n" +
+	"\toperation\x18\x04 \x01(\tR\toperation\x12\x1e\n" +
+	"\n" +
+	"parameters\x18\x05 \x01(\fR\n" +
+	"parameters\x12\x14\n" +
+	"\x05trace\x18\x06 \x01(\tR\x05trace\"8\n" +
+	"\x10AbortTaskRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"\x85\x01\n" +
+	"\x0fFailTaskRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12\x1c\n" +
+	"\ttransient\x18\x04 \x01(\bR\ttransient\x12\x16\n" +
+	"\x06worker\x18\x05 \x01(\tR\x06worker\"X\n" +
+	"\x12SetProgressRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1a\n" +
+	"\bprogress\x18\x02 \x01(\x05R\bprogress\x12\x16\n" +
+	"\x06worker\x18\x03 \x01(\tR\x06worker\"@\n" +
+	"\x12SetMetadataRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1a\n" +
+	"\bmetadata\x18\x02 \x01(\fR\bmetadata\"X\n" +
+	"\x12AddDeliveryRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x122\n" +
+	"\bdelivery\x18\x02 \x01(\v2\x16.imageservice.DeliveryR\bdelivery\"\xbd\x01\n" +
+	"\x10ListTasksRequest\x122\n" +
+	"\x05state\x18\x01 \x01(\x0e2\x17.imageservice.TaskStateH\x00R\x05state\x88\x01\x01\x120\n" +
+	"\x05since\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x05since\x12\x19\n" +
+	"\x05after\x18\x03 \x01(\x03H\x01R\x05after\x88\x01\x01\x12\x14\n" +
+	"\x05limit\x18\x04 \x01(\x05R\x05limitB\b\n" +
+	"\x06_stateB\b\n" +
+	"\x06_after\"\xa0\x02\n" +
+	"\tTaskStats\x12;\n" +
+	"\x06counts\x18\x01 \x03(\v2#.imageservice.TaskStats.CountsEntryR\x06counts\x120\n" +
+	"\x14finished_last_minute\x18\x02 \x01(\x03R\x12finishedLastMinute\x12,\n" +
+	"\x12finished_last_hour\x18\x03 \x01(\x03R\x10finishedLastHour\x12;\n" +
+	"\x0frecent_failures\x18\x04 \x03(\v2\x12.imageservice.TaskR\x0erecentFailures\x1a9\n" +
+	"\vCountsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\x05R\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\"H\n" +
+	"\bTaskPage\x12(\n" +
+	"\x05tasks\x18\x01 \x03(\v2\x12.imageservice.TaskR\x05tasks\x12\x12\n" +
+	"\x04next\x18\x02 \x01(\x03R\x04next\"`\n" +
+	"\bImageRef\x12.\n" +
+	"\x05state\x18\x01 \x01(\x0e2\x18.imageservice.ImageStateR\x05state\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\x03R\x02id\x12\x14\n" +
+	"\x05token\x18\x03 \x01(\tR\x05token\"q\n" +
+	"\fUploadHeader\x12,\n" +
+	"\x05image\x18\x01 \x01(\v2\x16.imageservice.ImageRefR\x05image\x12\x1f\n" +
+	"\vexif_policy\x18\x02 \x01(\tR\n" +
+	"exifPolicy\x12\x12\n" +
+	"\x04user\x18\x03 \x01(\tR\x04user\"j\n" +
+	"\x12UploadImageRequest\x124\n" +
+	"\x06header\x18\x01 \x01(\v2\x1a.imageservice.UploadHeaderH\x00R\x06header\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\x06\n" +
+	"\x04part\" \n" +
+	"\n" +
+	"ImageChunk\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"#\n" +
+	"\rImageMetadata\x12\x12\n" +
+	"\x04json\x18\x01 \x01(\fR\x04json\"\"\n" +
+	"\x0ePresignedImage\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\";\n" +
+	"\x13PromoteImageRequest\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\x03R\x02id\"\x8f\x02\n" +
+	"\fStorageUsage\x12#\n" +
+	"\rstaged_images\x18\x01 \x01(\x03R\fstagedImages\x12!\n" +
+	"\fstaged_bytes\x18\x02 \x01(\x03R\vstagedBytes\x12%\n" +
+	"\x0eworking_images\x18\x03 \x01(\x03R\rworkingImages\x12#\n" +
+	"\rworking_bytes\x18\x04 \x01(\x03R\fworkingBytes\x12'\n" +
+	"\x0ffinished_images\x18\x05 \x01(\x03R\x0efinishedImages\x12%\n" +
+	"\x0efinished_bytes\x18\x06 \x01(\x03R\rfinishedBytes\x12\x1b\n" +
+	"\tmax_bytes\x18\a \x01(\x03R\bmaxBytes\"\xb5\x01\n" +
+	"\fSubmitHeader\x12\x1f\n" +
+	"\vexif_policy\x18\x01 \x01(\tR\n" +
+	"exifPolicy\x12\x12\n" +
+	"\x04user\x18\x02 \x01(\tR\x04user\x12\x1a\n" +
+	"\bcallback\x18\x03 \x01(\tR\bcallback\x12\x16\n" +
+	"\x06client\x18\x04 \x01(\tR\x06client\x12\x1c\n" +
+	"\toperation\x18\x05 \x01(\tR\toperation\x12\x1e\n" +
+	"\n" +
+	"parameters\x18\x06 \x01(\fR\n" +
+	"parameters\"j\n" +
+	"\x12SubmitImageRequest\x124\n" +
+	"\x06header\x18\x01 \x01(\v2\x1a.imageservice.SubmitHeaderH\x00R\x06header\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\x06\n" +
+	"\x04part\"q\n" +
+	"\vWorkerHello\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\tR\aversion\x12\x1e\n" +
+	"\n" +
+	"operations\x18\x03 \x03(\tR\n" +
+	"operations\x12\x14\n" +
+	"\x05token\x18\x04 \x01(\tR\x05token\"\x93\x01\n" +
+	"\rWorkerSession\x12\x1b\n" +
+	"\tworker_id\x18\x01 \x01(\tR\bworkerId\x12\x1e\n" +
+	"\n" +
+	"credential\x18\x02 \x01(\tR\n" +
+	"credential\x12%\n" +
+	"\x0emaster_version\x18\x03 \x01(\tR\rmasterVersion\x12\x1e\n" +
+	"\n" +
+	"operations\x18\x04 \x03(\tR\n" +
+	"operations\"g\n" +
+	"\x15RegisterWorkerRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1a\n" +
+	"\bcapacity\x18\x02 \x01(\x05R\bcapacity\x12\x1e\n" +
+	"\n" +
+	"operations\x18\x03 \x03(\tR\n" +
+	"operations*\x8b\x01\n" +
+	"\tTaskState\x12\x1a\n" +
+	"\x16TASK_STATE_NOT_STARTED\x10\x00\x12\x1a\n" +
+	"\x16TASK_STATE_IN_PROGRESS\x10\x01\x12\x17\n" +
+	"\x13TASK_STATE_FINISHED\x10\x02\x12\x16\n" +
+	"\x12TASK_STATE_PENDING\x10\x03\x12\x15\n" +
+	"\x11TASK_STATE_FAILED\x10\x04*u\n" +
+	"\n" +
+	"ImageState\x12\x1b\n" +
+	"\x17IMAGE_STATE_UNSPECIFIED\x10\x00\x12\x17\n" +
+	"\x13IMAGE_STATE_STAGING\x10\x01\x12\x17\n" +
+	"\x13IMAGE_STATE_WORKING\x10\x02\x12\x18\n" +
+	"\x14IMAGE_STATE_FINISHED\x10\x032\xf1\a\n" +
+	"\tTaskStore\x12;\n" +
+	"\aNewTask\x12\x1c.imageservice.NewTaskRequest\x1a\x12.imageservice.Task\x123\n" +
+	"\aGetTask\x12\x14.imageservice.TaskId\x1a\x12.imageservice.Task\x12?\n" +
+	"\tClaimTask\x12\x1e.imageservice.ClaimTaskRequest\x1a\x12.imageservice.Task\x126\n" +
+	"\n" +
+	"FinishTask\x12\x14.imageservice.TaskId\x1a\x12.imageservice.Task\x12=\n" +
+	"\bFailTask\x12\x1d.imageservice.FailTaskRequest\x1a\x12.imageservice.Task\x128\n" +
+	"\fActivateTask\x12\x14.imageservice.TaskId\x1a\x12.imageservice.Task\x12?\n" +
+	"\tAbortTask\x12\x1e.imageservice.AbortTaskRequest\x1a\x12.imageservice.Task\x12C\n" +
+	"\vSetProgress\x12 .imageservice.SetProgressRequest\x1a\x12.imageservice.Task\x12C\n" +
+	"\vSetMetadata\x12 .imageservice.SetMetadataRequest\x1a\x12.imageservice.Task\x12C\n" +
+	"\vAddDelivery\x12 .imageservice.AddDeliveryRequest\x1a\x12.imageservice.Task\x12C\n" +
+	"\tListTasks\x12\x1e.imageservice.ListTasksRequest\x1a\x16.imageservice.TaskPage\x12;\n" +
+	"\bGetStats\x12\x16.google.protobuf.Empty\x1a\x17.imageservice.TaskStats\x127\n" +
+	"\vRequeueTask\x12\x14.imageservice.TaskId\x1a\x12.imageservice.Task\x127\n" +
+	"\vReleaseTask\x12\x14.imageservice.TaskId\x1a\x12.imageservice.Task\x12@\n" +
+	"\n" +
+	"CancelTask\x12\x1e.imageservice.AbortTaskRequest\x1a\x12.imageservice.Task\x12:\n" +
+	"\n" +
+	"DeleteTask\x12\x14.imageservice.TaskId\x1a\x16.google.protobuf.Empty2\xf0\x03\n" +
+	"\n" +
+	"ImageStore\x12I\n" +
+	"\vUploadImage\x12 .imageservice.UploadImageRequest\x1a\x16.google.protobuf.Empty(\x01\x12C\n" +
+	"\rDownloadImage\x12\x16.imageservice.ImageRef\x1a\x18.imageservice.ImageChunk0\x01\x12B\n" +
+	"\vGetMetadata\x12\x16.imageservice.ImageRef\x1a\x1b.imageservice.ImageMetadata\x12D\n" +
+	"\fPresignImage\x12\x16.imageservice.ImageRef\x1a\x1c.imageservice.PresignedImage\x12I\n" +
+	"\fPromoteImage\x12!.imageservice.PromoteImageRequest\x1a\x16.google.protobuf.Empty\x12=\n" +
+	"\vDeleteImage\x12\x16.imageservice.ImageRef\x1a\x16.google.protobuf.Empty\x12>\n" +
+	"\bGetUsage\x12\x16.google.protobuf.Empty\x1a\x1a.imageservice.StorageUsage2\x9b\x05\n" +
+	"\x06Master\x12E\n" +
+	"\vSubmitImage\x12 .imageservice.SubmitImageRequest\x1a\x12.imageservice.Task(\x01\x123\n" +
+	"\aGetTask\x12\x14.imageservice.TaskId\x1a\x12.imageservice.Task\x12<\n" +
+	"\bGetImage\x12\x14.imageservice.TaskId\x1a\x18.imageservice.ImageChunk0\x01\x12C\n" +
+	"\tHandshake\x12\x19.imageservice.WorkerHello\x1a\x1b.imageservice.WorkerSession\x12?\n" +
+	"\tClaimTask\x12\x1e.imageservice.ClaimTaskRequest\x1a\x12.imageservice.Task\x12J\n" +
+	"\x0eReportProgress\x12 .imageservice.SetProgressRequest\x1a\x16.google.protobuf.Empty\x12:\n" +
+	"\n" +
+	"FinishTask\x12\x14.imageservice.TaskId\x1a\x16.google.protobuf.Empty\x12A\n" +
+	"\bFailTask\x12\x1d.imageservice.FailTaskRequest\x1a\x16.google.protobuf.Empty\x12;\n" +
+	"\vReleaseTask\x12\x14.imageservice.TaskId\x1a\x16.google.protobuf.Empty\x12I\n" +
+	"\fReceiveTasks\x12#.imageservice.RegisterWorkerRequest\x1a\x12.imageservice.Task0\x01B\fZ\n" +
+	"../rpc;rpcb\x06proto3"
+
+var (
+	file_imageservice_proto_rawDescOnce sync.Once
+	file_imageservice_proto_rawDescData []byte
+)
+
+func file_imageservice_proto_rawDescGZIP() []byte {
+	file_imageservice_proto_rawDescOnce.Do(func() {
+		file_imageservice_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_imageservice_proto_rawDesc), len(file_imageservice_proto_rawDesc)))
+	})
+	return file_imageservice_proto_rawDescData
+}
+
+var file_imageservice_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_imageservice_proto_msgTypes = make([]protoimpl.MessageInfo, 27)
+var file_imageservice_proto_goTypes = []any{
+	(TaskState)(0),                // 0: imageservice.TaskState
+	(ImageState)(0),               // 1: imageservice.ImageState
+	(*Task)(nil),                  // 2: imageservice.Task
+	(*Delivery)(nil),              // 3: imageservice.Delivery
+	(*TaskId)(nil),                // 4: imageservice.TaskId
+	(*ClaimTaskRequest)(nil),      // 5: imageservice.ClaimTaskRequest
+	(*NewTaskRequest)(nil),        // 6: imageservice.NewTaskRequest
+	(*AbortTaskRequest)(nil),      // 7: imageservice.AbortTaskRequest
+	(*FailTaskRequest)(nil),       // 8: imageservice.FailTaskRequest
+	(*SetProgressRequest)(nil),    // 9: imageservice.SetProgressRequest
+	(*SetMetadataRequest)(nil),    // 10: imageservice.SetMetadataRequest
+	(*AddDeliveryRequest)(nil),    // 11: imageservice.AddDeliveryRequest
+	(*ListTasksRequest)(nil),      // 12: imageservice.ListTasksRequest
+	(*TaskStats)(nil),             // 13: imageservice.TaskStats
+	(*TaskPage)(nil),              // 14: imageservice.TaskPage
+	(*ImageRef)(nil),              // 15: imageservice.ImageRef
+	(*UploadHeader)(nil),          // 16: imageservice.UploadHeader
+	(*UploadImageRequest)(nil),    // 17: imageservice.UploadImageRequest
+	(*ImageChunk)(nil),            // 18: imageservice.ImageChunk
+	(*ImageMetadata)(nil),         // 19: imageservice.ImageMetadata
+	(*PresignedImage)(nil),        // 20: imageservice.PresignedImage
+	(*PromoteImageRequest)(nil),   // 21: imageservice.PromoteImageRequest
+	(*StorageUsage)(nil),          // 22: imageservice.StorageUsage
+	(*SubmitHeader)(nil),          // 23: imageservice.SubmitHeader
+	(*SubmitImageRequest)(nil),    // 24: imageservice.SubmitImageRequest
+	(*WorkerHello)(nil),           // 25: imageservice.WorkerHello
+	(*WorkerSession)(nil),         // 26: imageservice.WorkerSession
+	(*RegisterWorkerRequest)(nil), // 27: imageservice.RegisterWorkerRequest
+	nil,                           // 28: imageservice.TaskStats.CountsEntry
+	(*timestamppb.Timestamp)(nil), // 29: google.protobuf.Timestamp
+	(*emptypb.Empty)(nil),         // 30: google.protobuf.Empty
+}
+var file_imageservice_proto_depIdxs = []int32{
+	0,  // 0: imageservice.Task.state:type_name -> imageservice.TaskState
+	29, // 1: imageservice.Task.created_at:type_name -> google.protobuf.Timestamp
+	29, // 2: imageservice.Task.started_at:type_name -> google.protobuf.Timestamp
+	29, // 3: imageservice.Task.finished_at:type_name -> google.protobuf.Timestamp
+	3,  // 4: imageservice.Task.deliveries:type_name -> imageservice.Delivery
+	29, // 5: imageservice.Delivery.time:type_name -> google.protobuf.Timestamp
+	3,  // 6: imageservice.AddDeliveryRequest.delivery:type_name -> imageservice.Delivery
+	0,  // 7: imageservice.ListTasksRequest.state:type_name -> imageservice.TaskState
+	29, // 8: imageservice.ListTasksRequest.since:type_name -> google.protobuf.Timestamp
+	28, // 9: imageservice.TaskStats.counts:type_name -> imageservice.TaskStats.CountsEntry
+	2,  // 10: imageservice.TaskStats.recent_failures:type_name -> imageservice.Task
+	2,  // 11: imageservice.TaskPage.tasks:type_name -> imageservice.Task
+	1,  // 12: imageservice.ImageRef.state:type_name -> imageservice.ImageState
+	15, // 13: imageservice.UploadHeader.image:type_name -> imageservice.ImageRef
+	16, // 14: imageservice.UploadImageRequest.header:type_name -> imageservice.UploadHeader
+	23, // 15: imageservice.SubmitImageRequest.header:type_name -> imageservice.SubmitHeader
+	6,  // 16: imageservice.TaskStore.NewTask:input_type -> imageservice.NewTaskRequest
+	4,  // 17: imageservice.TaskStore.GetTask:input_type -> imageservice.TaskId
+	5,  // 18: imageservice.TaskStore.ClaimTask:input_type -> imageservice.ClaimTaskRequest
+	4,  // 19: imageservice.TaskStore.FinishTask:input_type -> imageservice.TaskId
+	8,  // 20: imageservice.TaskStore.FailTask:input_type -> imageservice.FailTaskRequest
+	4,  // 21: imageservice.TaskStore.ActivateTask:input_type -> imageservice.TaskId
+	7,  // 22: imageservice.TaskStore.AbortTask:input_type -> imageservice.AbortTaskRequest
+	9,  // 23: imageservice.TaskStore.SetProgress:input_type -> imageservice.SetProgressRequest
+	10, // 24: imageservice.TaskStore.SetMetadata:input_type -> imageservice.SetMetadataRequest
+	11, // 25: imageservice.TaskStore.AddDelivery:input_type -> imageservice.AddDeliveryRequest
+	12, // 26: imageservice.TaskStore.ListTasks:input_type -> imageservice.ListTasksRequest
+	30, // 27: imageservice.TaskStore.GetStats:input_type -> google.protobuf.Empty
+	4,  // 28: imageservice.TaskStore.RequeueTask:input_type -> imageservice.TaskId
+	4,  // 29: imageservice.TaskStore.ReleaseTask:input_type -> imageservice.TaskId
+	7,  // 30: imageservice.TaskStore.CancelTask:input_type -> imageservice.AbortTaskRequest
+	4,  // 31: imageservice.TaskStore.DeleteTask:input_type -> imageservice.TaskId
+	17, // 32: imageservice.ImageStore.UploadImage:input_type -> imageservice.UploadImageRequest
+	15, // 33: imageservice.ImageStore.DownloadImage:input_type -> imageservice.ImageRef
+	15, // 34: imageservice.ImageStore.GetMetadata:input_type -> imageservice.ImageRef
+	15, // 35: imageservice.ImageStore.PresignImage:input_type -> imageservice.ImageRef
+	21, // 36: imageservice.ImageStore.PromoteImage:input_type -> imageservice.PromoteImageRequest
+	15, // 37: imageservice.ImageStore.DeleteImage:input_type -> imageservice.ImageRef
+	30, // 38: imageservice.ImageStore.GetUsage:input_type -> google.protobuf.Empty
+	24, // 39: imageservice.Master.SubmitImage:input_type -> imageservice.SubmitImageRequest
+	4,  // 40: imageservice.Master.GetTask:input_type -> imageservice.TaskId
+	4,  // 41: imageservice.Master.GetImage:input_type -> imageservice.TaskId
+	25, // 42: imageservice.Master.Handshake:input_type -> imageservice.WorkerHello
+	5,  // 43: imageservice.Master.ClaimTask:input_type -> imageservice.ClaimTaskRequest
+	9,  // 44: imageservice.Master.ReportProgress:input_type -> imageservice.SetProgressRequest
+	4,  // 45: imageservice.Master.FinishTask:input_type -> imageservice.TaskId
+	8,  // 46: imageservice.Master.FailTask:input_type -> imageservice.FailTaskRequest
+	4,  // 47: imageservice.Master.ReleaseTask:input_type -> imageservice.TaskId
+	27, // 48: imageservice.Master.ReceiveTasks:input_type -> imageservice.RegisterWorkerRequest
+	2,  // 49: imageservice.TaskStore.NewTask:output_type -> imageservice.Task
+	2,  // 50: imageservice.TaskStore.GetTask:output_type -> imageservice.Task
+	2,  // 51: imageservice.TaskStore.ClaimTask:output_type -> imageservice.Task
+	2,  // 52: imageservice.TaskStore.FinishTask:output_type -> imageservice.Task
+	2,  // 53: imageservice.TaskStore.FailTask:output_type -> imageservice.Task
+	2,  // 54: imageservice.TaskStore.ActivateTask:output_type -> imageservice.Task
+	2,  // 55: imageservice.TaskStore.AbortTask:output_type -> imageservice.Task
+	2,  // 56: imageservice.TaskStore.SetProgress:output_type -> imageservice.Task
+	2,  // 57: imageservice.TaskStore.SetMetadata:output_type -> imageservice.Task
+	2,  // 58: imageservice.TaskStore.AddDelivery:output_type -> imageservice.Task
+	14, // 59: imageservice.TaskStore.ListTasks:output_type -> imageservice.TaskPage
+	13, // 60: imageservice.TaskStore.GetStats:output_type -> imageservice.TaskStats
+	2,  // 61: imageservice.TaskStore.RequeueTask:output_type -> imageservice.Task
+	2,  // 62: imageservice.TaskStore.ReleaseTask:output_type -> imageservice.Task
+	2,  // 63: imageservice.TaskStore.CancelTask:output_type -> imageservice.Task
+	30, // 64: imageservice.TaskStore.DeleteTask:output_type -> google.protobuf.Empty
+	30, // 65: imageservice.ImageStore.UploadImage:output_type -> google.protobuf.Empty
+	18, // 66: imageservice.ImageStore.DownloadImage:output_type -> imageservice.ImageChunk
+	19, // 67: imageservice.ImageStore.GetMetadata:output_type -> imageservice.ImageMetadata
+	20, // 68: imageservice.ImageStore.PresignImage:output_type -> imageservice.PresignedImage
+	30, // 69: imageservice.ImageStore.PromoteImage:output_type -> google.protobuf.Empty
+	30, // 70: imageservice.ImageStore.DeleteImage:output_type -> google.protobuf.Empty
+	22, // 71: imageservice.ImageStore.GetUsage:output_type -> imageservice.StorageUsage
+	2,  // 72: imageservice.Master.SubmitImage:output_type -> imageservice.Task
+	2,  // 73: imageservice.Master.GetTask:output_type -> imageservice.Task
+	18, // 74: imageservice.Master.GetImage:output_type -> imageservice.ImageChunk
+	26, // 75: imageservice.Master.Handshake:output_type -> imageservice.WorkerSession
+	2,  // 76: imageservice.Master.ClaimTask:output_type -> imageservice.Task
+	30, // 77: imageservice.Master.ReportProgress:output_type -> google.protobuf.Empty
+	30, // 78: imageservice.Master.FinishTask:output_type -> google.protobuf.Empty
+	30, // 79: imageservice.Master.FailTask:output_type -> google.protobuf.Empty
+	30, // 80: imageservice.Master.ReleaseTask:output_type -> google.protobuf.Empty
+	2,  // 81: imageservice.Master.ReceiveTasks:output_type -> imageservice.Task
+	49, // [49:82] is the sub-list for method output_type
+	16, // [16:49] is the sub-list for method input_type
+	16, // [16:16] is the sub-list for extension type_name
+	16, // [16:16] is the sub-list for extension extendee
+	0,  // [0:16] is the sub-list for field type_name
+}
+
+func init() { file_imageservice_proto_init() }
+func file_imageservice_proto_init() {
+	if File_imageservice_proto != nil {
+		return
+	}
+	file_imageservice_proto_msgTypes[10].OneofWrappers = []any{}
+	file_imageservice_proto_msgTypes[15].OneofWrappers = []any{
+		(*UploadImageRequest_Header)(nil),
+		(*UploadImageRequest_Chunk)(nil),
+	}
+	file_imageservice_proto_msgTypes[22].OneofWrappers = []any{
+		(*SubmitImageRequest_Header)(nil),
+		(*SubmitImageRequest_Chunk)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_imageservice_proto_rawDesc), len(file_imageservice_proto_rawDesc)),
+			NumEnums:      2,
+			NumMessages:   27,
+			NumExtensions: 0,
+			NumServices:   3,
+		},
+		GoTypes:           file_imageservice_proto_goTypes,
+		DependencyIndexes: file_imageservice_proto_depIdxs,
+		EnumInfos:         file_imageservice_proto_enumTypes,
+		MessageInfos:      file_imageservice_proto_msgTypes,
+	}.Build()
+	File_imageservice_proto = out.File
+	file_imageservice_proto_goTypes = nil
+	file_imageservice_proto_depIdxs = nil
+}
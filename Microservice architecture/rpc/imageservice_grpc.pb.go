@@ -0,0 +1,1513 @@
+// The interface between the services. The HTTP endpoints stay for the frontend and the clients outside.
+//
+// After changing this file, regenerate the Go code in this directory:
+//
+//	protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative imageservice.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: imageservice.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	TaskStore_NewTask_FullMethodName      = "/imageservice.TaskStore/NewTask"
+	TaskStore_GetTask_FullMethodName      = "/imageservice.TaskStore/GetTask"
+	TaskStore_ClaimTask_FullMethodName    = "/imageservice.TaskStore/ClaimTask"
+	TaskStore_FinishTask_FullMethodName   = "/imageservice.TaskStore/FinishTask"
+	TaskStore_FailTask_FullMethodName     = "/imageservice.TaskStore/FailTask"
+	TaskStore_ActivateTask_FullMethodName = "/imageservice.TaskStore/ActivateTask"
+	TaskStore_AbortTask_FullMethodName    = "/imageservice.TaskStore/AbortTask"
+	TaskStore_SetProgress_FullMethodName  = "/imageservice.TaskStore/SetProgress"
+	TaskStore_SetMetadata_FullMethodName  = "/imageservice.TaskStore/SetMetadata"
+	TaskStore_AddDelivery_FullMethodName  = "/imageservice.TaskStore/AddDelivery"
+	TaskStore_ListTasks_FullMethodName    = "/imageservice.TaskStore/ListTasks"
+	TaskStore_GetStats_FullMethodName     = "/imageservice.TaskStore/GetStats"
+	TaskStore_RequeueTask_FullMethodName  = "/imageservice.TaskStore/RequeueTask"
+	TaskStore_ReleaseTask_FullMethodName  = "/imageservice.TaskStore/ReleaseTask"
+	TaskStore_CancelTask_FullMethodName   = "/imageservice.TaskStore/CancelTask"
+	TaskStore_DeleteTask_FullMethodName   = "/imageservice.TaskStore/DeleteTask"
+)
+
+// TaskStoreClient is the client API for TaskStore service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TaskStoreClient interface {
+	NewTask(ctx context.Context, in *NewTaskRequest, opts ...grpc.CallOption) (*Task, error)
+	GetTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*Task, error)
+	// ClaimTask starts the oldest not started task for the worker. Fails with NOT_FOUND if there is none.
+	// Changes of a worker to an in progress task fail with PERMISSION_DENIED, unless it holds the claim.
+	ClaimTask(ctx context.Context, in *ClaimTaskRequest, opts ...grpc.CallOption) (*Task, error)
+	FinishTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*Task, error)
+	// FailTask records why a worker couldn't process an in progress task. After a transient failure the task is queued
+	// again, unless it was attempted too often already, otherwise it fails.
+	FailTask(ctx context.Context, in *FailTaskRequest, opts ...grpc.CallOption) (*Task, error)
+	// ActivateTask hands a pending task over to the workers, once its image is in the images-store.
+	ActivateTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*Task, error)
+	// AbortTask marks a pending task as failed.
+	AbortTask(ctx context.Context, in *AbortTaskRequest, opts ...grpc.CallOption) (*Task, error)
+	SetProgress(ctx context.Context, in *SetProgressRequest, opts ...grpc.CallOption) (*Task, error)
+	SetMetadata(ctx context.Context, in *SetMetadataRequest, opts ...grpc.CallOption) (*Task, error)
+	AddDelivery(ctx context.Context, in *AddDeliveryRequest, opts ...grpc.CallOption) (*Task, error)
+	ListTasks(ctx context.Context, in *ListTasksRequest, opts ...grpc.CallOption) (*TaskPage, error)
+	// GetStats counts the tasks by state and returns the latest failures.
+	GetStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*TaskStats, error)
+	// RequeueTask hands an in progress or failed task out to the workers again.
+	RequeueTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*Task, error)
+	// ReleaseTask hands an in progress task back to the workers, when its worker won't finish it.
+	ReleaseTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*Task, error)
+	// CancelTask marks a task which isn't finished as failed.
+	CancelTask(ctx context.Context, in *AbortTaskRequest, opts ...grpc.CallOption) (*Task, error)
+	// DeleteTask removes a finished or failed task.
+	DeleteTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*emptypb.Empty, error)
+}
+
+type taskStoreClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTaskStoreClient(cc grpc.ClientConnInterface) TaskStoreClient {
+	return &taskStoreClient{cc}
+}
+
+func (c *taskStoreClient) NewTask(ctx context.Context, in *NewTaskRequest, opts ...grpc.CallOption) (*Task, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TaskStore_NewTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskStoreClient) GetTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*Task, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TaskStore_GetTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskStoreClient) ClaimTask(ctx context.Context, in *ClaimTaskRequest, opts ...grpc.CallOption) (*Task, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TaskStore_ClaimTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskStoreClient) FinishTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*Task, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TaskStore_FinishTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskStoreClient) FailTask(ctx context.Context, in *FailTaskRequest, opts ...grpc.CallOption) (*Task, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TaskStore_FailTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskStoreClient) ActivateTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*Task, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TaskStore_ActivateTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskStoreClient) AbortTask(ctx context.Context, in *AbortTaskRequest, opts ...grpc.CallOption) (*Task, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TaskStore_AbortTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskStoreClient) SetProgress(ctx context.Context, in *SetProgressRequest, opts ...grpc.CallOption) (*Task, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TaskStore_SetProgress_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskStoreClient) SetMetadata(ctx context.Context, in *SetMetadataRequest, opts ...grpc.CallOption) (*Task, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TaskStore_SetMetadata_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskStoreClient) AddDelivery(ctx context.Context, in *AddDeliveryRequest, opts ...grpc.CallOption) (*Task, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TaskStore_AddDelivery_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskStoreClient) ListTasks(ctx context.Context, in *ListTasksRequest, opts ...grpc.CallOption) (*TaskPage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TaskPage)
+	err := c.cc.Invoke(ctx, TaskStore_ListTasks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskStoreClient) GetStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*TaskStats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TaskStats)
+	err := c.cc.Invoke(ctx, TaskStore_GetStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskStoreClient) RequeueTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*Task, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TaskStore_RequeueTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskStoreClient) ReleaseTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*Task, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TaskStore_ReleaseTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskStoreClient) CancelTask(ctx context.Context, in *AbortTaskRequest, opts ...grpc.CallOption) (*Task, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Task)
+	err := c.cc.Invoke(ctx, TaskStore_CancelTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *taskStoreClient) DeleteTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, TaskStore_DeleteTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TaskStoreServer is the server API for TaskStore service.
+// All implementations must embed UnimplementedTaskStoreServer
+// for forward compatibility.
+type TaskStoreServer interface {
+	NewTask(context.Context, *NewTaskRequest) (*Task, error)
+	GetTask(context.Context, *TaskId) (*Task, error)
+	// ClaimTask starts the oldest not started task for the worker. Fails with NOT_FOUND if there is none.
+	// Changes of a worker to an in progress task fail with PERMISSION_DENIED, unless it holds the claim.
+	ClaimTask(context.Context, *ClaimTaskRequest) (*Task, error)
+	FinishTask(context.Context, *TaskId) (*Task, error)
+	// FailTask records why a worker couldn't process an in progress task. After a transient failure the task is queued
+	// again, unless it was attempted too often already, otherwise it fails.
+	FailTask(context.Context, *FailTaskRequest) (*Task, error)
+	// ActivateTask hands a pending task over to the workers, once its image is in the images-store.
+	ActivateTask(context.Context, *TaskId) (*Task, error)
+	// AbortTask marks a pending task as failed.
+	AbortTask(context.Context, *AbortTaskRequest) (*Task, error)
+	SetProgress(context.Context, *SetProgressRequest) (*Task, error)
+	SetMetadata(context.Context, *SetMetadataRequest) (*Task, error)
+	AddDelivery(context.Context, *AddDeliveryRequest) (*Task, error)
+	ListTasks(context.Context, *ListTasksRequest) (*TaskPage, error)
+	// GetStats counts the tasks by state and returns the latest failures.
+	GetStats(context.Context, *emptypb.Empty) (*TaskStats, error)
+	// RequeueTask hands an in progress or failed task out to the workers again.
+	RequeueTask(context.Context, *TaskId) (*Task, error)
+	// ReleaseTask hands an in progress task back to the workers, when its worker won't finish it.
+	ReleaseTask(context.Context, *TaskId) (*Task, error)
+	// CancelTask marks a task which isn't finished as failed.
+	CancelTask(context.Context, *AbortTaskRequest) (*Task, error)
+	// DeleteTask removes a finished or failed task.
+	DeleteTask(context.Context, *TaskId) (*emptypb.Empty, error)
+	mustEmbedUnimplementedTaskStoreServer()
+}
+
+// UnimplementedTaskStoreServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTaskStoreServer struct{}
+
+func (UnimplementedTaskStoreServer) NewTask(context.Context, *NewTaskRequest) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method NewTask not implemented")
+}
+func (UnimplementedTaskStoreServer) GetTask(context.Context, *TaskId) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTask not implemented")
+}
+func (UnimplementedTaskStoreServer) ClaimTask(context.Context, *ClaimTaskRequest) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClaimTask not implemented")
+}
+func (UnimplementedTaskStoreServer) FinishTask(context.Context, *TaskId) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FinishTask not implemented")
+}
+func (UnimplementedTaskStoreServer) FailTask(context.Context, *FailTaskRequest) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FailTask not implemented")
+}
+func (UnimplementedTaskStoreServer) ActivateTask(context.Context, *TaskId) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ActivateTask not implemented")
+}
+func (UnimplementedTaskStoreServer) AbortTask(context.Context, *AbortTaskRequest) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AbortTask not implemented")
+}
+func (UnimplementedTaskStoreServer) SetProgress(context.Context, *SetProgressRequest) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetProgress not implemented")
+}
+func (UnimplementedTaskStoreServer) SetMetadata(context.Context, *SetMetadataRequest) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetMetadata not implemented")
+}
+func (UnimplementedTaskStoreServer) AddDelivery(context.Context, *AddDeliveryRequest) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddDelivery not implemented")
+}
+func (UnimplementedTaskStoreServer) ListTasks(context.Context, *ListTasksRequest) (*TaskPage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTasks not implemented")
+}
+func (UnimplementedTaskStoreServer) GetStats(context.Context, *emptypb.Empty) (*TaskStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedTaskStoreServer) RequeueTask(context.Context, *TaskId) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RequeueTask not implemented")
+}
+func (UnimplementedTaskStoreServer) ReleaseTask(context.Context, *TaskId) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReleaseTask not implemented")
+}
+func (UnimplementedTaskStoreServer) CancelTask(context.Context, *AbortTaskRequest) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelTask not implemented")
+}
+func (UnimplementedTaskStoreServer) DeleteTask(context.Context, *TaskId) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteTask not implemented")
+}
+func (UnimplementedTaskStoreServer) mustEmbedUnimplementedTaskStoreServer() {}
+func (UnimplementedTaskStoreServer) testEmbeddedByValue()                   {}
+
+// UnsafeTaskStoreServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TaskStoreServer will
+// result in compilation errors.
+type UnsafeTaskStoreServer interface {
+	mustEmbedUnimplementedTaskStoreServer()
+}
+
+func RegisterTaskStoreServer(s grpc.ServiceRegistrar, srv TaskStoreServer) {
+	// If the following call pancis, it indicates UnimplementedTaskStoreServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&TaskStore_ServiceDesc, srv)
+}
+
+func _TaskStore_NewTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NewTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).NewTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_NewTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).NewTask(ctx, req.(*NewTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskStore_GetTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).GetTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_GetTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).GetTask(ctx, req.(*TaskId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskStore_ClaimTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClaimTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).ClaimTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_ClaimTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).ClaimTask(ctx, req.(*ClaimTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskStore_FinishTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).FinishTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_FinishTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).FinishTask(ctx, req.(*TaskId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskStore_FailTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FailTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).FailTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_FailTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).FailTask(ctx, req.(*FailTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskStore_ActivateTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).ActivateTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_ActivateTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).ActivateTask(ctx, req.(*TaskId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskStore_AbortTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AbortTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).AbortTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_AbortTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).AbortTask(ctx, req.(*AbortTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskStore_SetProgress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetProgressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).SetProgress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_SetProgress_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).SetProgress(ctx, req.(*SetProgressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskStore_SetMetadata_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetMetadataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).SetMetadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_SetMetadata_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).SetMetadata(ctx, req.(*SetMetadataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskStore_AddDelivery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddDeliveryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).AddDelivery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_AddDelivery_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).AddDelivery(ctx, req.(*AddDeliveryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskStore_ListTasks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTasksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).ListTasks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_ListTasks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).ListTasks(ctx, req.(*ListTasksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskStore_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_GetStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).GetStats(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskStore_RequeueTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).RequeueTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_RequeueTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).RequeueTask(ctx, req.(*TaskId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskStore_ReleaseTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).ReleaseTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_ReleaseTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).ReleaseTask(ctx, req.(*TaskId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskStore_CancelTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AbortTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).CancelTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_CancelTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).CancelTask(ctx, req.(*AbortTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TaskStore_DeleteTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TaskStoreServer).DeleteTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TaskStore_DeleteTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TaskStoreServer).DeleteTask(ctx, req.(*TaskId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// TaskStore_ServiceDesc is the grpc.ServiceDesc for TaskStore service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TaskStore_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "imageservice.TaskStore",
+	HandlerType: (*TaskStoreServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "NewTask",
+			Handler:    _TaskStore_NewTask_Handler,
+		},
+		{
+			MethodName: "GetTask",
+			Handler:    _TaskStore_GetTask_Handler,
+		},
+		{
+			MethodName: "ClaimTask",
+			Handler:    _TaskStore_ClaimTask_Handler,
+		},
+		{
+			MethodName: "FinishTask",
+			Handler:    _TaskStore_FinishTask_Handler,
+		},
+		{
+			MethodName: "FailTask",
+			Handler:    _TaskStore_FailTask_Handler,
+		},
+		{
+			MethodName: "ActivateTask",
+			Handler:    _TaskStore_ActivateTask_Handler,
+		},
+		{
+			MethodName: "AbortTask",
+			Handler:    _TaskStore_AbortTask_Handler,
+		},
+		{
+			MethodName: "SetProgress",
+			Handler:    _TaskStore_SetProgress_Handler,
+		},
+		{
+			MethodName: "SetMetadata",
+			Handler:    _TaskStore_SetMetadata_Handler,
+		},
+		{
+			MethodName: "AddDelivery",
+			Handler:    _TaskStore_AddDelivery_Handler,
+		},
+		{
+			MethodName: "ListTasks",
+			Handler:    _TaskStore_ListTasks_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _TaskStore_GetStats_Handler,
+		},
+		{
+			MethodName: "RequeueTask",
+			Handler:    _TaskStore_RequeueTask_Handler,
+		},
+		{
+			MethodName: "ReleaseTask",
+			Handler:    _TaskStore_ReleaseTask_Handler,
+		},
+		{
+			MethodName: "CancelTask",
+			Handler:    _TaskStore_CancelTask_Handler,
+		},
+		{
+			MethodName: "DeleteTask",
+			Handler:    _TaskStore_DeleteTask_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "imageservice.proto",
+}
+
+const (
+	ImageStore_UploadImage_FullMethodName   = "/imageservice.ImageStore/UploadImage"
+	ImageStore_DownloadImage_FullMethodName = "/imageservice.ImageStore/DownloadImage"
+	ImageStore_GetMetadata_FullMethodName   = "/imageservice.ImageStore/GetMetadata"
+	ImageStore_PresignImage_FullMethodName  = "/imageservice.ImageStore/PresignImage"
+	ImageStore_PromoteImage_FullMethodName  = "/imageservice.ImageStore/PromoteImage"
+	ImageStore_DeleteImage_FullMethodName   = "/imageservice.ImageStore/DeleteImage"
+	ImageStore_GetUsage_FullMethodName      = "/imageservice.ImageStore/GetUsage"
+)
+
+// ImageStoreClient is the client API for ImageStore service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Any of the images-store replicas may be used, they replicate between themselves.
+type ImageStoreClient interface {
+	UploadImage(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadImageRequest, emptypb.Empty], error)
+	DownloadImage(ctx context.Context, in *ImageRef, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ImageChunk], error)
+	GetMetadata(ctx context.Context, in *ImageRef, opts ...grpc.CallOption) (*ImageMetadata, error)
+	// PresignImage returns a URL to download the image straight from the storage backend, if it supports that.
+	PresignImage(ctx context.Context, in *ImageRef, opts ...grpc.CallOption) (*PresignedImage, error)
+	// PromoteImage turns a staged upload into the working image of a task.
+	PromoteImage(ctx context.Context, in *PromoteImageRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	DeleteImage(ctx context.Context, in *ImageRef, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// GetUsage tells how much this replica stores. Unlike the other calls it's meant for a single replica.
+	GetUsage(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*StorageUsage, error)
+}
+
+type imageStoreClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewImageStoreClient(cc grpc.ClientConnInterface) ImageStoreClient {
+	return &imageStoreClient{cc}
+}
+
+func (c *imageStoreClient) UploadImage(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadImageRequest, emptypb.Empty], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ImageStore_ServiceDesc.Streams[0], ImageStore_UploadImage_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UploadImageRequest, emptypb.Empty]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageStore_UploadImageClient = grpc.ClientStreamingClient[UploadImageRequest, emptypb.Empty]
+
+func (c *imageStoreClient) DownloadImage(ctx context.Context, in *ImageRef, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ImageChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ImageStore_ServiceDesc.Streams[1], ImageStore_DownloadImage_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ImageRef, ImageChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageStore_DownloadImageClient = grpc.ServerStreamingClient[ImageChunk]
+
+func (c *imageStoreClient) GetMetadata(ctx context.Context, in *ImageRef, opts ...grpc.CallOption) (*ImageMetadata, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ImageMetadata)
+	err := c.cc.Invoke(ctx, ImageStore_GetMetadata_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageStoreClient) PresignImage(ctx context.Context, in *ImageRef, opts ...grpc.CallOption) (*PresignedImage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PresignedImage)
+	err := c.cc.Invoke(ctx, ImageStore_PresignImage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageStoreClient) PromoteImage(ctx context.Context, in *PromoteImageRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, ImageStore_PromoteImage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageStoreClient) DeleteImage(ctx context.Context, in *ImageRef, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, ImageStore_DeleteImage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageStoreClient) GetUsage(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*StorageUsage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StorageUsage)
+	err := c.cc.Invoke(ctx, ImageStore_GetUsage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ImageStoreServer is the server API for ImageStore service.
+// All implementations must embed UnimplementedImageStoreServer
+// for forward compatibility.
+//
+// Any of the images-store replicas may be used, they replicate between themselves.
+type ImageStoreServer interface {
+	UploadImage(grpc.ClientStreamingServer[UploadImageRequest, emptypb.Empty]) error
+	DownloadImage(*ImageRef, grpc.ServerStreamingServer[ImageChunk]) error
+	GetMetadata(context.Context, *ImageRef) (*ImageMetadata, error)
+	// PresignImage returns a URL to download the image straight from the storage backend, if it supports that.
+	PresignImage(context.Context, *ImageRef) (*PresignedImage, error)
+	// PromoteImage turns a staged upload into the working image of a task.
+	PromoteImage(context.Context, *PromoteImageRequest) (*emptypb.Empty, error)
+	DeleteImage(context.Context, *ImageRef) (*emptypb.Empty, error)
+	// GetUsage tells how much this replica stores. Unlike the other calls it's meant for a single replica.
+	GetUsage(context.Context, *emptypb.Empty) (*StorageUsage, error)
+	mustEmbedUnimplementedImageStoreServer()
+}
+
+// UnimplementedImageStoreServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedImageStoreServer struct{}
+
+func (UnimplementedImageStoreServer) UploadImage(grpc.ClientStreamingServer[UploadImageRequest, emptypb.Empty]) error {
+	return status.Errorf(codes.Unimplemented, "method UploadImage not implemented")
+}
+func (UnimplementedImageStoreServer) DownloadImage(*ImageRef, grpc.ServerStreamingServer[ImageChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadImage not implemented")
+}
+func (UnimplementedImageStoreServer) GetMetadata(context.Context, *ImageRef) (*ImageMetadata, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMetadata not implemented")
+}
+func (UnimplementedImageStoreServer) PresignImage(context.Context, *ImageRef) (*PresignedImage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PresignImage not implemented")
+}
+func (UnimplementedImageStoreServer) PromoteImage(context.Context, *PromoteImageRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PromoteImage not implemented")
+}
+func (UnimplementedImageStoreServer) DeleteImage(context.Context, *ImageRef) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteImage not implemented")
+}
+func (UnimplementedImageStoreServer) GetUsage(context.Context, *emptypb.Empty) (*StorageUsage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUsage not implemented")
+}
+func (UnimplementedImageStoreServer) mustEmbedUnimplementedImageStoreServer() {}
+func (UnimplementedImageStoreServer) testEmbeddedByValue()                    {}
+
+// UnsafeImageStoreServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ImageStoreServer will
+// result in compilation errors.
+type UnsafeImageStoreServer interface {
+	mustEmbedUnimplementedImageStoreServer()
+}
+
+func RegisterImageStoreServer(s grpc.ServiceRegistrar, srv ImageStoreServer) {
+	// If the following call pancis, it indicates UnimplementedImageStoreServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ImageStore_ServiceDesc, srv)
+}
+
+func _ImageStore_UploadImage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ImageStoreServer).UploadImage(&grpc.GenericServerStream[UploadImageRequest, emptypb.Empty]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageStore_UploadImageServer = grpc.ClientStreamingServer[UploadImageRequest, emptypb.Empty]
+
+func _ImageStore_DownloadImage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ImageRef)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ImageStoreServer).DownloadImage(m, &grpc.GenericServerStream[ImageRef, ImageChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageStore_DownloadImageServer = grpc.ServerStreamingServer[ImageChunk]
+
+func _ImageStore_GetMetadata_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImageRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageStoreServer).GetMetadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageStore_GetMetadata_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageStoreServer).GetMetadata(ctx, req.(*ImageRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageStore_PresignImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImageRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageStoreServer).PresignImage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageStore_PresignImage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageStoreServer).PresignImage(ctx, req.(*ImageRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageStore_PromoteImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PromoteImageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageStoreServer).PromoteImage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageStore_PromoteImage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageStoreServer).PromoteImage(ctx, req.(*PromoteImageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageStore_DeleteImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImageRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageStoreServer).DeleteImage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageStore_DeleteImage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageStoreServer).DeleteImage(ctx, req.(*ImageRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageStore_GetUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageStoreServer).GetUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageStore_GetUsage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageStoreServer).GetUsage(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ImageStore_ServiceDesc is the grpc.ServiceDesc for ImageStore service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ImageStore_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "imageservice.ImageStore",
+	HandlerType: (*ImageStoreServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetMetadata",
+			Handler:    _ImageStore_GetMetadata_Handler,
+		},
+		{
+			MethodName: "PresignImage",
+			Handler:    _ImageStore_PresignImage_Handler,
+		},
+		{
+			MethodName: "PromoteImage",
+			Handler:    _ImageStore_PromoteImage_Handler,
+		},
+		{
+			MethodName: "DeleteImage",
+			Handler:    _ImageStore_DeleteImage_Handler,
+		},
+		{
+			MethodName: "GetUsage",
+			Handler:    _ImageStore_GetUsage_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "UploadImage",
+			Handler:       _ImageStore_UploadImage_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadImage",
+			Handler:       _ImageStore_DownloadImage_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "imageservice.proto",
+}
+
+const (
+	Master_SubmitImage_FullMethodName    = "/imageservice.Master/SubmitImage"
+	Master_GetTask_FullMethodName        = "/imageservice.Master/GetTask"
+	Master_GetImage_FullMethodName       = "/imageservice.Master/GetImage"
+	Master_Handshake_FullMethodName      = "/imageservice.Master/Handshake"
+	Master_ClaimTask_FullMethodName      = "/imageservice.Master/ClaimTask"
+	Master_ReportProgress_FullMethodName = "/imageservice.Master/ReportProgress"
+	Master_FinishTask_FullMethodName     = "/imageservice.Master/FinishTask"
+	Master_FailTask_FullMethodName       = "/imageservice.Master/FailTask"
+	Master_ReleaseTask_FullMethodName    = "/imageservice.Master/ReleaseTask"
+	Master_ReceiveTasks_FullMethodName   = "/imageservice.Master/ReceiveTasks"
+)
+
+// MasterClient is the client API for Master service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MasterClient interface {
+	// SubmitImage creates a task for the image.
+	SubmitImage(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SubmitImageRequest, Task], error)
+	GetTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*Task, error)
+	// GetImage streams the finished image of a task.
+	GetImage(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ImageChunk], error)
+	// Handshake identifies a worker. The other worker calls need the session it returns.
+	Handshake(ctx context.Context, in *WorkerHello, opts ...grpc.CallOption) (*WorkerSession, error)
+	// ClaimTask gives a polling worker the next task of its operations. Fails with NOT_FOUND if there is none.
+	ClaimTask(ctx context.Context, in *ClaimTaskRequest, opts ...grpc.CallOption) (*Task, error)
+	ReportProgress(ctx context.Context, in *SetProgressRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	FinishTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	FailTask(ctx context.Context, in *FailTaskRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// ReleaseTask gives back a task the worker won't finish, so that another worker takes it.
+	ReleaseTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// ReceiveTasks registers a worker and pushes tasks to it, until it disconnects.
+	ReceiveTasks(ctx context.Context, in *RegisterWorkerRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Task], error)
+}
+
+type masterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMasterClient(cc grpc.ClientConnInterface) MasterClient {
+	return &masterClient{cc}
+}
+
+func (c *masterClient) SubmitImage(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SubmitImageRequest, Task], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Master_ServiceDesc.Streams[0], Master_SubmitImage_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubmitImageRequest, Task]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Master_SubmitImageClient = grpc.ClientStreamingClient[SubmitImageRequest, Task]
+
+func (c *masterClient) GetTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*Task, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Task)
+	err := c.cc.Invoke(ctx, Master_GetTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *masterClient) GetImage(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ImageChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Master_ServiceDesc.Streams[1], Master_GetImage_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[TaskId, ImageChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Master_GetImageClient = grpc.ServerStreamingClient[ImageChunk]
+
+func (c *masterClient) Handshake(ctx context.Context, in *WorkerHello, opts ...grpc.CallOption) (*WorkerSession, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WorkerSession)
+	err := c.cc.Invoke(ctx, Master_Handshake_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *masterClient) ClaimTask(ctx context.Context, in *ClaimTaskRequest, opts ...grpc.CallOption) (*Task, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Task)
+	err := c.cc.Invoke(ctx, Master_ClaimTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *masterClient) ReportProgress(ctx context.Context, in *SetProgressRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Master_ReportProgress_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *masterClient) FinishTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Master_FinishTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *masterClient) FailTask(ctx context.Context, in *FailTaskRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Master_FailTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *masterClient) ReleaseTask(ctx context.Context, in *TaskId, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Master_ReleaseTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *masterClient) ReceiveTasks(ctx context.Context, in *RegisterWorkerRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Task], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Master_ServiceDesc.Streams[2], Master_ReceiveTasks_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RegisterWorkerRequest, Task]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Master_ReceiveTasksClient = grpc.ServerStreamingClient[Task]
+
+// MasterServer is the server API for Master service.
+// All implementations must embed UnimplementedMasterServer
+// for forward compatibility.
+type MasterServer interface {
+	// SubmitImage creates a task for the image.
+	SubmitImage(grpc.ClientStreamingServer[SubmitImageRequest, Task]) error
+	GetTask(context.Context, *TaskId) (*Task, error)
+	// GetImage streams the finished image of a task.
+	GetImage(*TaskId, grpc.ServerStreamingServer[ImageChunk]) error
+	// Handshake identifies a worker. The other worker calls need the session it returns.
+	Handshake(context.Context, *WorkerHello) (*WorkerSession, error)
+	// ClaimTask gives a polling worker the next task of its operations. Fails with NOT_FOUND if there is none.
+	ClaimTask(context.Context, *ClaimTaskRequest) (*Task, error)
+	ReportProgress(context.Context, *SetProgressRequest) (*emptypb.Empty, error)
+	FinishTask(context.Context, *TaskId) (*emptypb.Empty, error)
+	FailTask(context.Context, *FailTaskRequest) (*emptypb.Empty, error)
+	// ReleaseTask gives back a task the worker won't finish, so that another worker takes it.
+	ReleaseTask(context.Context, *TaskId) (*emptypb.Empty, error)
+	// ReceiveTasks registers a worker and pushes tasks to it, until it disconnects.
+	ReceiveTasks(*RegisterWorkerRequest, grpc.ServerStreamingServer[Task]) error
+	mustEmbedUnimplementedMasterServer()
+}
+
+// UnimplementedMasterServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMasterServer struct{}
+
+func (UnimplementedMasterServer) SubmitImage(grpc.ClientStreamingServer[SubmitImageRequest, Task]) error {
+	return status.Errorf(codes.Unimplemented, "method SubmitImage not implemented")
+}
+func (UnimplementedMasterServer) GetTask(context.Context, *TaskId) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTask not implemented")
+}
+func (UnimplementedMasterServer) GetImage(*TaskId, grpc.ServerStreamingServer[ImageChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method GetImage not implemented")
+}
+func (UnimplementedMasterServer) Handshake(context.Context, *WorkerHello) (*WorkerSession, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Handshake not implemented")
+}
+func (UnimplementedMasterServer) ClaimTask(context.Context, *ClaimTaskRequest) (*Task, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClaimTask not implemented")
+}
+func (UnimplementedMasterServer) ReportProgress(context.Context, *SetProgressRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReportProgress not implemented")
+}
+func (UnimplementedMasterServer) FinishTask(context.Context, *TaskId) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FinishTask not implemented")
+}
+func (UnimplementedMasterServer) FailTask(context.Context, *FailTaskRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FailTask not implemented")
+}
+func (UnimplementedMasterServer) ReleaseTask(context.Context, *TaskId) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReleaseTask not implemented")
+}
+func (UnimplementedMasterServer) ReceiveTasks(*RegisterWorkerRequest, grpc.ServerStreamingServer[Task]) error {
+	return status.Errorf(codes.Unimplemented, "method ReceiveTasks not implemented")
+}
+func (UnimplementedMasterServer) mustEmbedUnimplementedMasterServer() {}
+func (UnimplementedMasterServer) testEmbeddedByValue()                {}
+
+// UnsafeMasterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MasterServer will
+// result in compilation errors.
+type UnsafeMasterServer interface {
+	mustEmbedUnimplementedMasterServer()
+}
+
+func RegisterMasterServer(s grpc.ServiceRegistrar, srv MasterServer) {
+	// If the following call pancis, it indicates UnimplementedMasterServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Master_ServiceDesc, srv)
+}
+
+func _Master_SubmitImage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MasterServer).SubmitImage(&grpc.GenericServerStream[SubmitImageRequest, Task]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Master_SubmitImageServer = grpc.ClientStreamingServer[SubmitImageRequest, Task]
+
+func _Master_GetTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterServer).GetTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Master_GetTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterServer).GetTask(ctx, req.(*TaskId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Master_GetImage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TaskId)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MasterServer).GetImage(m, &grpc.GenericServerStream[TaskId, ImageChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Master_GetImageServer = grpc.ServerStreamingServer[ImageChunk]
+
+func _Master_Handshake_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WorkerHello)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterServer).Handshake(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Master_Handshake_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterServer).Handshake(ctx, req.(*WorkerHello))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Master_ClaimTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClaimTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterServer).ClaimTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Master_ClaimTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterServer).ClaimTask(ctx, req.(*ClaimTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Master_ReportProgress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetProgressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterServer).ReportProgress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Master_ReportProgress_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterServer).ReportProgress(ctx, req.(*SetProgressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Master_FinishTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterServer).FinishTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Master_FinishTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterServer).FinishTask(ctx, req.(*TaskId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Master_FailTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FailTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterServer).FailTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Master_FailTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterServer).FailTask(ctx, req.(*FailTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Master_ReleaseTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterServer).ReleaseTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Master_ReleaseTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterServer).ReleaseTask(ctx, req.(*TaskId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Master_ReceiveTasks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RegisterWorkerRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MasterServer).ReceiveTasks(m, &grpc.GenericServerStream[RegisterWorkerRequest, Task]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Master_ReceiveTasksServer = grpc.ServerStreamingServer[Task]
+
+// Master_ServiceDesc is the grpc.ServiceDesc for Master service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Master_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "imageservice.Master",
+	HandlerType: (*MasterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetTask",
+			Handler:    _Master_GetTask_Handler,
+		},
+		{
+			MethodName: "Handshake",
+			Handler:    _Master_Handshake_Handler,
+		},
+		{
+			MethodName: "ClaimTask",
+			Handler:    _Master_ClaimTask_Handler,
+		},
+		{
+			MethodName: "ReportProgress",
+			Handler:    _Master_ReportProgress_Handler,
+		},
+		{
+			MethodName: "FinishTask",
+			Handler:    _Master_FinishTask_Handler,
+		},
+		{
+			MethodName: "FailTask",
+			Handler:    _Master_FailTask_Handler,
+		},
+		{
+			MethodName: "ReleaseTask",
+			Handler:    _Master_ReleaseTask_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubmitImage",
+			Handler:       _Master_SubmitImage_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "GetImage",
+			Handler:       _Master_GetImage_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ReceiveTasks",
+			Handler:       _Master_ReceiveTasks_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "imageservice.proto",
+}
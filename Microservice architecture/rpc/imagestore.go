@@ -0,0 +1,99 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The images-store may run as a replica set, its address in the key-value store is then a comma separated list.
+// The replicas replicate between themselves, so any of them can be used. If one doesn't respond the next one is tried.
+
+type ImageStores []ImageStoreClient
+
+// DialImageStores connects to every replica of the list.
+func DialImageStores(addresses string) (ImageStores, error) {
+	stores := ImageStores{}
+	for _, address := range strings.Split(addresses, ",") {
+		address = strings.TrimSpace(address)
+		if len(address) == 0 {
+			continue
+		}
+		conn, err := Dial(address)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, NewImageStoreClient(conn))
+	}
+	if len(stores) == 0 {
+		return nil, errors.New("Error: no storage address known.")
+	}
+	return stores, nil
+}
+
+// Call runs the call against the replicas in turn, until one of them answers.
+func (stores ImageStores) Call(call func(ImageStoreClient) error) error {
+	err := status.Error(codes.Unavailable, "no storage address known")
+	for _, store := range stores {
+		err = call(store)
+		if !IsUnavailable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// Upload streams the image to the images-store.
+func (stores ImageStores) Upload(ctx context.Context, header *UploadHeader, data []byte) error {
+	return stores.Call(func(store ImageStoreClient) error {
+		stream, err := store.UploadImage(ctx)
+		if err != nil {
+			return err
+		}
+		err = stream.Send(&UploadImageRequest{Part: &UploadImageRequest_Header{Header: header}})
+		// Every attempt sends the whole image, a failover starts over on the next replica.
+		remaining := data
+		for len(remaining) > 0 && err == nil {
+			size := ChunkSize
+			if len(remaining) < size {
+				size = len(remaining)
+			}
+			err = stream.Send(&UploadImageRequest{Part: &UploadImageRequest_Chunk{Chunk: remaining[:size]}})
+			remaining = remaining[size:]
+		}
+		// A failed Send only tells that the stream broke, the reason comes with CloseAndRecv.
+		_, err = stream.CloseAndRecv()
+		return err
+	})
+}
+
+// Download reads the whole image from the images-store.
+func (stores ImageStores) Download(ctx context.Context, ref *ImageRef) ([]byte, error) {
+	var data bytes.Buffer
+	err := stores.Call(func(store ImageStoreClient) error {
+		data.Reset()
+		stream, err := store.DownloadImage(ctx, ref)
+		if err != nil {
+			return err
+		}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			data.Write(chunk.Data)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
@@ -0,0 +1,48 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"../metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// The calls a service serves are counted by method and status code, like its HTTP requests. Streams count once they
+// end, so the duration of a stream of events is how long it was open.
+
+var callsHandled = metrics.NewCounter("grpc_server_handled_total", "gRPC calls served", "grpc_type", "grpc_service", "grpc_method", "grpc_code")
+var callDuration = metrics.NewHistogram("grpc_server_handling_seconds", "Time taken to serve gRPC calls", metrics.DefaultBuckets, "grpc_type", "grpc_service", "grpc_method")
+
+func countCall(kind string, fullMethod string, start time.Time, err error) {
+	// The full method is "/imageservice.TaskStore/GetTask".
+	serviceName, method := "", strings.TrimPrefix(fullMethod, "/")
+	if slash := strings.LastIndex(method, "/"); slash != -1 {
+		serviceName, method = method[:slash], method[slash+1:]
+	}
+	callsHandled.Inc(kind, serviceName, method, status.Code(err).String())
+	callDuration.Observe(time.Since(start).Seconds(), kind, serviceName, method)
+}
+
+func countUnaryServer(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	response, err := handler(ctx, request)
+	countCall("unary", info.FullMethod, start, err)
+	return response, err
+}
+
+func countStreamServer(server interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(server, stream)
+	kind := "bidi_stream"
+	switch {
+	case !info.IsClientStream:
+		kind = "server_stream"
+	case !info.IsServerStream:
+		kind = "client_stream"
+	}
+	countCall(kind, info.FullMethod, start, err)
+	return err
+}
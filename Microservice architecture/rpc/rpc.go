@@ -0,0 +1,212 @@
+// Package rpc holds the gRPC interface between the services, generated from imageservice.proto,
+// and what the services need to serve and call it.
+//
+// Every service serves gRPC next to HTTP, on the port of its HTTP address plus 1000. So the addresses in the
+// key-value store are enough to find both.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative imageservice.proto
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const portOffset = 1000
+
+// ChunkSize is how much of an image goes into one message of a stream.
+const ChunkSize = 64 * 1024
+
+// CallTimeout applies to the calls made without a deadline. Streams aren't limited.
+const CallTimeout = time.Second * 10
+
+// Address returns the gRPC address of the service with the given HTTP address.
+func Address(httpAddress string) (string, error) {
+	host, port, err := net.SplitHostPort(httpAddress)
+	if err != nil {
+		return "", err
+	}
+	number, err := strconv.Atoi(port)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(number+portOffset)), nil
+}
+
+// Dial connects lazily, so it only fails on a malformed address. Dead connections are noticed within seconds,
+// which matters for the long lived streams.
+func Dial(httpAddress string) (*grpc.ClientConn, error) {
+	address, err := Address(httpAddress)
+	if err != nil {
+		return nil, err
+	}
+	return DialTarget(address)
+}
+
+// DialTarget connects like Dial to a gRPC target, which may name a resolver given in the options.
+func DialTarget(target string, options ...grpc.DialOption) (*grpc.ClientConn, error) {
+	options = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: time.Second * 10, Timeout: time.Second * 5, PermitWithoutStream: true}),
+		grpc.WithChainUnaryInterceptor(defaultTimeout, traceUnaryClient),
+		grpc.WithChainStreamInterceptor(traceStreamClient),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(ChunkSize * 4)),
+	}, options...)
+	return grpc.NewClient(target, options...)
+}
+
+func defaultTimeout(ctx context.Context, method string, request, reply interface{}, conn *grpc.ClientConn, invoker grpc.UnaryInvoker, options ...grpc.CallOption) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, CallTimeout)
+		defer cancel()
+	}
+	return invoker(ctx, method, request, reply, conn, options...)
+}
+
+func NewServer(options ...grpc.ServerOption) *grpc.Server {
+	options = append([]grpc.ServerOption{
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: time.Second * 5, PermitWithoutStream: true}),
+		grpc.KeepaliveParams(keepalive.ServerParameters{Time: time.Second * 10, Timeout: time.Second * 5}),
+		grpc.ChainUnaryInterceptor(countUnaryServer, traceUnaryServer),
+		grpc.ChainStreamInterceptor(countStreamServer, traceStreamServer),
+	}, options...)
+	return grpc.NewServer(options...)
+}
+
+// Serve listens on the gRPC address belonging to the HTTP address. It only returns on failure.
+func Serve(server *grpc.Server, httpAddress string) error {
+	address, err := Address(httpAddress)
+	if err != nil {
+		return err
+	}
+	_, port, _ := net.SplitHostPort(address)
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+// Error carries the HTTP status and the reason of a failure through gRPC, so that the HTTP endpoints
+// can pass it on to their clients as before.
+func Error(httpStatus int, reason string, message string) error {
+	myStatus := status.New(codeOf(httpStatus), message)
+	detailed, err := myStatus.WithDetails(&errdetails.ErrorInfo{Reason: reason, Metadata: map[string]string{"status": strconv.Itoa(httpStatus)}})
+	if err != nil {
+		return myStatus.Err()
+	}
+	return detailed.Err()
+}
+
+// Reason returns the reason passed to Error, empty if there is none.
+func Reason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+// Message returns the message of the error without the gRPC decoration.
+func Message(err error) string {
+	return status.Convert(err).Message()
+}
+
+// HTTPStatus tells which status an HTTP endpoint should respond with for the error.
+func HTTPStatus(err error) int {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			if httpStatus, err := strconv.Atoi(info.Metadata["status"]); err == nil {
+				return httpStatus
+			}
+		}
+	}
+	switch status.Code(err) {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Canceled:
+		return 499
+	}
+	return http.StatusBadGateway
+}
+
+func codeOf(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return codes.InvalidArgument
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented, http.StatusMethodNotAllowed:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if httpStatus >= 500 {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+// IsUnavailable tells whether another replica might succeed where this call failed.
+func IsUnavailable(err error) bool {
+	code := status.Code(err)
+	return code == codes.Unavailable || code == codes.DeadlineExceeded || code == codes.Internal
+}
+
+// Timestamp converts an optional time.
+func Timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// Time converts an optional timestamp.
+func Time(timestamp *timestamppb.Timestamp) *time.Time {
+	if timestamp == nil {
+		return nil
+	}
+	t := timestamp.AsTime()
+	return &t
+}
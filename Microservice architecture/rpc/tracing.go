@@ -0,0 +1,108 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"../tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Calls pass the request id and the trace on in their metadata, as the HTTP calls do in their headers. Every call is
+// a client span in the caller and a server span in the service, named after the method.
+
+func injectTrace(ctx context.Context) context.Context {
+	pairs := []string{}
+	tracing.Inject(ctx, func(key string, value string) {
+		pairs = append(pairs, key, value)
+	})
+	return metadata.AppendToOutgoingContext(ctx, pairs...)
+}
+
+func extractTrace(ctx context.Context) context.Context {
+	incoming, _ := metadata.FromIncomingContext(ctx)
+	return tracing.Extract(ctx, func(key string) string {
+		values := incoming.Get(key)
+		if len(values) == 0 {
+			return ""
+		}
+		return values[0]
+	})
+}
+
+func endSpan(span *tracing.Span, err error) {
+	span.SetAttribute("rpc.grpc.status_code", int(status.Code(err)))
+	span.SetError(err)
+	span.End()
+}
+
+func traceUnaryClient(ctx context.Context, method string, request, reply interface{}, conn *grpc.ClientConn, invoker grpc.UnaryInvoker, options ...grpc.CallOption) error {
+	ctx, span := tracing.Start(ctx, method, tracing.Client)
+	err := invoker(injectTrace(ctx), method, request, reply, conn, options...)
+	endSpan(span, err)
+	return err
+}
+
+func traceStreamClient(ctx context.Context, desc *grpc.StreamDesc, conn *grpc.ClientConn, method string, streamer grpc.Streamer, options ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx, span := tracing.Start(ctx, method, tracing.Client)
+	stream, err := streamer(injectTrace(ctx), desc, conn, method, options...)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	return &tracedClientStream{ClientStream: stream, span: span, single: !desc.ServerStreams}, nil
+}
+
+// tracedClientStream ends the span of the call with the stream, which is when it fails or runs out of messages, or
+// with the response if there's only one.
+type tracedClientStream struct {
+	grpc.ClientStream
+	span   *tracing.Span
+	single bool
+	once   sync.Once
+}
+
+func (stream *tracedClientStream) RecvMsg(message interface{}) error {
+	err := stream.ClientStream.RecvMsg(message)
+	if err != nil || stream.single {
+		stream.once.Do(func() {
+			if err == io.EOF {
+				err = nil
+			}
+			endSpan(stream.span, err)
+		})
+	}
+	return err
+}
+
+func traceUnaryServer(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, span := tracing.Start(extractTrace(ctx), info.FullMethod, tracing.Server)
+	start := time.Now()
+	response, err := handler(ctx, request)
+	endSpan(span, err)
+	slog.DebugContext(ctx, "Served", "method", info.FullMethod, "code", status.Code(err).String(), "duration", time.Since(start))
+	return response, err
+}
+
+func traceStreamServer(server interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, span := tracing.Start(extractTrace(stream.Context()), info.FullMethod, tracing.Server)
+	start := time.Now()
+	err := handler(server, &tracedServerStream{ServerStream: stream, ctx: ctx})
+	endSpan(span, err)
+	slog.DebugContext(ctx, "Served", "method", info.FullMethod, "code", status.Code(err).String(), "duration", time.Since(start))
+	return err
+}
+
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *tracedServerStream) Context() context.Context {
+	return stream.ctx
+}
@@ -9,15 +9,19 @@ sleep 2
 echo Run Tasks store...
 ./tasks-store 127.0.0.1:3001 127.0.0.1:3000 &
 
-echo Run Image store...
-./images-store 127.0.0.1:3002 127.0.0.1:3000 &
+echo Run Image store replicas...
+REPLICAS=127.0.0.1:3002,127.0.0.1:3004,127.0.0.1:3005
+./images-store -dir=/tmp/images-store-1 -replicas=$REPLICAS 127.0.0.1:3002 127.0.0.1:3000 &
+./images-store -dir=/tmp/images-store-2 -replicas=$REPLICAS 127.0.0.1:3004 127.0.0.1:3000 &
+./images-store -dir=/tmp/images-store-3 -replicas=$REPLICAS 127.0.0.1:3005 127.0.0.1:3000 &
 
-echo Run Master...
+echo Run Masters...
 ./master 127.0.0.1:3003 127.0.0.1:3000 &
+./master 127.0.0.1:3006 127.0.0.1:3000 &
 sleep 3
 
 echo Run Worker...
-./worker 127.0.0.1:3000 3 &
+./worker -plugins plugins -listen 127.0.0.1:3010 127.0.0.1:3000 3 &
 
 echo Frontend...
 sudo ./frontend 127.0.0.1:3000 &
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"../httpclient"
+	"../rpc"
+	"google.golang.org/grpc"
+)
+
+// Keys under which the services publish their addresses in the config store.
+const (
+	TaskStoreKey  = "databaseAddress"
+	ImageStoreKey = "storageAddress" // A comma separated list if the images-store runs as a replica set.
+	MasterKey     = "masterAddress"
+)
+
+// The gRPC metadata keys, and HTTP headers, with which a worker identifies itself to the Master.
+const (
+	WorkerIdKey         = "worker-id"
+	WorkerCredentialKey = "worker-credential"
+)
+
+// ConfigStore is a client of the key-value store holding the configuration of the stack.
+type ConfigStore struct {
+	address string
+}
+
+func NewConfigStore(address string) *ConfigStore {
+	return &ConfigStore{address: address}
+}
+
+func (config *ConfigStore) Address() string {
+	return config.address
+}
+
+// Get returns the value of the key, empty if it isn't set.
+func (config *ConfigStore) Get(ctx context.Context, key string) (string, error) {
+	response, err := httpclient.Get(ctx, "http://"+config.address+"/get?key="+url.QueryEscape(key))
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", responseError(response)
+	}
+	return string(response.Body), nil
+}
+
+// Lookup returns the value of the key, which must be set.
+func (config *ConfigStore) Lookup(ctx context.Context, key string) (string, error) {
+	value, err := config.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if len(value) == 0 {
+		return "", errors.New("Error: " + key + " isn't set in the config store.")
+	}
+	return value, nil
+}
+
+func (config *ConfigStore) Set(ctx context.Context, key string, value string) error {
+	response, err := httpclient.Post(ctx, "http://"+config.address+"/set?key="+url.QueryEscape(key)+"&value="+url.QueryEscape(value), "text/plain", nil)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return responseError(response)
+	}
+	return nil
+}
+
+// List returns the keys starting with the prefix and their values.
+func (config *ConfigStore) List(ctx context.Context, prefix string) (map[string]string, error) {
+	response, err := httpclient.Get(ctx, "http://"+config.address+"/list?prefix="+url.QueryEscape(prefix))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, responseError(response)
+	}
+	values := map[string]string{}
+	for _, line := range strings.Split(string(response.Body), "\n") {
+		parts := strings.SplitN(line, " : ", 2)
+		if len(parts) == 2 {
+			values[parts[0]] = parts[1]
+		}
+	}
+	return values, nil
+}
+
+// TaskStore connects to the tasks-store.
+func (config *ConfigStore) TaskStore(ctx context.Context) (rpc.TaskStoreClient, error) {
+	address, err := config.Lookup(ctx, TaskStoreKey)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := rpc.Dial(address)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.NewTaskStoreClient(conn), nil
+}
+
+// ImageStores connects to the replicas of the images-store.
+func (config *ConfigStore) ImageStores(ctx context.Context) (rpc.ImageStores, error) {
+	addresses, err := config.Lookup(ctx, ImageStoreKey)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.DialImageStores(addresses)
+}
+
+// Acquire takes or renews the lease on the key for the holder, for the given time. It returns false if somebody
+// else holds the lease.
+func (config *ConfigStore) Acquire(ctx context.Context, key string, holder string, ttl time.Duration) (bool, error) {
+	response, err := httpclient.Post(ctx, "http://"+config.address+"/acquire?key="+url.QueryEscape(key)+"&value="+url.QueryEscape(holder)+"&ttl="+ttl.String(), "text/plain", nil)
+	if err != nil {
+		return false, err
+	}
+	if response.StatusCode == http.StatusConflict {
+		return false, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return false, responseError(response)
+	}
+	return true, nil
+}
+
+// Release gives up the lease on the key, if the holder still has it.
+func (config *ConfigStore) Release(ctx context.Context, key string, holder string) error {
+	response, err := httpclient.Post(ctx, "http://"+config.address+"/release?key="+url.QueryEscape(key)+"&value="+url.QueryEscape(holder), "text/plain", nil)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return responseError(response)
+	}
+	return nil
+}
+
+// Master connects to the leader of the Masters, and follows the leadership to the next one if it dies.
+func (config *ConfigStore) Master(ctx context.Context, options ...grpc.DialOption) (rpc.MasterClient, error) {
+	_, err := config.Lookup(ctx, MasterKey)
+	if err != nil {
+		return nil, err
+	}
+	options = append(options, grpc.WithResolvers(configResolverBuilder{config: config}))
+	conn, err := rpc.DialTarget("config:///"+MasterKey, options...)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.NewMasterClient(conn), nil
+}
+
+// responseError reads the error a service responded with.
+func responseError(response *httpclient.Response) error {
+	myError := &Error{}
+	if json.Unmarshal(response.Body, myError) != nil || len(myError.Code) == 0 {
+		myError = NewError(response.StatusCode, "unexpected_response", string(response.Body))
+	}
+	myError.Status = response.StatusCode
+	return myError
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"../metrics"
+	"../rpc"
+	"../tracing"
+	"google.golang.org/grpc/status"
+)
+
+// Error is a failure as the HTTP endpoints report it, as JSON:
+//
+//	{"code": "wrong_input", "message": "Wrong input"}
+type Error struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func NewError(status int, code string, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// WrongInput is the error of a request with missing or malformed parameters.
+func WrongInput(message string) *Error {
+	return NewError(http.StatusBadRequest, "wrong_input", message)
+}
+
+// HandlerFunc is an endpoint. Instead of writing an error response itself it returns the error, which can be
+// an *Error, an error of a gRPC call to another service, or anything else for an internal error.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// Methods routes the requests of an endpoint by their method. Other methods are refused.
+type Methods map[string]HandlerFunc
+
+func (methods Methods) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, ok := methods[r.Method]
+	if !ok {
+		allowed := []string{}
+		for method := range methods {
+			allowed = append(allowed, method)
+		}
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		WriteError(w, NewError(http.StatusMethodNotAllowed, "method_not_allowed", "Only "+strings.Join(allowed, ", ")+" accepted"))
+		return
+	}
+
+	recorder := &statusRecorder{ResponseWriter: w}
+	start := time.Now()
+	err := handler(recorder, r)
+	if err == nil {
+		return
+	}
+	myError := ToError(err)
+	if myError.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "Request failed", "method", r.Method, "path", r.URL.Path, "status", myError.Status, "duration", time.Since(start), "err", err)
+	}
+	if recorder.written {
+		// Too late to tell the client, a streaming response broke off.
+		return
+	}
+	WriteError(w, myError)
+}
+
+var requestsServed = metrics.NewCounter("http_requests_total", "HTTP requests served", "service", "route", "method", "status")
+var requestDuration = metrics.NewHistogram("http_request_duration_seconds", "Time taken to serve HTTP requests", metrics.DefaultBuckets, "service", "route", "method")
+
+// traced serves the requests of an endpoint as spans of the traces of the callers, counts them and logs them at
+// debug level. The request id goes back in the response.
+func traced(name string, pattern string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracing.Extract(r.Context(), r.Header.Get)
+		ctx, span := tracing.Start(ctx, r.Method+" "+pattern, tracing.Server)
+		w.Header().Set(tracing.RequestIdHeader, tracing.RequestId(ctx))
+		recorder := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+
+		handler.ServeHTTP(recorder, r.WithContext(ctx))
+
+		status := recorder.statusCode()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", pattern)
+		span.SetAttribute("http.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(status)))
+		}
+		span.End()
+		duration := time.Since(start)
+		requestsServed.Inc(name, pattern, r.Method, strconv.Itoa(status))
+		requestDuration.Observe(duration.Seconds(), name, pattern, r.Method)
+		slog.DebugContext(ctx, "Served", "method", r.Method, "path", r.URL.Path, "status", status, "duration", duration)
+	})
+}
+
+// statusRecorder notices whether the handler has started its response already, and with which status.
+type statusRecorder struct {
+	http.ResponseWriter
+	written bool
+	status  int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.written = true
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Write(data []byte) (int, error) {
+	recorder.written = true
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	return recorder.ResponseWriter.Write(data)
+}
+
+// statusCode is the status of the response, 200 if the handler didn't write any.
+func (recorder *statusRecorder) statusCode() int {
+	if recorder.status == 0 {
+		return http.StatusOK
+	}
+	return recorder.status
+}
+
+func (recorder *statusRecorder) Flush() {
+	recorder.written = true
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack is needed by the WebSocket upgrade.
+func (recorder *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := recorder.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("Error: The connection can't be taken over")
+	}
+	recorder.written = true
+	recorder.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// ToError turns any error into the one to respond with. Errors of other services keep their status and code.
+func ToError(err error) *Error {
+	if myError, ok := err.(*Error); ok {
+		return myError
+	}
+	if os.IsNotExist(err) {
+		return NewError(http.StatusNotFound, "not_found", "Not found.")
+	}
+	if grpcStatus, ok := status.FromError(err); ok {
+		code := rpc.Reason(err)
+		if len(code) == 0 {
+			code = snakeCase(grpcStatus.Code().String())
+		}
+		return NewError(rpc.HTTPStatus(err), code, grpcStatus.Message())
+	}
+	return NewError(http.StatusInternalServerError, "internal_error", err.Error())
+}
+
+func snakeCase(name string) string {
+	result := []rune{}
+	for i, character := range name {
+		if character >= 'A' && character <= 'Z' {
+			if i != 0 {
+				result = append(result, '_')
+			}
+			character += 'a' - 'A'
+		}
+		result = append(result, character)
+	}
+	return string(result)
+}
+
+func WriteError(w http.ResponseWriter, err error) {
+	myError := ToError(err)
+	response, _ := json.Marshal(myError)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(myError.Status)
+	w.Write(response)
+}
+
+func WriteJSON(w http.ResponseWriter, value interface{}) error {
+	response := bytes.Buffer{}
+	encoder := json.NewEncoder(&response)
+	encoder.SetEscapeHTML(false) // Keep links readable.
+	err := encoder.Encode(value)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response.Bytes())
+	return nil
+}
+
+// Query parses the query of the request.
+func Query(r *http.Request) (url.Values, error) {
+	values, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		return nil, NewError(http.StatusBadRequest, "invalid_query", err.Error())
+	}
+	return values, nil
+}
+
+// Required returns the parameter, which mustn't be empty.
+func Required(values url.Values, name string) (string, error) {
+	if len(values.Get(name)) == 0 {
+		return "", WrongInput("Wrong input: " + name + " missing")
+	}
+	return values.Get(name), nil
+}
+
+// Int returns the parameter, which must be a number.
+func Int(values url.Values, name string) (int64, error) {
+	number, err := strconv.ParseInt(values.Get(name), 10, 64)
+	if err != nil {
+		return 0, WrongInput("Wrong input: " + name + " must be a number")
+	}
+	return number, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"strings"
+
+	"../tracing"
+)
+
+// The services log with log/slog, as text or JSON, each line with the name of the service and, if it's about a
+// request, its request id and trace. The trace spans go to -trace-file or an OpenTelemetry collector at
+// -otlp-endpoint.
+
+var logLevel = &levelFlag{}
+var logFormat = flag.String("log-format", "text", "Format of the log: text or json")
+var traceFile = flag.String("trace-file", "", "File to append the trace spans to, as OTLP JSON lines")
+var otlpEndpoint = flag.String("otlp-endpoint", "", "OpenTelemetry collector to send the trace spans to over OTLP/HTTP, like http://127.0.0.1:4318")
+
+func init() {
+	flag.Var(logLevel, "log-level", "Least level logged: debug, info, warn or error (dynamic)")
+}
+
+// levelFlag is the level of the log, which may change while the service runs.
+type levelFlag struct {
+	slog.LevelVar
+}
+
+func (level *levelFlag) Set(value string) error {
+	return level.UnmarshalText([]byte(value))
+}
+
+func (level *levelFlag) String() string {
+	return strings.ToLower(level.Level().String())
+}
+
+func (level *levelFlag) dynamic() {}
+
+// setupLogging makes slog log for the named service, and starts the export of its spans.
+func setupLogging(name string) error {
+	options := &slog.HandlerOptions{Level: &logLevel.LevelVar}
+	var handler slog.Handler
+	switch *logFormat {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, options)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	default:
+		return errors.New("Error: Invalid -log-format " + *logFormat + ", it must be text or json")
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}).With("service", name))
+
+	if len(*traceFile) != 0 {
+		exporter, err := tracing.NewFileExporter(*traceFile)
+		if err != nil {
+			return err
+		}
+		tracing.SetExporter(name, exporter)
+	} else if len(*otlpEndpoint) != 0 {
+		tracing.SetExporter(name, tracing.NewOTLPExporter(*otlpEndpoint))
+	}
+	return nil
+}
+
+// contextHandler adds the request id and the trace of the context to the log lines.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (handler contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := tracing.RequestId(ctx); len(id) != 0 {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if span := tracing.FromContext(ctx); span != nil {
+		record.AddAttrs(slog.String("trace_id", span.TraceId), slog.String("span_id", span.SpanId))
+	}
+	return handler.Handler.Handle(ctx, record)
+}
+
+func (handler contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{handler.Handler.WithAttrs(attrs)}
+}
+
+func (handler contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{handler.Handler.WithGroup(name)}
+}
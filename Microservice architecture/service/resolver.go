@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"../rpc"
+	"google.golang.org/grpc/resolver"
+)
+
+// How often a connection checks whether the address it follows has changed, besides when it fails.
+const resolveInterval = time.Second * 2
+
+// configResolverBuilder lets gRPC connections dial a key of the config store, as "config:///masterAddress".
+// The connection follows the address the key holds, so that it moves over to a new leader.
+type configResolverBuilder struct {
+	config *ConfigStore
+}
+
+func (builder configResolverBuilder) Scheme() string {
+	return "config"
+}
+
+func (builder configResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, options resolver.BuildOptions) (resolver.Resolver, error) {
+	myResolver := &configResolver{
+		config:     builder.config,
+		key:        target.Endpoint(),
+		cc:         cc,
+		resolveNow: make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	go myResolver.watch()
+	return myResolver, nil
+}
+
+type configResolver struct {
+	config     *ConfigStore
+	key        string
+	cc         resolver.ClientConn
+	resolveNow chan struct{}
+	done       chan struct{}
+	address    string // The gRPC address last handed to the connection, empty after a failure.
+}
+
+// ResolveNow is called by gRPC when the connection fails.
+func (myResolver *configResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case myResolver.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+func (myResolver *configResolver) Close() {
+	close(myResolver.done)
+}
+
+func (myResolver *configResolver) watch() {
+	ticker := time.NewTicker(resolveInterval)
+	defer ticker.Stop()
+	for {
+		myResolver.resolve()
+		select {
+		case <-myResolver.resolveNow:
+		case <-ticker.C:
+		case <-myResolver.done:
+			return
+		}
+	}
+}
+
+func (myResolver *configResolver) resolve() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	httpAddress, err := myResolver.config.Lookup(ctx, myResolver.key)
+	if err != nil {
+		myResolver.address = ""
+		myResolver.cc.ReportError(err)
+		return
+	}
+	address, err := rpc.Address(httpAddress)
+	if err != nil {
+		myResolver.address = ""
+		myResolver.cc.ReportError(err)
+		return
+	}
+	if address == myResolver.address {
+		return
+	}
+	myResolver.address = address
+	myResolver.cc.UpdateState(resolver.State{Addresses: []resolver.Address{{Addr: address}}})
+}
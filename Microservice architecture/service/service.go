@@ -0,0 +1,167 @@
+// Package service holds what all the services of the stack share: the domain types, typed clients for the
+// services, the handler framework of the HTTP endpoints and the bootstrap of a service.
+//
+// A service is a package with a Main, which its executable in cmd calls with the values of service.Configure, and
+// starts like this:
+//
+//	func Main(args []string) {
+//		myService := service.New("tasks-store", args[0], args[1])
+//		err := myService.Register(context.Background(), service.TaskStoreKey)
+//		myService.Handle("/getById", service.Methods{http.MethodGet: getById})
+//		err = myService.Run()
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"../metrics"
+	"../rpc"
+	"../tracing"
+	"google.golang.org/grpc"
+)
+
+// Version of the stack. The workers and the Master exchange it in their handshake.
+const Version = "1.0.0"
+
+// ShutdownTimeout is how long a service waits for the requests in progress when it's asked to stop.
+const ShutdownTimeout = time.Second * 10
+
+// ClaimTimeout is how long a worker may take for a task before the tasks-store hands it out again.
+var ClaimTimeout = DurationFlag("claim-timeout", time.Second*120, "How long a worker may take for a task before it's handed out again")
+
+type Service struct {
+	Name    string
+	Address string // Where the other services reach this one, empty if they don't.
+	Config  *ConfigStore
+	Grpc    *grpc.Server // Served next to HTTP, see rpc.Address. Nil if the service has no gRPC interface.
+
+	mux        *http.ServeMux
+	stopping   chan struct{}
+	onShutdown []func(ctx context.Context)
+}
+
+// Fatal ends the program because of an error during the startup.
+func Fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
+
+// HealthPath answers 200 once the service serves requests, which the stack waits for before starting the next services.
+const HealthPath = "/healthz"
+
+// MetricsPath serves the metrics of the service in the text format of Prometheus.
+const MetricsPath = "/metrics"
+
+func New(name string, address string, configStoreAddress string) *Service {
+	service := &Service{
+		Name:     name,
+		Address:  address,
+		Config:   NewConfigStore(configStoreAddress),
+		mux:      http.NewServeMux(),
+		stopping: make(chan struct{}),
+	}
+	// Not traced, the health checks would drown the requests.
+	service.mux.Handle(HealthPath, Methods{http.MethodGet: func(w http.ResponseWriter, r *http.Request) error {
+		fmt.Fprint(w, "ok")
+		return nil
+	}})
+	// For Prometheus to scrape, see metrics.
+	service.mux.Handle(MetricsPath, metrics.Handler())
+	return service
+}
+
+// Register publishes the address of the service in the config store, so that the others can find it.
+func (service *Service) Register(ctx context.Context, key string) error {
+	return service.Config.Set(ctx, key, service.Address)
+}
+
+// EnableGrpc creates the gRPC server, on which the service registers its implementation before calling Run.
+func (service *Service) EnableGrpc(options ...grpc.ServerOption) *grpc.Server {
+	service.Grpc = rpc.NewServer(options...)
+	return service.Grpc
+}
+
+// Handle serves the endpoint. Its requests are traced, see tracing, and counted.
+func (service *Service) Handle(pattern string, handler http.Handler) {
+	service.mux.Handle(pattern, traced(service.Name, pattern, handler))
+}
+
+// Stopping is closed once the service is asked to stop. Streams, which wouldn't end by themselves, end then.
+func (service *Service) Stopping() <-chan struct{} {
+	return service.stopping
+}
+
+// OnShutdown adds a function to run once the requests in progress are done, when the service stops.
+func (service *Service) OnShutdown(hook func(ctx context.Context)) {
+	service.onShutdown = append(service.onShutdown, hook)
+}
+
+// Run serves HTTP on the port of the address of the service, and gRPC if it's enabled. On SIGTERM or SIGINT it
+// stops taking requests, waits up to ShutdownTimeout for the ones in progress and returns nil.
+func (service *Service) Run() error {
+	_, port, err := net.SplitHostPort(service.Address)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Addr: ":" + port, Handler: service.mux}
+	server.RegisterOnShutdown(func() {
+		close(service.stopping)
+	})
+
+	failed := make(chan error, 2)
+	if service.Grpc != nil {
+		go func() {
+			failed <- fmt.Errorf("Error: gRPC server of the %s stopped: %v", service.Name, rpc.Serve(service.Grpc, service.Address))
+		}()
+	}
+	go func() {
+		failed <- server.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+	select {
+	case err := <-failed:
+		return err
+	case received := <-signals:
+		slog.Info("Stopping", "signal", received.String())
+	}
+	return service.shutdown(server)
+}
+
+func (service *Service) shutdown(server *http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if service.Grpc != nil {
+		stopped := make(chan struct{})
+		go func() {
+			service.Grpc.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			service.Grpc.Stop()
+		}
+	}
+	for _, hook := range service.onShutdown {
+		hook(ctx)
+	}
+	tracing.Flush(ctx)
+	if err != nil {
+		return fmt.Errorf("Error: The %s didn't finish its requests in time: %v", service.Name, err)
+	}
+	slog.Info("Stopped")
+	return nil
+}
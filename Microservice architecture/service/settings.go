@@ -0,0 +1,432 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Every setting of a service is a flag. A setting which isn't given on the command line comes from the environment,
+// as IMAGES_ and the name of the flag in capitals (IMAGES_MAX_AGE for -max-age), else from the -config file, else
+// from the config store, else it keeps its default.
+//
+// The config file is YAML, or TOML if its name ends with .toml. Its top-level settings apply to all the services
+// which have them, those in a section named after a service only to that one:
+//
+//	worker-token: secret
+//	master:
+//	  claim-timeout: 3m
+//
+// The config store holds settings shared by all the services as settings.<flag>, and those of a single one as
+// settings.<service>.<flag>. They are checked every settingsInterval, and changes of dynamic settings, like those
+// of DurationFlag, apply while the service runs. The others apply after a restart.
+
+const envPrefix = "IMAGES_"
+const sharedSettingsPrefix = "settings."
+const settingsInterval = time.Second * 10
+
+// settingsStartupWait is how long a starting service waits for the config store, before it gives up rather than run
+// without the settings.
+const settingsStartupWait = time.Second * 30
+
+var configFile = flag.String("config", os.Getenv(envPrefix+"CONFIG"), "YAML or TOML file with settings, $"+envPrefix+"CONFIG by default")
+
+// The addresses most services are started with. They may also be given as arguments.
+var _ = flag.String("address", "", "Address of the service, host:port. It serves gRPC on the port plus 1000")
+var _ = flag.String("config-store", "", "Address of the config store, host:port")
+
+// Where the value of each flag which isn't at its default came from.
+var sources = map[string]string{}
+var sourcesMutex sync.Mutex
+
+const (
+	fromCommandLine = "the command line"
+	fromEnvironment = "the environment"
+	fromConfigStore = "the config store"
+)
+
+// Configure parses the command line and loads the settings of the named service. It returns the values of the given
+// settings, which may also be passed as arguments in this order, followed by the remaining arguments. A setting given
+// as "address=:80" defaults to :80, the others are required. Missing or invalid settings end the program.
+func Configure(name string, settings ...string) []string {
+	names := []string{}
+	defaults := []string{}
+	for _, setting := range settings {
+		parts := strings.SplitN(setting, "=", 2)
+		names = append(names, parts[0])
+		if len(parts) == 2 {
+			defaults = append(defaults, parts[1])
+		} else {
+			defaults = append(defaults, "")
+		}
+	}
+	flag.Usage = func() {
+		arguments := ""
+		for _, setting := range names {
+			arguments += " [" + setting + "]"
+		}
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]%s\n\n", name, arguments)
+		fmt.Fprintf(flag.CommandLine.Output(), "Settings which aren't flags come from $%s<FLAG>, the -config file or the config store.\n\n", envPrefix)
+		flag.PrintDefaults()
+	}
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+
+	err := LoadSettings(name)
+	if err != nil {
+		Fatal(err)
+	}
+	err = setupLogging(name)
+	if err != nil {
+		Fatal(err)
+	}
+
+	values := []string{}
+	for i, setting := range names {
+		if i < flag.NArg() {
+			err = setFlag(setting, flag.Arg(i), fromCommandLine)
+			if err != nil {
+				Fatal(err)
+			}
+		}
+		value := flag.Lookup(setting).Value.String()
+		if len(value) == 0 {
+			value = defaults[i]
+		}
+		if len(value) == 0 {
+			Fatal(fmt.Errorf("Error: The %s needs -%s, or it as argument %d. See -h for all the settings.", name, setting, i+1))
+		}
+		if setting == "address" || setting == "config-store" {
+			err = validateAddress(value)
+			if err != nil {
+				Fatal(fmt.Errorf("Error: Invalid -%s %q: %v", setting, value, err))
+			}
+		}
+		values = append(values, value)
+	}
+
+	if flag.Lookup("config-store") != nil && len(flag.Lookup("config-store").Value.String()) != 0 {
+		WatchSettings(name, flag.Lookup("config-store").Value.String())
+	}
+
+	if flag.NArg() > len(names) {
+		values = append(values, flag.Args()[len(names):]...)
+	}
+	return values
+}
+
+func validateAddress(address string) error {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	number, err := strconv.Atoi(port)
+	if err != nil || number <= 0 || number > 65535 {
+		return errors.New("the port must be a number up to 65535")
+	}
+	return nil
+}
+
+// LoadSettings fills in the flags which weren't given on the command line from the environment and the config file.
+func LoadSettings(name string) error {
+	sourcesMutex.Lock()
+	if len(sources) == 0 {
+		flag.Visit(func(f *flag.Flag) {
+			sources[f.Name] = fromCommandLine
+		})
+	}
+	sourcesMutex.Unlock()
+
+	fileSettings, err := readConfigFile(*configFile, name)
+	if err != nil {
+		return err
+	}
+
+	var failed error
+	flag.VisitAll(func(f *flag.Flag) {
+		if failed != nil || source(f.Name) == fromCommandLine {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			failed = setFlag(f.Name, value, fromEnvironment)
+		} else if value, ok := fileSettings[f.Name]; ok {
+			failed = setFlag(f.Name, value, *configFile)
+		}
+	})
+	return failed
+}
+
+// SetFlags sets the given flags, like on the command line, so that no other setting overrides them.
+func SetFlags(arguments []string) error {
+	err := flag.CommandLine.Parse(arguments)
+	if err != nil {
+		return err
+	}
+	for _, argument := range arguments {
+		if !strings.HasPrefix(argument, "-") {
+			continue
+		}
+		flagName := strings.SplitN(strings.TrimLeft(argument, "-"), "=", 2)[0]
+		if flag.Lookup(flagName) != nil {
+			sourcesMutex.Lock()
+			sources[flagName] = fromCommandLine
+			sourcesMutex.Unlock()
+		}
+	}
+	return nil
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+func source(flagName string) string {
+	sourcesMutex.Lock()
+	defer sourcesMutex.Unlock()
+	return sources[flagName]
+}
+
+func setFlag(flagName string, value string, from string) error {
+	err := flag.Set(flagName, value)
+	if err != nil {
+		return fmt.Errorf("Error: Invalid -%s %q from %s: %v", flagName, value, from, err)
+	}
+	sourcesMutex.Lock()
+	sources[flagName] = from
+	sourcesMutex.Unlock()
+	return nil
+}
+
+// readConfigFile returns the top-level settings of the file, and those of the section of the service. Settings in the
+// section must be flags of the service, top-level ones may be meant for other services.
+func readConfigFile(file string, name string) (map[string]string, error) {
+	result := map[string]string{}
+	if len(file) == 0 {
+		return result, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	content := map[string]interface{}{}
+	if strings.HasSuffix(file, ".toml") {
+		_, err = toml.Decode(string(data), &content)
+	} else {
+		err = yaml.Unmarshal(data, &content)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error: Invalid config file %s: %v", file, err)
+	}
+
+	for key, value := range content {
+		if _, ok := value.(map[string]interface{}); !ok {
+			result[key] = settingValue(value)
+		}
+	}
+	section, ok := content[name].(map[string]interface{})
+	if !ok {
+		return result, nil
+	}
+	for key, value := range section {
+		if flag.Lookup(key) == nil {
+			return nil, fmt.Errorf("Error: Unknown setting %s.%s in %s", name, key, file)
+		}
+		result[key] = settingValue(value)
+	}
+	return result, nil
+}
+
+// settingValue formats a value of the config file as it would be given on the command line.
+func settingValue(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		values := []string{}
+		for _, item := range list {
+			values = append(values, settingValue(item))
+		}
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// dynamic is implemented by the flags which may change while the service runs.
+type dynamic interface {
+	dynamic()
+}
+
+// WatchSettings applies the settings of the config store to the flags which aren't set otherwise, and then checks
+// them for changes in the background.
+func WatchSettings(name string, configStoreAddress string) {
+	config := NewConfigStore(configStoreAddress)
+	applied := map[string]string{}
+	deadline := time.Now().Add(settingsStartupWait)
+	err := applySharedSettings(name, config, applied, true)
+	for err != nil && time.Now().Before(deadline) {
+		// The config store may not be up yet.
+		slog.Warn("Couldn't get the shared settings, trying again", "err", err)
+		time.Sleep(time.Second)
+		err = applySharedSettings(name, config, applied, true)
+	}
+	if err != nil {
+		Fatal(fmt.Errorf("Error: Couldn't get the shared settings from the config store at %s: %v", configStoreAddress, err))
+	}
+	go func() {
+		for {
+			time.Sleep(settingsInterval)
+			err := applySharedSettings(name, config, applied, false)
+			if err != nil {
+				slog.Warn("Couldn't get the shared settings", "err", err)
+			}
+		}
+	}()
+}
+
+// applySharedSettings sets the flags to the settings of the config store which changed since the last time.
+// applied holds the values set before. At the start every setting is applied, later only the dynamic ones. Only an
+// unreachable config store is an error, invalid values are logged and skipped.
+func applySharedSettings(name string, config *ConfigStore, applied map[string]string, starting bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stored, err := config.List(ctx, sharedSettingsPrefix)
+	if err != nil {
+		return err
+	}
+
+	wanted := map[string]string{}
+	for key, value := range stored {
+		flagName := strings.TrimPrefix(key, sharedSettingsPrefix)
+		if strings.HasPrefix(flagName, name+".") {
+			flagName = strings.TrimPrefix(flagName, name+".")
+		} else if strings.Contains(flagName, ".") {
+			continue // A setting of another service.
+		} else if _, ok := wanted[flagName]; ok {
+			continue // The setting of this service wins over the shared one.
+		}
+		if flag.Lookup(flagName) != nil {
+			wanted[flagName] = value
+		}
+	}
+	for flagName := range applied {
+		if _, ok := wanted[flagName]; !ok {
+			// Removed from the config store, back to the default.
+			wanted[flagName] = flag.Lookup(flagName).DefValue
+		}
+	}
+
+	flagNames := []string{}
+	for flagName := range wanted {
+		flagNames = append(flagNames, flagName)
+	}
+	sort.Strings(flagNames)
+	for _, flagName := range flagNames {
+		value := wanted[flagName]
+		from := source(flagName)
+		if applied[flagName] == value || (len(from) != 0 && from != fromConfigStore) {
+			continue
+		}
+		if _, ok := flag.Lookup(flagName).Value.(dynamic); !ok && !starting {
+			slog.Info("Setting changed in the config store, it applies after a restart", "setting", flagName, "value", value)
+			applied[flagName] = value
+			continue
+		}
+		err = setFlag(flagName, value, fromConfigStore)
+		if err != nil {
+			// Like at the start, an invalid value doesn't keep the service from running with the others.
+			slog.Warn("Ignoring a setting of the config store", "err", err)
+			applied[flagName] = value // Not again until it changes.
+			continue
+		}
+		applied[flagName] = value
+		if !starting {
+			slog.Info("Setting changed", "setting", flagName, "value", value)
+		}
+	}
+	return nil
+}
+
+// Duration is a duration flag which may change while the service runs. It must be positive.
+type Duration struct {
+	nanoseconds int64
+}
+
+func DurationFlag(name string, value time.Duration, usage string) *Duration {
+	duration := &Duration{nanoseconds: int64(value)}
+	flag.Var(duration, name, usage+" (dynamic)")
+	return duration
+}
+
+func (d *Duration) Get() time.Duration {
+	return time.Duration(atomic.LoadInt64(&d.nanoseconds))
+}
+
+func (d *Duration) Set(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	if parsed <= 0 {
+		return errors.New("must be positive")
+	}
+	atomic.StoreInt64(&d.nanoseconds, int64(parsed))
+	return nil
+}
+
+func (d *Duration) String() string {
+	return d.Get().String()
+}
+
+func (d *Duration) dynamic() {}
+
+// Bytes is a size flag which may change while the service runs, like 10000000 or 10MB.
+type Bytes struct {
+	bytes int64
+}
+
+func BytesFlag(name string, value int64, usage string) *Bytes {
+	size := &Bytes{bytes: value}
+	flag.Var(size, name, usage+" (dynamic)")
+	return size
+}
+
+func (b *Bytes) Get() int64 {
+	return atomic.LoadInt64(&b.bytes)
+}
+
+func (b *Bytes) Set(value string) error {
+	multiplier := int64(1)
+	for suffix, factor := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if strings.HasSuffix(value, suffix) {
+			value = strings.TrimSuffix(value, suffix)
+			multiplier = factor
+		}
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return errors.New("must be a number of bytes, optionally with KB, MB or GB")
+	}
+	if parsed <= 0 {
+		return errors.New("must be positive")
+	}
+	atomic.StoreInt64(&b.bytes, parsed*multiplier)
+	return nil
+}
+
+func (b *Bytes) String() string {
+	return strconv.FormatInt(b.Get(), 10)
+}
+
+func (b *Bytes) dynamic() {}
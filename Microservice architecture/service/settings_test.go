@@ -0,0 +1,55 @@
+package service
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testInterval = DurationFlag("test-interval", time.Second, "A dynamic setting of the tests")
+var testName = flag.String("test-name", "default", "A setting of the tests")
+
+// fakeConfigStore answers /list like the config store, with the settings.
+func fakeConfigStore(t *testing.T, settings map[string]string) *ConfigStore {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for key, value := range settings {
+			if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+				fmt.Fprintln(w, key, ":", value)
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return NewConfigStore(strings.TrimPrefix(server.URL, "http://"))
+}
+
+func TestAnInvalidSettingDoesntStopTheStart(t *testing.T) {
+	config := fakeConfigStore(t, map[string]string{
+		"settings.test-interval": "soon",
+		"settings.test-name":     "from the store",
+	})
+	err := applySharedSettings("tests", config, map[string]string{}, true)
+	if err != nil {
+		t.Fatalf("The start failed on an invalid setting: %v", err)
+	}
+	if testInterval.Get() != time.Second {
+		t.Fatalf("The invalid setting changed the interval to %v", testInterval.Get())
+	}
+	if *testName != "from the store" {
+		t.Fatalf("The valid setting wasn't applied: %q", *testName)
+	}
+}
+
+func TestAnUnreachableConfigStoreIsAnError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	address := strings.TrimPrefix(server.URL, "http://")
+	server.Close()
+
+	err := applySharedSettings("tests", NewConfigStore(address), map[string]string{}, true)
+	if err == nil {
+		t.Fatal("An unreachable config store went unnoticed")
+	}
+}
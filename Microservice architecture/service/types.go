@@ -0,0 +1,148 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+
+	"../rpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Task states, the same numbers as rpc.TaskState.
+const (
+	TaskNotStarted = 0
+	TaskInProgress = 1
+	TaskFinished   = 2
+	TaskPending    = 3 // The image is still being submitted, workers mustn't take the task yet.
+	TaskFailed     = 4 // The submission was rolled back, processing failed for good, or the task was canceled.
+)
+
+// DefaultOperation is what the workers do with an image when the submission doesn't tell otherwise.
+const DefaultOperation = "swapChannels"
+
+// Task is a task as the HTTP endpoints show it.
+type Task struct {
+	Id         int64           `json:"id"`
+	State      int             `json:"state"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"` // Image metadata as extracted by the images-store, kept opaque.
+	Progress   int             `json:"progress"`           // Percent, as reported by the worker.
+	Error      string          `json:"error,omitempty"`
+	ErrorCode  string          `json:"errorCode,omitempty"` // Machine readable kind of the error, like "invalid_image".
+	Attempts   int             `json:"attempts,omitempty"`  // How often a worker claimed the task.
+	Worker     string          `json:"worker,omitempty"`    // The worker which claimed the task last.
+	Operation  string          `json:"operation"`
+	Parameters json.RawMessage `json:"parameters,omitempty"` // JSON object with the parameters of the operation.
+	CreatedAt  time.Time       `json:"createdAt"`
+	StartedAt  *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+	Callback   string          `json:"callback,omitempty"` // URL to notify when the task finishes or fails.
+	Client     string          `json:"client,omitempty"`
+	Deliveries []Delivery      `json:"deliveries,omitempty"`
+	Trace      string          `json:"trace,omitempty"` // W3C traceparent of the submission, which the processing continues.
+}
+
+// Delivery is an attempt of the Master to notify the callback URL of a task.
+type Delivery struct {
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type GPSInfo struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude"`
+}
+
+// ImageMetadata is what the images-store extracts from an uploaded image.
+type ImageMetadata struct {
+	Width            int      `json:"width"`
+	Height           int      `json:"height"`
+	Format           string   `json:"format"`
+	ColorModel       string   `json:"colorModel"`
+	Orientation      int      `json:"orientation"`
+	CameraMake       string   `json:"cameraMake,omitempty"`
+	CameraModel      string   `json:"cameraModel,omitempty"`
+	DateTimeOriginal string   `json:"dateTimeOriginal,omitempty"`
+	ExposureTime     float64  `json:"exposureTime,omitempty"`
+	FNumber          float64  `json:"fNumber,omitempty"`
+	ISO              int      `json:"iso,omitempty"`
+	FocalLength      float64  `json:"focalLength,omitempty"`
+	GPS              *GPSInfo `json:"gps,omitempty"`
+	ExifPolicy       string   `json:"exifPolicy"`
+	User             string   `json:"user,omitempty"`
+}
+
+func TaskFromProto(task *rpc.Task) Task {
+	deliveries := []Delivery{}
+	for _, delivery := range task.Deliveries {
+		deliveries = append(deliveries, DeliveryFromProto(delivery))
+	}
+	return Task{
+		Id:         task.Id,
+		State:      int(task.State),
+		Metadata:   task.Metadata,
+		Progress:   int(task.Progress),
+		Error:      task.Error,
+		ErrorCode:  task.ErrorCode,
+		Attempts:   int(task.Attempts),
+		Worker:     task.Worker,
+		Operation:  task.Operation,
+		Parameters: task.Parameters,
+		CreatedAt:  task.CreatedAt.AsTime(),
+		StartedAt:  rpc.Time(task.StartedAt),
+		FinishedAt: rpc.Time(task.FinishedAt),
+		Callback:   task.Callback,
+		Client:     task.Client,
+		Deliveries: deliveries,
+		Trace:      task.Trace,
+	}
+}
+
+func TaskToProto(task Task) *rpc.Task {
+	deliveries := []*rpc.Delivery{}
+	for _, delivery := range task.Deliveries {
+		deliveries = append(deliveries, DeliveryToProto(delivery))
+	}
+	return &rpc.Task{
+		Id:         task.Id,
+		State:      rpc.TaskState(task.State),
+		Metadata:   task.Metadata,
+		Progress:   int32(task.Progress),
+		Error:      task.Error,
+		ErrorCode:  task.ErrorCode,
+		Attempts:   int32(task.Attempts),
+		Worker:     task.Worker,
+		Operation:  task.Operation,
+		Parameters: task.Parameters,
+		CreatedAt:  timestamppb.New(task.CreatedAt),
+		StartedAt:  rpc.Timestamp(task.StartedAt),
+		FinishedAt: rpc.Timestamp(task.FinishedAt),
+		Callback:   task.Callback,
+		Client:     task.Client,
+		Deliveries: deliveries,
+		Trace:      task.Trace,
+	}
+}
+
+func DeliveryFromProto(delivery *rpc.Delivery) Delivery {
+	return Delivery{
+		Event:      delivery.Event,
+		Attempt:    int(delivery.Attempt),
+		Time:       delivery.Time.AsTime(),
+		StatusCode: int(delivery.StatusCode),
+		Error:      delivery.Error,
+	}
+}
+
+func DeliveryToProto(delivery Delivery) *rpc.Delivery {
+	return &rpc.Delivery{
+		Event:      delivery.Event,
+		Attempt:    int32(delivery.Attempt),
+		Time:       timestamppb.New(delivery.Time),
+		StatusCode: int32(delivery.StatusCode),
+		Error:      delivery.Error,
+	}
+}
@@ -0,0 +1,277 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ended spans are queued and exported in batches, by a single goroutine, so that a slow collector doesn't hold up the
+// requests. When the queue is full, because the collector can't keep up, further spans are dropped.
+
+const queueSize = 4096
+const batchSize = 512
+const exportInterval = time.Second
+
+// Exporter sends a batch of spans of the named service somewhere.
+type Exporter interface {
+	Export(ctx context.Context, service string, spans []*Span) error
+}
+
+var exporting struct {
+	sync.Mutex
+	exporter Exporter
+	queue    chan *Span
+	flush    chan chan struct{}
+	dropped  int
+}
+
+// SetExporter starts exporting the spans of the service.
+func SetExporter(service string, exporter Exporter) {
+	exporting.Lock()
+	defer exporting.Unlock()
+	if exporting.exporter != nil {
+		return
+	}
+	exporting.exporter = exporter
+	exporting.queue = make(chan *Span, queueSize)
+	exporting.flush = make(chan chan struct{})
+	go exportLoop(exporter, service, exporting.queue, exporting.flush)
+}
+
+func record(span *Span) {
+	exporting.Lock()
+	queue := exporting.queue
+	exporting.Unlock()
+	if queue == nil {
+		return
+	}
+	select {
+	case queue <- span:
+	default:
+		exporting.Lock()
+		exporting.dropped++
+		exporting.Unlock()
+	}
+}
+
+// Flush exports the spans which ended so far, as long as the context allows. Services call it when they stop.
+func Flush(ctx context.Context) {
+	exporting.Lock()
+	flush := exporting.flush
+	exporting.Unlock()
+	if flush == nil {
+		return
+	}
+	done := make(chan struct{})
+	select {
+	case flush <- done:
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+func exportLoop(exporter Exporter, service string, queue <-chan *Span, flush <-chan chan struct{}) {
+	batch := []*Span{}
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := exporter.Export(ctx, service, batch)
+		cancel()
+		if err != nil {
+			// Without a context, the line belongs to no trace.
+			slog.Warn("Exporting spans failed", "count", len(batch), "error", err)
+		}
+		batch = []*Span{}
+
+		exporting.Lock()
+		dropped := exporting.dropped
+		exporting.dropped = 0
+		exporting.Unlock()
+		if dropped != 0 {
+			slog.Warn("Dropped spans, the exporter can't keep up", "count", dropped)
+		}
+	}
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case span := <-queue:
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case done := <-flush:
+			for len(queue) > 0 {
+				batch = append(batch, <-queue)
+			}
+			send()
+			close(done)
+		}
+	}
+}
+
+// FileExporter appends every batch to a file, as one line of OTLP JSON, like the file exporter of the
+// OpenTelemetry collector writes.
+type FileExporter struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+func NewFileExporter(path string) (*FileExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{file: file}, nil
+}
+
+func (exporter *FileExporter) Export(ctx context.Context, service string, spans []*Span) error {
+	data, err := json.Marshal(otlpRequest(service, spans))
+	if err != nil {
+		return err
+	}
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+	_, err = exporter.file.Write(append(data, '\n'))
+	return err
+}
+
+// OTLPExporter sends the batches to an OpenTelemetry collector, over OTLP/HTTP with JSON.
+type OTLPExporter struct {
+	url    string
+	client *http.Client
+}
+
+// NewOTLPExporter exports to the collector at the endpoint, like http://127.0.0.1:4318.
+func NewOTLPExporter(endpoint string) *OTLPExporter {
+	return &OTLPExporter{url: strings.TrimSuffix(endpoint, "/") + "/v1/traces", client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (exporter *OTLPExporter) Export(ctx context.Context, service string, spans []*Span) error {
+	data, err := json.Marshal(otlpRequest(service, spans))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, exporter.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := exporter.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("the collector answered %d: %s", response.StatusCode, body)
+	}
+	return nil
+}
+
+// The OTLP JSON encoding of an export request, see opentelemetry-proto. Ids are hex, times nanoseconds as strings.
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` // 2 is an error.
+	Message string `json:"message,omitempty"`
+}
+
+func otlpRequest(service string, spans []*Span) interface{} {
+	encoded := []otlpSpan{}
+	for _, span := range spans {
+		span.mutex.Lock()
+		myOtlpSpan := otlpSpan{
+			TraceId:           span.TraceId,
+			SpanId:            span.SpanId,
+			ParentSpanId:      span.ParentId,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.attributes),
+		}
+		if len(span.err) != 0 {
+			myOtlpSpan.Status = otlpStatus{Code: 2, Message: span.err}
+		}
+		span.mutex.Unlock()
+		encoded = append(encoded, myOtlpSpan)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": service}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "images"},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+func otlpAttributes(attributes map[string]interface{}) []otlpAttribute {
+	keys := []string{}
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := []otlpAttribute{}
+	for _, key := range keys {
+		value := attributes[key]
+		var encoded map[string]interface{}
+		switch typed := value.(type) {
+		case string:
+			encoded = map[string]interface{}{"stringValue": typed}
+		case bool:
+			encoded = map[string]interface{}{"boolValue": typed}
+		case int:
+			encoded = map[string]interface{}{"intValue": strconv.Itoa(typed)}
+		case int32:
+			encoded = map[string]interface{}{"intValue": strconv.FormatInt(int64(typed), 10)}
+		case int64:
+			encoded = map[string]interface{}{"intValue": strconv.FormatInt(typed, 10)}
+		case float64:
+			encoded = map[string]interface{}{"doubleValue": typed}
+		default:
+			encoded = map[string]interface{}{"stringValue": fmt.Sprint(typed)}
+		}
+		result = append(result, otlpAttribute{Key: key, Value: encoded})
+	}
+	return result
+}
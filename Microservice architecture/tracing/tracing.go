@@ -0,0 +1,159 @@
+// Package tracing follows a request through the services. Every request gets a request id, which the services log
+// and pass on in the X-Request-Id header, and a trace of spans in the style of OpenTelemetry: each service records a
+// span for the requests it serves and the calls it makes, and passes the trace on to the next service in the W3C
+// traceparent header. The spans are exported in the OTLP JSON format, to a file or to an OpenTelemetry collector.
+//
+// Without an exporter spans are still created, so the trace passes through, but not recorded.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+const TraceParentHeader = "traceparent"
+const RequestIdHeader = "X-Request-Id"
+
+// Kind tells what a span stands for, with the values of OTLP.
+type Kind int
+
+const (
+	Internal Kind = 1
+	Server   Kind = 2
+	Client   Kind = 3
+)
+
+type Span struct {
+	TraceId   string // 32 hex digits.
+	SpanId    string // 16 hex digits.
+	ParentId  string // Empty for the root of a trace.
+	Name      string
+	Kind      Kind
+	StartTime time.Time
+	EndTime   time.Time
+
+	mutex      sync.Mutex
+	attributes map[string]interface{}
+	err        string
+	ended      bool
+}
+
+type spanKey struct{}
+type requestIdKey struct{}
+
+// Start begins a span, as child of the span of the context if it has one, else of a new trace.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	span := &Span{SpanId: newId(8), Name: name, Kind: kind, StartTime: time.Now(), attributes: map[string]interface{}{}}
+	if parent := FromContext(ctx); parent != nil {
+		span.TraceId = parent.TraceId
+		span.ParentId = parent.SpanId
+	} else {
+		span.TraceId = newId(16)
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// FromContext returns the current span, which may also be the remote parent of a request. Nil without a trace.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// SetAttribute records a string, integer, float or boolean on the span.
+func (span *Span) SetAttribute(key string, value interface{}) {
+	span.mutex.Lock()
+	span.attributes[key] = value
+	span.mutex.Unlock()
+}
+
+// SetError marks the span as failed.
+func (span *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	span.mutex.Lock()
+	span.err = err.Error()
+	span.mutex.Unlock()
+}
+
+// End ends the span and hands it to the exporter. Later calls do nothing.
+func (span *Span) End() {
+	span.mutex.Lock()
+	if span.ended {
+		span.mutex.Unlock()
+		return
+	}
+	span.ended = true
+	span.EndTime = time.Now()
+	span.mutex.Unlock()
+	record(span)
+}
+
+func newId(bytes int) string {
+	id := make([]byte, bytes)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// NewRequestId returns a random id for a request which came without one.
+func NewRequestId() string {
+	return newId(8)
+}
+
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// RequestId returns the id of the request of the context, empty if there is none.
+func RequestId(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// TraceParent returns the traceparent header of the current span, empty without a trace.
+func TraceParent(ctx context.Context) string {
+	span := FromContext(ctx)
+	if span == nil {
+		return ""
+	}
+	return "00-" + span.TraceId + "-" + span.SpanId + "-01"
+}
+
+// WithTraceParent continues the trace of a traceparent header. A malformed one is ignored.
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || !isHex(parts[1]) || !isHex(parts[2]) {
+		return ctx
+	}
+	remote := &Span{TraceId: parts[1], SpanId: parts[2], ended: true}
+	return context.WithValue(ctx, spanKey{}, remote)
+}
+
+func isHex(text string) bool {
+	_, err := hex.DecodeString(text)
+	return err == nil && strings.Trim(text, "0") != ""
+}
+
+// Inject passes the request id and the trace of the context on, as headers or gRPC metadata.
+func Inject(ctx context.Context, set func(key string, value string)) {
+	if id := RequestId(ctx); len(id) != 0 {
+		set(RequestIdHeader, id)
+	}
+	if traceParent := TraceParent(ctx); len(traceParent) != 0 {
+		set(TraceParentHeader, traceParent)
+	}
+}
+
+// Extract continues the request id and the trace passed on by Inject. A request without an id gets a new one.
+func Extract(ctx context.Context, get func(key string) string) context.Context {
+	id := get(RequestIdHeader)
+	if len(id) == 0 || len(id) > 64 {
+		id = NewRequestId()
+	}
+	ctx = WithRequestId(ctx, id)
+	return WithTraceParent(ctx, get(TraceParentHeader))
+}